@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"valida/internal/apitest"
+
+	"github.com/spf13/cobra"
+)
+
+var importSpecFile string
+var importOutput string
+var postmanEnvironment string
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import Postman collections and HAR files as scenarios",
+	Long:  `Convert Postman collections and HAR captures into Valida scenarios that can be run with valida test --scenario`,
+}
+
+var importPostmanCmd = &cobra.Command{
+	Use:   "postman [COLLECTION FILE]",
+	Short: "Import a Postman v2.1 collection",
+	Long:  `Import a Postman v2.1 collection, with its variables, auth and saved example responses, as a scenario`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		collection, err := os.ReadFile(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var environment []byte
+		if postmanEnvironment != "" {
+			environment, err = os.ReadFile(postmanEnvironment)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		scenario, warnings, err := apitest.ImportPostman(collection, environment)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, warning := range warnings {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+		saveImportedScenario(scenario)
+	},
+}
+
+var importHARCmd = &cobra.Command{
+	Use:   "har [HAR FILE]",
+	Short: "Import a HAR capture",
+	Long:  `Import the requests of a HAR capture, with their captured responses as expectations, as a scenario`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		scenario, err := apitest.ImportHAR(data, showSecrets)
+		if err != nil {
+			log.Fatal(err)
+		}
+		saveImportedScenario(scenario)
+	},
+}
+
+// saveImportedScenario matches the scenario against the spec, when one is
+// given, reports the requests without a documented operation and writes the scenario
+func saveImportedScenario(scenario *apitest.Scenario) {
+	if importSpecFile != "" {
+		sources, err := specOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		apiSpec, err := apitest.TestAPISpec(importSpecFile, sources)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		options, err := runnerOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		runner, err := apitest.NewRunner(options)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer runner.Close()
+
+		unmatched := runner.MatchScenario(apiSpec, scenario)
+		fmt.Printf("Matched %d of %d requests to documented operations\n", len(scenario.Steps)-len(unmatched), len(scenario.Steps))
+		for _, step := range unmatched {
+			fmt.Printf("  Undocumented: %s %s\n", strings.ToUpper(step.Request.Method), step.Request.URL)
+		}
+	}
+
+	if err := apitest.SaveScenario(scenario, importOutput); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Scenario with %d steps written to %s\n", len(scenario.Steps), importOutput)
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.AddCommand(importPostmanCmd)
+	importCmd.AddCommand(importHARCmd)
+
+	importCmd.PersistentFlags().StringVarP(&importSpecFile, "file", "f", "", "OpenAPI Spec to match the imported requests against")
+	importCmd.PersistentFlags().StringVarP(&importOutput, "output", "o", "scenario.yaml", "Scenario file to write (YAML or JSON)")
+	importPostmanCmd.Flags().StringVarP(&postmanEnvironment, "environment", "e", "", "Postman environment file")
+	importHARCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Import credentials instead of {{env.VALIDA_*}} templates")
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"valida/internal/apitest"
+
+	"github.com/spf13/cobra"
+)
+
+var loadSpecFile string
+var loadOptions apitest.LoadOptions
+var loadStages string
+var loadReportFile string
+
+var loadCmd = &cobra.Command{
+	Use:   "load --file [SPEC]",
+	Short: "Load test the operations of the OpenAPI Spec",
+	Long:  `Drive the operations of the OpenAPI Spec at a target rate or number of virtual users, with optional ramping stages and a weighted operation mix, and print a latency and error summary`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := initConfig(); err != nil {
+			log.Fatal(err)
+		}
+
+		if loadStages != "" {
+			stages, err := apitest.ParseStages(loadStages)
+			if err != nil {
+				log.Fatal(err)
+			}
+			loadOptions.Stages = stages
+			if !cmd.Flags().Changed("executor") {
+				loadOptions.Executor = apitest.RampingRate
+			}
+		}
+
+		sources, err := specOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		apiSpec, err := apitest.TestAPISpec(loadSpecFile, sources)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		options, err := runnerOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		runner, err := apitest.NewRunner(options)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer runner.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		report, err := runner.RunLoad(ctx, apiSpec, loadOptions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		apitest.DisplayLoadReport(report)
+
+		if loadReportFile != "" {
+			if err := apitest.WriteLoadReport(report, loadReportFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(loadCmd)
+	loadCmd.Flags().StringVarP(&loadSpecFile, "file", "f", "", "OpenAPI Spec file (JSON or YAML), http(s) URL or - for stdin")
+	loadCmd.Flags().StringVar(&loadOptions.Executor, "executor", apitest.ConstantRate, "Executor: constant-rate, ramping-rate, constant-vus or ramping-vus")
+	loadCmd.Flags().IntVar(&loadOptions.Rate, "rate", 10, "Requests per second for the constant-rate executor")
+	loadCmd.Flags().IntVar(&loadOptions.VUs, "vus", 10, "Virtual users for the constant-vus executor")
+	loadCmd.Flags().IntVar(&loadOptions.MaxVUs, "max-vus", 100, "Maximum concurrent requests of the rate executors")
+	loadCmd.Flags().DurationVarP(&loadOptions.Duration, "duration", "d", 30*time.Second, "Duration of the constant executors")
+	loadCmd.Flags().IntVarP(&loadOptions.Iterations, "iterations", "n", 0, "Stop after this many requests")
+	loadCmd.Flags().StringVar(&loadStages, "stages", "", "Ramping stages as duration:target pairs, e.g. 30s:10,1m:10,30s:0")
+	loadCmd.Flags().StringToIntVarP(&loadOptions.Weights, "weight", "w", nil, "Relative weight of an operation by operationId or \"METHOD /path\", e.g. getPet=3")
+	loadCmd.Flags().StringVar(&loadReportFile, "report", "", "Write the summary as JSON")
+	addClientFlags(loadCmd)
+	addHookFlags(loadCmd)
+	loadCmd.MarkFlagRequired("file")
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"valida/internal/apitest"
+
+	"github.com/spf13/cobra"
+)
+
+var proxySpecFile string
+var proxyTarget string
+var proxyListen string
+var proxyRecord string
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy --file [SPEC] --target [URL]",
+	Short: "Check live traffic against the OpenAPI Spec",
+	Long:  `Run a proxy in front of a service that forwards real traffic and validates every request and response against the OpenAPI Spec. Recorded exchanges can be replayed later with valida test --scenario`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := initConfig(); err != nil {
+			log.Fatal(err)
+		}
+
+		target, err := url.Parse(proxyTarget)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			log.Fatalf("invalid target URL %q", proxyTarget)
+		}
+
+		sources, err := specOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		apiSpec, err := apitest.TestAPISpec(proxySpecFile, sources)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		options, err := runnerOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		runner, err := apitest.NewRunner(options)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer runner.Close()
+
+		proxy := apitest.NewContractProxy(runner, apiSpec, target, proxyRecord != "")
+		server := &http.Server{Addr: proxyListen, Handler: proxy}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+
+		fmt.Printf("Proxying http://%s to %s\n", proxyListen, target)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+
+		fmt.Println()
+		fmt.Println(proxy.Summary())
+
+		if recording := proxy.Recording(); recording != nil {
+			if err := apitest.SaveScenario(recording, proxyRecord); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Recorded %d exchanges to %s\n", len(recording.Steps), proxyRecord)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(proxyCmd)
+	proxyCmd.Flags().StringVarP(&proxySpecFile, "file", "f", "", "OpenAPI Spec file (JSON or YAML), http(s) URL or - for stdin")
+	proxyCmd.Flags().StringVarP(&proxyTarget, "target", "t", "", "Base URL of the service to forward traffic to")
+	proxyCmd.Flags().StringVarP(&proxyListen, "listen", "l", "localhost:8090", "Address the proxy listens on")
+	proxyCmd.Flags().StringVarP(&proxyRecord, "record", "r", "", "Save the exchanges as a scenario file to replay with valida test --scenario")
+	proxyCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Record credentials instead of {{env.VALIDA_*}} templates")
+	addTLSFlags(proxyCmd)
+	addNetworkFlags(proxyCmd)
+	proxyCmd.MarkFlagRequired("file")
+	proxyCmd.MarkFlagRequired("target")
+}
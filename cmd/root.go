@@ -4,8 +4,13 @@ import (
 	"fmt"
 	"github.com/spf13/cobra"
 	"os"
+
+	"valida/internal/apitest"
 )
 
+var configFile string
+var config *apitest.Config
+
 var rootCmd = &cobra.Command{
 	Use:   "valida",
 	Short: "Automatic API Testing Execution",
@@ -19,4 +24,18 @@ func Execute() {
 	}
 }
 
-func init() {}
+func initConfig() error {
+	if configFile == "" {
+		configFile = apitest.DefaultConfigFile()
+	}
+	if configFile == "" {
+		return nil
+	}
+	var err error
+	config, err = apitest.LoadConfig(configFile)
+	return err
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "Valida config file (default is ./valida.yaml if present)")
+}
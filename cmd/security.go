@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"valida/internal/apitest"
+
+	"github.com/spf13/cobra"
+)
+
+var securitySpecFile string
+var securityProbes []string
+var firstCredentials []string
+var secondCredentials []string
+var firstResources []string
+var securityReportFile string
+var securitySARIFFile string
+var includeUnsafe bool
+
+var securityCmd = &cobra.Command{
+	Use:   "security --file [SPEC]",
+	Short: "Probe the protected operations of the OpenAPI Spec for authentication and authorization flaws",
+	Long:  `Replay every operation with a security requirement without credentials, with invalid credentials, and with the credentials of a second user on the resources of the first one, report any 2xx response as a finding, and exit with an error when there are findings`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := initConfig(); err != nil {
+			log.Fatal(err)
+		}
+
+		securityOptions, err := securityUsers()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(securityProbes) > 0 {
+			securityOptions.Probes = securityProbes
+		}
+		if includeUnsafe {
+			securityOptions.IncludeUnsafe = true
+		}
+
+		sources, err := specOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		apiSpec, err := apitest.TestAPISpec(securitySpecFile, sources)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		options, err := runnerOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.Version = version
+		runner, err := apitest.NewRunner(options)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer runner.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		report, err := runner.RunSecurity(ctx, apiSpec, securityOptions)
+		if report == nil {
+			log.Fatal(err)
+		}
+		report.Spec = securitySpecFile
+		apitest.DisplaySecurityReport(report)
+
+		if securityReportFile != "" {
+			if err := apitest.WriteSecurityReport(report, securityReportFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if securitySARIFFile != "" {
+			if err := apitest.WriteSecuritySARIF(report, securitySARIFFile, version); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(130)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if report.Findings > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// securityUsers returns the users of the security section of the config file,
+// with the credentials and resources given by flags
+func securityUsers() (apitest.SecurityOptions, error) {
+	var securityOptions apitest.SecurityOptions
+	if config != nil {
+		securityOptions = config.Security
+	}
+	users := append([]apitest.SecurityUser{}, securityOptions.Users...)
+
+	set := func(index int, flag string, pairs []string, resources bool) error {
+		for len(users) <= index {
+			users = append(users, apitest.SecurityUser{})
+		}
+		// the maps of the config file are copied before the flags change them
+		user := &users[index]
+		credentials := make(map[string]string)
+		for name, value := range user.Credentials {
+			credentials[name] = value
+		}
+		resourceIDs := make(map[string]interface{})
+		for name, value := range user.Resources {
+			resourceIDs[name] = value
+		}
+		for _, pair := range pairs {
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok || name == "" {
+				return fmt.Errorf("invalid --%s %q, expected name=value", flag, pair)
+			}
+			if resources {
+				resourceIDs[name] = value
+			} else {
+				credentials[name] = value
+			}
+		}
+		user.Credentials, user.Resources = credentials, resourceIDs
+		return nil
+	}
+	if len(firstCredentials) > 0 {
+		if err := set(0, "credential", firstCredentials, false); err != nil {
+			return securityOptions, err
+		}
+	}
+	if len(firstResources) > 0 {
+		if err := set(0, "resource", firstResources, true); err != nil {
+			return securityOptions, err
+		}
+	}
+	if len(secondCredentials) > 0 {
+		if err := set(1, "second-credential", secondCredentials, false); err != nil {
+			return securityOptions, err
+		}
+	}
+	securityOptions.Users = users
+	return securityOptions, nil
+}
+
+func init() {
+	rootCmd.AddCommand(securityCmd)
+	securityCmd.Flags().StringVarP(&securitySpecFile, "file", "f", "", "OpenAPI Spec file (JSON or YAML), http(s) URL or - for stdin")
+	securityCmd.Flags().StringSliceVar(&securityProbes, "probe", nil, "Probes to run: no-credentials, invalid-credentials and other-user (default all)")
+	securityCmd.Flags().StringArrayVar(&firstCredentials, "credential", nil, "Credential of the first user for a security scheme, as scheme=value (repeatable)")
+	securityCmd.Flags().StringArrayVar(&secondCredentials, "second-credential", nil, "Credential of the second user for a security scheme, as scheme=value (repeatable)")
+	securityCmd.Flags().StringArrayVar(&firstResources, "resource", nil, "Id of a resource of the first user, as parameter=value (repeatable)")
+	securityCmd.Flags().BoolVar(&includeUnsafe, "include-unsafe", false, "Also probe POST, PUT, PATCH, DELETE and other methods that may change data")
+	securityCmd.Flags().StringVar(&securityReportFile, "report", "", "Write the results as JSON")
+	securityCmd.Flags().StringVar(&securitySARIFFile, "sarif", "", "Write the findings as a SARIF 2.1.0 report")
+	addClientFlags(securityCmd)
+	addHookFlags(securityCmd)
+	securityCmd.MarkFlagRequired("file")
+}
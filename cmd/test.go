@@ -1,50 +1,130 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
-	"path/filepath"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"valida/internal/apitest"
+	"valida/pkg/valida"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var file string
+var cookieJar bool
+var cacheSpecs bool
+var scenarioFile string
+var harFile string
+var showSecrets bool
+var commandFormat string
+var showCoverage bool
+var coverageReport string
+var minCoverage float64
+var logOptions apitest.LogOptions
 
 var testCmd = &cobra.Command{
-	Use:   "test --file [JSON/YAML FILE]",
+	Use:   "test --file [JSON/YAML FILE, URL or -]",
 	Short: "Test the given OpenAPI Spec file",
 	Long:  `Test the given OpenAPI Spec file`,
 	Run: func(cmd *cobra.Command, args []string) {
-		//if err := apitest.InitLogger(); err != nil {
-		//	log.Fatal(err)
-		//}
-		//defer func() {
-		//	err := apitest.CloseLogger()
-		//	if err != nil {
-		//		log.Fatal(err)
-		//	}
-		//}()
+		if err := initConfig(); err != nil {
+			log.Fatal(err)
+		}
 
 		file := viper.GetString("file")
-		ext := filepath.Ext(file)
-		if ext != ".json" && ext != ".yaml" && ext != ".yml" {
-			log.Fatal("File must be a .json, .yaml, or .yml file")
+
+		options, err := clientOptions()
+		if err != nil {
+			log.Fatal(err)
 		}
+		options.ConfigFile = configFile
+		options.CookieJar = cookieJar
+		options.Log = &logOptions
+		options.HARFile = harFile
+		options.Version = version
+		options.ShowSecrets = showSecrets
+		options.CommandFormat = commandFormat
 
-		apiSpec, err := apitest.TestAPISpec(file)
+		sources, err := specOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		apiSpec, err := apitest.TestAPISpec(file, sources)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		apitest.MakeRequest(apiSpec)
+		if scenarioFile != "" {
+			options.Scenario, err = valida.LoadScenario(scenarioFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		runner, err := valida.NewRunner(apiSpec, options)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		report, err := runner.Run(ctx)
+		if report == nil {
+			log.Fatal(err)
+		}
+		report.Print()
+		if errors.Is(err, context.Canceled) {
+			// a partial report, exit like a shell does on SIGINT
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(130)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if showCoverage || coverageReport != "" || minCoverage > 0 {
+			fmt.Println()
+			apitest.DisplayCoverage(report.Coverage)
+
+			if coverageReport != "" {
+				if err := apitest.WriteCoverageReport(report.Coverage, coverageReport); err != nil {
+					log.Fatal(err)
+				}
+			}
+			if err := apitest.CheckCoverage(report.Coverage, minCoverage); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(testCmd)
-	testCmd.Flags().StringVarP(&file, "file", "f", "", "OpenAPI Spec file (JSON or YAML)")
+	testCmd.Flags().StringVarP(&file, "file", "f", "", "OpenAPI Spec file (JSON or YAML), http(s) URL or - for stdin")
+	testCmd.Flags().BoolVar(&cacheSpecs, "cache", false, "Cache specs fetched over HTTP and revalidate them with their ETag")
+	testCmd.Flags().BoolVar(&cookieJar, "cookie-jar", false, "Keep cookies set by responses for the rest of the run")
+	testCmd.Flags().StringVar(&scenarioFile, "scenario", "", "Run the steps of a scenario instead of generated requests")
+	testCmd.Flags().StringVar(&harFile, "har", "", "Record every request and response of the run to a HAR 1.2 file")
+	testCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Do not mask credentials and redacted fields in the log, reproduce commands and HAR files")
+	testCmd.Flags().StringVar(&commandFormat, "command-format", "curl", "Command shown to reproduce failed requests (curl or httpie)")
+	testCmd.Flags().BoolVar(&showCoverage, "coverage", false, "Print the API coverage of the run")
+	testCmd.Flags().StringVar(&coverageReport, "coverage-report", "", "Write the API coverage of the run as JSON")
+	testCmd.Flags().Float64Var(&minCoverage, "min-coverage", 0, "Exit with an error when the API coverage percentage is below this value")
+	testCmd.Flags().StringVar(&logOptions.Format, "log-format", "text", "Log format (text or json)")
+	testCmd.Flags().StringVar(&logOptions.Level, "log-level", "info", "Log level (debug, info, warn or error)")
+	testCmd.Flags().StringVar(&logOptions.File, "log-file", "", "Log file, stderr or none (default test_log_<timestamp>.txt or .json)")
+	testCmd.Flags().StringSliceVar(&logOptions.Redact, "redact", nil, "Body fields whose values are masked in the log, in addition to secret-like fields")
+	addClientFlags(testCmd)
+	addRetryFlags(testCmd)
+	addRateLimitFlags(testCmd)
+	addHookFlags(testCmd)
 	testCmd.MarkFlagRequired("file")
 
 	viper.BindPFlag("file", testCmd.Flags().Lookup("file"))
@@ -6,12 +6,14 @@ import (
 	"io"
 	"net/http"
 	"reflect"
+	"strings"
 )
 
 // ExpectedResponse represents the expected response based on OpenAPI specification
 type ExpectedResponse struct {
 	StatusCode int
 	Body       map[string]interface{}
+	Cookies    []string
 }
 
 // GetExpectedResponse extracts the expected response for a given operation from the OpenAPI specification
@@ -54,10 +56,18 @@ func GetExpectedResponse(operation *Operation) (*ExpectedResponse, error) {
 
 // CompareResponses compares the actual response with the expected response
 func CompareResponses(actualResp *http.Response, expectedResp *ExpectedResponse) error {
-	if actualResp.StatusCode != expectedResp.StatusCode {
+	if expectedResp.StatusCode != 0 && actualResp.StatusCode != expectedResp.StatusCode {
 		return fmt.Errorf("expected status code %d, but got %d", expectedResp.StatusCode, actualResp.StatusCode)
 	}
 
+	if err := compareCookies(actualResp, expectedResp.Cookies); err != nil {
+		return err
+	}
+
+	if expectedResp.Body == nil {
+		return nil
+	}
+
 	actualBody, err := io.ReadAll(actualResp.Body)
 	if err != nil {
 		return fmt.Errorf("error reading response body: %w", err)
@@ -75,3 +85,37 @@ func CompareResponses(actualResp *http.Response, expectedResp *ExpectedResponse)
 
 	return nil
 }
+
+// compareCookies checks that the response sets every expected cookie
+func compareCookies(actualResp *http.Response, expected []string) error {
+	var missing []string
+	for _, name := range expected {
+		found := false
+		for _, cookie := range actualResp.Cookies() {
+			if strings.EqualFold(cookie.Name, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("expected cookies %s to be set", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// expectCookies adds the cookies the operation config expects to be set to the expected response
+func expectCookies(expectedResp *ExpectedResponse, opConfig *OperationConfig) *ExpectedResponse {
+	if opConfig == nil || len(opConfig.ExpectCookies) == 0 {
+		return expectedResp
+	}
+	if expectedResp == nil {
+		expectedResp = &ExpectedResponse{}
+	}
+	expectedResp.Cookies = opConfig.ExpectCookies
+	return expectedResp
+}
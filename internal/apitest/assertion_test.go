@@ -0,0 +1,65 @@
+package apitest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareCookies(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Set-Cookie": {"Session=s-1; Path=/; HttpOnly", "theme=dark"}}}
+	tests := []struct {
+		expected []string
+		want     string
+	}{
+		{nil, ""},
+		{[]string{"session", "theme"}, ""},
+		{[]string{"session", "csrf", "lang"}, "expected cookies csrf, lang to be set"},
+	}
+	for _, tt := range tests {
+		err := compareCookies(resp, tt.expected)
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || err.Error() != tt.want) {
+			t.Errorf("compareCookies(%v) = %v, want %q", tt.expected, err, tt.want)
+		}
+	}
+}
+
+func TestExpectCookies(t *testing.T) {
+	if got := expectCookies(nil, &OperationConfig{}); got != nil {
+		t.Errorf("expectCookies() without cookies = %+v, want nil", got)
+	}
+	got := expectCookies(nil, &OperationConfig{ExpectCookies: []string{"session"}})
+	if got == nil || got.StatusCode != 0 || len(got.Cookies) != 1 {
+		t.Errorf("expectCookies() = %+v, want only the cookies checked", got)
+	}
+	expected := &ExpectedResponse{StatusCode: 200}
+	if got := expectCookies(expected, &OperationConfig{ExpectCookies: []string{"session"}}); got != expected || got.StatusCode != 200 || got.Cookies[0] != "session" {
+		t.Errorf("expectCookies() = %+v, want the cookies added to the expected response", got)
+	}
+}
+
+func TestCookieParametersAndExpectCookies(t *testing.T) {
+	var cookies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookies = append(cookies, r.Header.Get("Cookie"))
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s-2"})
+	}))
+	defer server.Close()
+
+	dir := writeTestFiles(t, map[string]string{
+		"valida.yaml": `operations:
+  GET /orders/{orderId}:
+    expectCookies: [session, csrf]
+`,
+	})
+	rows := runTestConfig(t, orderSpec, server, filepath.Join(dir, "valida.yaml"))
+
+	if len(cookies) != 1 || !strings.HasPrefix(cookies[0], "session=") || cookies[0] == "session=" {
+		t.Errorf("Cookie = %q, want a generated session cookie parameter", cookies)
+	}
+	if len(rows) != 1 || !strings.Contains(rows[0].Assertion, "expected cookies csrf to be set") {
+		t.Errorf("rows = %+v, want the missing csrf cookie reported", rows)
+	}
+}
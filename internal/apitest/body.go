@@ -0,0 +1,116 @@
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// requestBodySchema picks the media type used to send the request body and
+// returns it together with its schema, preferring JSON media types
+func requestBodySchema(requestBody map[string]interface{}) (string, map[string]interface{}) {
+	content, _ := requestBody["content"].(map[string]interface{})
+	mediaTypes := sortedKeys(content)
+	if len(mediaTypes) == 0 {
+		return "", nil
+	}
+
+	chosen := mediaTypes[0]
+	for _, preferred := range []func(string) bool{
+		isJSONMediaType,
+		func(m string) bool { return m == "application/x-www-form-urlencoded" },
+		func(m string) bool { return m == "multipart/form-data" },
+	} {
+		found := false
+		for _, mediaType := range mediaTypes {
+			if preferred(mediaType) {
+				chosen, found = mediaType, true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	mediaType, _ := content[chosen].(map[string]interface{})
+	schema, _ := mediaType["schema"].(map[string]interface{})
+	if schema == nil {
+		schema = map[string]interface{}{}
+	}
+	return chosen, schema
+}
+
+// encodeRequestBody serializes the generated body for the chosen media type and
+// returns the body reader, its text for logging and the Content-Type to send
+func encodeRequestBody(fake *gofakeit.Faker, mediaType string, body map[string]interface{}) (io.Reader, string, string, error) {
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		values := url.Values{}
+		for key, value := range body {
+			for _, item := range formValues(value) {
+				values.Add(key, item)
+			}
+		}
+		encoded := values.Encode()
+		return strings.NewReader(encoded), encoded, mediaType, nil
+	case mediaType == "multipart/form-data":
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		keys := make([]string, 0, len(body))
+		for key := range body {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, item := range formValues(body[key]) {
+				if err := writer.WriteField(key, item); err != nil {
+					return nil, "", "", fmt.Errorf("writing multipart field %s: %w", key, err)
+				}
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return nil, "", "", fmt.Errorf("closing multipart body: %w", err)
+		}
+		return bytes.NewReader(buf.Bytes()), buf.String(), writer.FormDataContentType(), nil
+	case mediaType == "" || isJSONMediaType(mediaType):
+		if mediaType == "" {
+			mediaType = "application/json"
+		}
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("encoding JSON body: %w", err)
+		}
+		return bytes.NewReader(b), string(b), mediaType, nil
+	default:
+		text := fakeString(fake)
+		if value, ok := body["value"]; ok && len(body) == 1 {
+			text = formatValue(value)
+		}
+		return strings.NewReader(text), text, mediaType, nil
+	}
+}
+
+// formValues flattens a value into the strings sent for a form field
+func formValues(value interface{}) []string {
+	switch v := value.(type) {
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = formatValue(item)
+		}
+		return values
+	case map[string]interface{}:
+		b, _ := json.Marshal(v)
+		return []string{string(b)}
+	default:
+		return []string{formatValue(v)}
+	}
+}
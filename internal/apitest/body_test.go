@@ -0,0 +1,129 @@
+package apitest
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+func TestRequestBodySchema(t *testing.T) {
+	schema := map[string]interface{}{"type": "object"}
+	tests := []struct {
+		name       string
+		mediaTypes []string
+		want       string
+	}{
+		{"json first", []string{"multipart/form-data", "application/x-www-form-urlencoded", "application/json"}, "application/json"},
+		{"json suffix", []string{"application/xml", "application/vnd.pet+json"}, "application/vnd.pet+json"},
+		{"form over multipart", []string{"multipart/form-data", "application/x-www-form-urlencoded"}, "application/x-www-form-urlencoded"},
+		{"multipart over others", []string{"application/xml", "multipart/form-data"}, "multipart/form-data"},
+		{"first in order", []string{"text/plain", "application/xml"}, "application/xml"},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		content := map[string]interface{}{}
+		for _, mediaType := range tt.mediaTypes {
+			content[mediaType] = map[string]interface{}{"schema": schema}
+		}
+		mediaType, got := requestBodySchema(map[string]interface{}{"content": content})
+		if mediaType != tt.want {
+			t.Errorf("%s: media type = %q, want %q", tt.name, mediaType, tt.want)
+		}
+		if tt.want != "" && !reflect.DeepEqual(got, schema) {
+			t.Errorf("%s: schema = %v, want %v", tt.name, got, schema)
+		}
+	}
+
+	_, got := requestBodySchema(map[string]interface{}{"content": map[string]interface{}{"application/json": map[string]interface{}{}}})
+	if got == nil || len(got) != 0 {
+		t.Errorf("schema of a media type without schema = %v, want an empty schema", got)
+	}
+}
+
+func TestEncodeRequestBody(t *testing.T) {
+	body := map[string]interface{}{
+		"name":    "Rex & Co",
+		"tags":    []interface{}{"good", "boy"},
+		"age":     3.0,
+		"owner":   map[string]interface{}{"id": 1.0},
+		"vaccine": true,
+	}
+	wantFields := url.Values{
+		"name":    {"Rex & Co"},
+		"tags":    {"good", "boy"},
+		"age":     {"3"},
+		"owner":   {`{"id":1}`},
+		"vaccine": {"true"},
+	}
+	fake := gofakeit.New(1)
+
+	tests := []struct {
+		mediaType string
+		decode    func(t *testing.T, contentType, text string) url.Values
+	}{
+		{"application/x-www-form-urlencoded", func(t *testing.T, contentType, text string) url.Values {
+			if contentType != "application/x-www-form-urlencoded" {
+				t.Errorf("Content-Type = %q", contentType)
+			}
+			values, err := url.ParseQuery(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return values
+		}},
+		{"multipart/form-data", func(t *testing.T, contentType, text string) url.Values {
+			mediaType, params, err := mime.ParseMediaType(contentType)
+			if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+				t.Fatalf("Content-Type = %q, want multipart/form-data with a boundary", contentType)
+			}
+			form, err := multipart.NewReader(strings.NewReader(text), params["boundary"]).ReadForm(1 << 20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return url.Values(form.Value)
+		}},
+	}
+	for _, tt := range tests {
+		reader, text, contentType, err := encodeRequestBody(fake, tt.mediaType, body)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.mediaType, err)
+		}
+		sent, _ := io.ReadAll(reader)
+		if string(sent) != text {
+			t.Errorf("%s: the logged body differs from the sent one", tt.mediaType)
+		}
+		if got := tt.decode(t, contentType, text); !reflect.DeepEqual(got, wantFields) {
+			t.Errorf("%s: fields = %v, want %v", tt.mediaType, got, wantFields)
+		}
+	}
+}
+
+func TestEncodeRequestBodyOtherMediaTypes(t *testing.T) {
+	fake := gofakeit.New(1)
+	tests := []struct {
+		mediaType, wantType string
+		body                map[string]interface{}
+		want                string
+	}{
+		{"", "application/json", map[string]interface{}{"name": "Rex"}, `{"name":"Rex"}`},
+		{"application/problem+json", "application/problem+json", map[string]interface{}{"title": "x"}, `{"title":"x"}`},
+		{"text/plain", "text/plain", map[string]interface{}{"value": "hello"}, "hello"},
+	}
+	for _, tt := range tests {
+		_, text, contentType, err := encodeRequestBody(fake, tt.mediaType, tt.body)
+		if err != nil || text != tt.want || contentType != tt.wantType {
+			t.Errorf("encodeRequestBody(%q) = %q, %q, %v, want %q, %q", tt.mediaType, text, contentType, err, tt.want, tt.wantType)
+		}
+	}
+
+	_, text, _, err := encodeRequestBody(fake, "text/plain", map[string]interface{}{"a": 1.0, "b": 2.0})
+	if err != nil || text == "" || strings.HasPrefix(text, "{") {
+		t.Errorf("encodeRequestBody() of an object as text = %q, %v, want a generated string", text, err)
+	}
+}
@@ -1,8 +1,139 @@
 package apitest
 
-import "github.com/spf13/viper"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
 
-func loadConfig(filePath string) error {
-	viper.SetConfigFile(filePath)
-	return viper.ReadInConfig()
+	"github.com/invopop/yaml"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Config represents the Valida configuration file
+type Config struct {
+	Fixtures   []string                    `mapstructure:"fixtures"`
+	Operations map[string]*OperationConfig `mapstructure:"operations"`
+	MaxLatency string                      `mapstructure:"maxLatency"`
+	TLS        TLSOptions                  `mapstructure:"tls"`
+	Redact     []string                    `mapstructure:"redact"`
+	Hooks      []HookConfig                `mapstructure:"hooks"`
+	Scripts    *Scripts                    `mapstructure:"scripts"`
+	Security   SecurityOptions             `mapstructure:"security"`
+
+	fixtures []*Fixture
+}
+
+// OperationConfig represents the overrides for a single operation, keyed by
+// operationId or by "METHOD /path" in the configuration file
+type OperationConfig struct {
+	Parameters map[string]map[string]interface{} `mapstructure:"parameters"`
+	Body       map[string]interface{}            `mapstructure:"body"`
+	Patch      []PatchOperation                  `mapstructure:"patch"`
+	Data       string                            `mapstructure:"data"`
+
+	ExpectCookies []string `mapstructure:"expectCookies"`
+	MaxLatency    string   `mapstructure:"maxLatency"`
+	Scripts       *Scripts `mapstructure:"scripts"`
+}
+
+// PatchOperation represents a JSON pointer patch applied to a generated request body
+type PatchOperation struct {
+	Op    string      `mapstructure:"op"`
+	Path  string      `mapstructure:"path"`
+	Value interface{} `mapstructure:"value"`
+}
+
+// Fixture represents a reusable set of parameter and body field values
+type Fixture struct {
+	Parameters map[string]interface{} `mapstructure:"parameters"`
+	Body       map[string]interface{} `mapstructure:"body"`
+}
+
+// LoadConfig reads the Valida configuration file and the fixture files it references
+func LoadConfig(filePath string) (*Config, error) {
+	cfg := &Config{}
+	if err := decodeFile(filePath, cfg); err != nil {
+		return nil, fmt.Errorf("decoding config file: %w", err)
+	}
+
+	for _, opConfig := range cfg.Operations {
+		if opConfig != nil && opConfig.Data != "" && !filepath.IsAbs(opConfig.Data) {
+			opConfig.Data = filepath.Join(filepath.Dir(filePath), opConfig.Data)
+		}
+		if opConfig != nil {
+			if err := opConfig.Scripts.load(filepath.Dir(filePath)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := cfg.Scripts.load(filepath.Dir(filePath)); err != nil {
+		return nil, err
+	}
+
+	resolveTLSPaths(&cfg.TLS, filepath.Dir(filePath))
+	for i, hook := range cfg.Hooks {
+		if hook.Plugin != "" && !filepath.IsAbs(hook.Plugin) {
+			cfg.Hooks[i].Plugin = filepath.Join(filepath.Dir(filePath), hook.Plugin)
+		}
+	}
+
+	for _, fixturePath := range cfg.Fixtures {
+		if !filepath.IsAbs(fixturePath) {
+			fixturePath = filepath.Join(filepath.Dir(filePath), fixturePath)
+		}
+		fixture, err := loadFixture(fixturePath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.fixtures = append(cfg.fixtures, fixture)
+	}
+
+	return cfg, nil
+}
+
+// DefaultConfigFile returns the configuration file used when none is given,
+// or an empty string if it does not exist
+func DefaultConfigFile() string {
+	for _, name := range []string{"valida.yaml", "valida.yml", "valida.json"} {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+func loadFixture(filePath string) (*Fixture, error) {
+	fixture := &Fixture{}
+	if err := decodeFile(filePath, fixture); err != nil {
+		return nil, fmt.Errorf("decoding fixture file %s: %w", filePath, err)
+	}
+	return fixture, nil
+}
+
+// decodeFile reads a YAML or JSON file into target. The file is not read
+// through viper, which lowercases every key, so body fields, patch values and
+// resources keep the case of the file.
+func decodeFile(filePath string, target interface{}) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		Result:           target,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(raw)
 }
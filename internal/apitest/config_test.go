@@ -0,0 +1,148 @@
+package apitest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const ordersSpec = `openapi: 3.0.3
+info:
+  title: Orders
+  version: "1.0"
+servers:
+  - url: http://localhost
+paths:
+  /orders:
+    post:
+      operationId: createOrder
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                customerId:
+                  type: string
+                shippingAddress:
+                  type: object
+                  properties:
+                    zipCode:
+                      type: string
+      responses:
+        "201":
+          description: Created
+`
+
+// writeTestFiles writes files to a temporary directory and returns its path
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// captureService answers every request with status and returns the request
+// bodies it received, decoded as JSON
+func captureService(t *testing.T, status int) (*httptest.Server, func() []map[string]interface{}) {
+	t.Helper()
+	var mu sync.Mutex
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		json.Unmarshal(data, &body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []map[string]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]map[string]interface{}(nil), bodies...)
+	}
+}
+
+// runTestConfig runs every operation of spec against server with the config file
+func runTestConfig(t *testing.T, spec string, server *httptest.Server, configFile string) []TableRow {
+	t.Helper()
+	cfg, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiSpec := loadTestSpec(t, strings.Replace(spec, "http://localhost", server.URL, 1))
+	runner, err := NewRunner(RunnerOptions{Config: cfg, Log: LogOptions{File: "none"}, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	if err := runner.Run(context.Background(), runner.PlanRequests(apiSpec)); err != nil {
+		t.Fatal(err)
+	}
+	return runner.Results()
+}
+
+func TestLoadConfigKeepsKeyCase(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"valida.yaml": `fixtures: [customer.yaml]
+operations:
+  createOrder:
+    body:
+      shippingAddress:
+        zipCode: "12345"
+        streetLine: Main Street
+    patch:
+      - op: add
+        path: /metadata
+        value:
+          traceId: abc
+`,
+		"customer.yaml": `body:
+  customerId: c-1
+`,
+	})
+	server, bodies := captureService(t, http.StatusCreated)
+
+	rows := runTestConfig(t, ordersSpec, server, filepath.Join(dir, "valida.yaml"))
+	if len(rows) != 1 || rows[0].Assertion != "PASS" {
+		t.Fatalf("rows = %+v", rows)
+	}
+
+	want := map[string]interface{}{
+		"customerId":      "c-1",
+		"shippingAddress": map[string]interface{}{"zipCode": "12345", "streetLine": "Main Street"},
+		"metadata":        map[string]interface{}{"traceId": "abc"},
+	}
+	if got := bodies(); len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Errorf("request bodies = %v, want %v", got, want)
+	}
+}
+
+func TestLoadConfigSecurityResources(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"valida.json": `{"security": {"users": [{"name": "alice", "credentials": {"apiKey": "alice-key"}, "resources": {"orderId": "1001"}}]}}`,
+	})
+	cfg, err := LoadConfig(filepath.Join(dir, "valida.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := cfg.Security.Users
+	if len(users) != 1 || users[0].Resources["orderId"] != "1001" || users[0].Credentials["apiKey"] != "alice-key" {
+		t.Errorf("security users = %+v", users)
+	}
+}
@@ -0,0 +1,485 @@
+package apitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+const untaggedCoverage = "(untagged)"
+
+// coverageRecorder collects what the requests of a runner exercised, per operation
+type coverageRecorder struct {
+	mu       sync.Mutex
+	observed map[*Operation]*observedOperation
+}
+
+func newCoverageRecorder() *coverageRecorder {
+	return &coverageRecorder{observed: make(map[*Operation]*observedOperation)}
+}
+
+// observedOperation represents what a run exercised of a single operation
+type observedOperation struct {
+	statuses   map[int]bool
+	parameters map[string]bool
+	fields     map[string]bool
+	enumValues map[string]bool
+}
+
+// CoverageStats represents how many items of one kind were covered
+type CoverageStats struct {
+	Covered int     `json:"covered"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+}
+
+// CoverageSummary represents the coverage of a set of operations
+type CoverageSummary struct {
+	Operations CoverageStats `json:"operations"`
+	Responses  CoverageStats `json:"responses"`
+	Parameters CoverageStats `json:"parameters"`
+	BodyFields CoverageStats `json:"bodyFields"`
+	EnumValues CoverageStats `json:"enumValues"`
+	Total      CoverageStats `json:"total"`
+}
+
+// OperationCoverage represents the coverage of a single operation and the
+// items the run did not exercise
+type OperationCoverage struct {
+	Operation string          `json:"operation"`
+	Tags      []string        `json:"tags,omitempty"`
+	Summary   CoverageSummary `json:"summary"`
+	Missing   []string        `json:"missing,omitempty"`
+}
+
+// CoverageReport represents the coverage of the spec by a run, in total and per tag
+type CoverageReport struct {
+	Total      CoverageSummary             `json:"total"`
+	Tags       map[string]*CoverageSummary `json:"tags"`
+	Operations []*OperationCoverage        `json:"operations"`
+}
+
+// record notes the parameters, body fields, enum values and status code
+// exercised by a request to a documented operation
+func (c *coverageRecorder) record(operation *Operation, req *http.Request, body []byte, statusCode int) {
+	if operation == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	observed, ok := c.observed[operation]
+	if !ok {
+		observed = &observedOperation{
+			statuses:   make(map[int]bool),
+			parameters: make(map[string]bool),
+			fields:     make(map[string]bool),
+			enumValues: make(map[string]bool),
+		}
+		c.observed[operation] = observed
+	}
+	observed.statuses[statusCode] = true
+
+	for _, param := range operation.Parameters {
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		key := in + " parameter " + name
+
+		var values []string
+		switch in {
+		case "path":
+			observed.parameters[key] = true
+			continue
+		case "query":
+			for key, queryValues := range req.URL.Query() {
+				// deepObject parameters are sent as name[property]=value
+				if key != name && !strings.HasPrefix(key, name+"[") {
+					continue
+				}
+				for _, value := range queryValues {
+					values = append(values, splitParameterValue(value)...)
+				}
+			}
+		case "header":
+			for _, value := range req.Header.Values(name) {
+				values = append(values, splitParameterValue(value)...)
+			}
+		case "cookie":
+			if cookie, err := req.Cookie(name); err == nil {
+				values = splitParameterValue(cookie.Value)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		observed.parameters[key] = true
+		for _, value := range values {
+			observed.enumValues[key+"="+strings.TrimSpace(value)] = true
+		}
+	}
+
+	if len(body) > 0 {
+		var value interface{}
+		if json.Unmarshal(body, &value) != nil {
+			if form, err := url.ParseQuery(string(body)); err == nil {
+				object := make(map[string]interface{})
+				for name, values := range form {
+					object[name] = values[0]
+				}
+				value = object
+			}
+		}
+		observeFields(observed, value, "")
+	}
+}
+
+// splitParameterValue splits the items of a serialized array parameter, which
+// are separated by commas, spaces or pipes depending on the style
+func splitParameterValue(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '|'
+	})
+}
+
+// observeFields records the field paths and scalar values of a request body
+func observeFields(observed *observedOperation, value interface{}, prefix string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, item := range v {
+			path := name
+			if prefix != "" {
+				path = prefix + "." + name
+			}
+			observed.fields["body field "+path] = true
+			observeFields(observed, item, path)
+		}
+	case []interface{}:
+		for _, item := range v {
+			observeFields(observed, item, prefix)
+		}
+	default:
+		if prefix != "" {
+			observed.enumValues["body field "+prefix+"="+fmt.Sprint(v)] = true
+		}
+	}
+}
+
+// report compares the operations, documented response codes, parameters,
+// optional body fields and enum values of the spec with what was exercised
+func (c *coverageRecorder) report(apiSpec *APISpec) *CoverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := &CoverageReport{Tags: make(map[string]*CoverageSummary)}
+
+	var paths []string
+	for path := range apiSpec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		pathItem := apiSpec.Paths[path]
+		var methods []string
+		for method := range pathItem.Operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			operation := pathItem.Operations[method]
+			coverage := operationCoverage(apiSpec, operation, c.observed[operation])
+			coverage.Operation = operationName(path, operation)
+			report.Operations = append(report.Operations, coverage)
+
+			report.Total.add(coverage.Summary)
+			tags := operation.Tags
+			if len(tags) == 0 {
+				tags = []string{untaggedCoverage}
+			}
+			for _, tag := range tags {
+				if report.Tags[tag] == nil {
+					report.Tags[tag] = &CoverageSummary{}
+				}
+				report.Tags[tag].add(coverage.Summary)
+			}
+		}
+	}
+
+	report.Total.finish()
+	for _, summary := range report.Tags {
+		summary.finish()
+	}
+	return report
+}
+
+func operationCoverage(apiSpec *APISpec, operation *Operation, observed *observedOperation) *OperationCoverage {
+	if observed == nil {
+		observed = &observedOperation{}
+	}
+
+	coverage := &OperationCoverage{Tags: operation.Tags}
+	summary := &coverage.Summary
+	check := func(stats *CoverageStats, covered bool, item string) {
+		stats.Total++
+		if covered {
+			stats.Covered++
+		} else {
+			coverage.Missing = append(coverage.Missing, item)
+		}
+	}
+
+	check(&summary.Operations, len(observed.statuses) > 0, "operation")
+
+	var codes []string
+	for code := range operation.Responses {
+		if code != "default" {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		check(&summary.Responses, statusObserved(code, observed.statuses), "response "+code)
+	}
+
+	for _, param := range operation.Parameters {
+		param = resolveSchema(apiSpec.Document, param)
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		key := in + " parameter " + name
+		check(&summary.Parameters, observed.parameters[key], key)
+
+		schema := resolveSchema(apiSpec.Document, parameterSchema(param))
+		if primaryType(schema) == "array" {
+			items, _ := schema["items"].(map[string]interface{})
+			schema = resolveSchema(apiSpec.Document, items)
+		}
+		for _, value := range enumValues(schema) {
+			check(&summary.EnumValues, observed.enumValues[key+"="+value], key+"="+value)
+		}
+	}
+
+	if operation.RequestBody != nil {
+		_, schema := requestBodySchema(resolveSchema(apiSpec.Document, operation.RequestBody))
+		fields, enums := bodyFields(apiSpec.Document, schema, "", 0)
+		for _, field := range fields {
+			check(&summary.BodyFields, observed.fields["body field "+field], "body field "+field)
+		}
+		for _, field := range sortedEnumFields(enums) {
+			for _, value := range enums[field] {
+				key := "body field " + field + "=" + value
+				check(&summary.EnumValues, observed.enumValues[key], key)
+			}
+		}
+	}
+
+	summary.finish()
+	return coverage
+}
+
+// bodyFields lists the optional fields of a request body schema and the enum
+// values of all its fields, using dotted paths for nested objects
+func bodyFields(document, schema map[string]interface{}, prefix string, depth int) ([]string, map[string][]string) {
+	var fields []string
+	enums := make(map[string][]string)
+	if schema == nil || depth > 5 {
+		return fields, enums
+	}
+	schema = resolveSchema(document, schema)
+
+	if primaryType(schema) == "array" {
+		items, _ := schema["items"].(map[string]interface{})
+		return bodyFields(document, items, prefix, depth+1)
+	}
+
+	required := make(map[string]bool)
+	if names, ok := schema["required"].([]interface{}); ok {
+		for _, name := range names {
+			required[fmt.Sprint(name)] = true
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	for _, name := range sortedKeys(properties) {
+		property, _ := properties[name].(map[string]interface{})
+		property = resolveSchema(document, property)
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		if !required[name] {
+			fields = append(fields, path)
+		}
+		if values := enumValues(property); len(values) > 0 {
+			enums[path] = values
+		}
+
+		nestedFields, nestedEnums := bodyFields(document, property, path, depth+1)
+		fields = append(fields, nestedFields...)
+		for field, values := range nestedEnums {
+			enums[field] = values
+		}
+	}
+	return fields, enums
+}
+
+func enumValues(schema map[string]interface{}) []string {
+	enum, _ := schema["enum"].([]interface{})
+	values := make([]string, 0, len(enum))
+	for _, value := range enum {
+		if value != nil {
+			values = append(values, fmt.Sprint(value))
+		}
+	}
+	return values
+}
+
+func sortedEnumFields(enums map[string][]string) []string {
+	fields := make([]string, 0, len(enums))
+	for field := range enums {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// statusObserved reports whether a documented response code, such as 200 or
+// 4XX, matches one of the observed status codes
+func statusObserved(code string, statuses map[int]bool) bool {
+	if status, err := strconv.Atoi(code); err == nil {
+		return statuses[status]
+	}
+	if len(code) == 3 && strings.EqualFold(code[1:], "XX") {
+		for status := range statuses {
+			if strconv.Itoa(status/100) == code[:1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *CoverageSummary) add(other CoverageSummary) {
+	s.Operations.add(other.Operations)
+	s.Responses.add(other.Responses)
+	s.Parameters.add(other.Parameters)
+	s.BodyFields.add(other.BodyFields)
+	s.EnumValues.add(other.EnumValues)
+}
+
+// finish computes the percentages and the total over all kinds of items
+func (s *CoverageSummary) finish() {
+	s.Total = CoverageStats{}
+	for _, stats := range []*CoverageStats{&s.Operations, &s.Responses, &s.Parameters, &s.BodyFields, &s.EnumValues} {
+		stats.finish()
+		s.Total.add(*stats)
+	}
+	s.Total.finish()
+}
+
+func (s *CoverageStats) add(other CoverageStats) {
+	s.Covered += other.Covered
+	s.Total += other.Total
+}
+
+func (s *CoverageStats) finish() {
+	s.Percent = 100
+	if s.Total > 0 {
+		s.Percent = float64(s.Covered) * 100 / float64(s.Total)
+	}
+}
+
+func (s CoverageStats) String() string {
+	if s.Total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d (%.0f%%)", s.Covered, s.Total, s.Percent)
+}
+
+// CheckCoverage returns an error when the total coverage of the report is
+// below minimum percent
+func CheckCoverage(report *CoverageReport, minimum float64) error {
+	if report.Total.Total.Percent < minimum {
+		return fmt.Errorf("API coverage %.1f%% is below the minimum of %.1f%%", report.Total.Total.Percent, minimum)
+	}
+	return nil
+}
+
+// WriteCoverageReport writes the coverage report as JSON
+func WriteCoverageReport(report *CoverageReport, filePath string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding coverage report: %w", err)
+	}
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		return fmt.Errorf("writing coverage report: %w", err)
+	}
+	return nil
+}
+
+// DisplayCoverage prints the coverage per tag followed by the items the run did not exercise
+func DisplayCoverage(report *CoverageReport) {
+	const tagWidth = 24
+	const columnWidth = 17
+
+	columns := []string{"Operations", "Responses", "Parameters", "Body fields", "Enum values", "Total"}
+	cells := []string{headerStyle.Width(tagWidth).Render("Tag")}
+	for _, column := range columns {
+		cells = append(cells, borderStyle.Render("│"), headerStyle.Width(columnWidth).Render(column))
+	}
+	renderedRows := []string{lipgloss.JoinHorizontal(lipgloss.Top, cells...)}
+
+	var tags []string
+	for tag := range report.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	renderRow := func(name string, summary *CoverageSummary, style lipgloss.Style) string {
+		cells := []string{style.Width(tagWidth).Render(truncate(name, tagWidth))}
+		for _, stats := range []CoverageStats{summary.Operations, summary.Responses, summary.Parameters, summary.BodyFields, summary.EnumValues, summary.Total} {
+			cells = append(cells, borderStyle.Render("│"), style.Width(columnWidth).Render(stats.String()))
+		}
+		return lipgloss.JoinHorizontal(lipgloss.Top, cells...)
+	}
+	for _, tag := range tags {
+		renderedRows = append(renderedRows, renderRow(tag, report.Tags[tag], cellStyle))
+	}
+	renderedRows = append(renderedRows, renderRow("All", &report.Total, cellStyle.Copy().Bold(true)))
+
+	table := lipgloss.NewStyle().
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(lipgloss.Color("240"))
+	fmt.Println(table.Render(lipgloss.JoinVertical(lipgloss.Left, renderedRows...)))
+	fmt.Println(totalStyle.Render(fmt.Sprintf("API Coverage: %.1f%%", report.Total.Total.Percent)))
+
+	var uncovered []*OperationCoverage
+	for _, operation := range report.Operations {
+		if len(operation.Missing) > 0 {
+			uncovered = append(uncovered, operation)
+		}
+	}
+	if len(uncovered) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(warningStyle.Render("Not covered:"))
+	for _, operation := range uncovered {
+		if operation.Summary.Operations.Covered == 0 {
+			fmt.Printf("  %s: not tested\n", operation.Operation)
+			continue
+		}
+		fmt.Printf("  %s: %s\n", operation.Operation, strings.Join(operation.Missing, ", "))
+	}
+}
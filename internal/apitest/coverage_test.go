@@ -0,0 +1,163 @@
+package apitest
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const coverageSpec = `openapi: 3.0.3
+info:
+  title: Pets
+  version: "1.0"
+servers:
+  - url: http://localhost
+paths:
+  /pets:
+    get:
+      tags: [pets]
+      parameters:
+        - name: status
+          in: query
+          schema:
+            type: array
+            items:
+              type: string
+              enum: [available, sold]
+        - name: X-Trace
+          in: header
+          schema:
+            type: string
+      responses:
+        "200":
+          description: Pets
+        4XX:
+          description: Bad request
+        default:
+          description: Error
+    post:
+      tags: [pets]
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name]
+              properties:
+                name:
+                  type: string
+                tag:
+                  type: string
+                kind:
+                  type: string
+                  enum: [cat, dog]
+                owner:
+                  type: object
+                  properties:
+                    email:
+                      type: string
+      responses:
+        "201":
+          description: Created
+  /health:
+    get:
+      responses:
+        "200":
+          description: Healthy
+`
+
+func TestCoverageReport(t *testing.T) {
+	apiSpec := loadTestSpec(t, coverageSpec)
+	pets := apiSpec.Paths["/pets"].Operations
+	recorder := newCoverageRecorder()
+
+	listAvailable, _ := http.NewRequest(http.MethodGet, "http://localhost/pets?status=available", nil)
+	recorder.record(pets["get"], listAvailable, nil, http.StatusOK)
+	listSold, _ := http.NewRequest(http.MethodGet, "http://localhost/pets?status=sold", nil)
+	listSold.Header.Set("X-Trace", "t-1")
+	recorder.record(pets["get"], listSold, nil, http.StatusNotFound)
+	create, _ := http.NewRequest(http.MethodPost, "http://localhost/pets", nil)
+	recorder.record(pets["post"], create, []byte(`{"name": "Rex", "kind": "dog", "owner": {"email": "rex@example.com"}}`), http.StatusCreated)
+	recorder.record(nil, create, nil, http.StatusOK)
+
+	report := recorder.report(apiSpec)
+
+	operations := make(map[string]*OperationCoverage)
+	for _, operation := range report.Operations {
+		operations[operation.Operation] = operation
+	}
+	if len(operations) != 3 {
+		t.Fatalf("operations = %v, want the three operations of the spec", report.Operations)
+	}
+	tests := []struct {
+		name    string
+		summary CoverageSummary
+		missing []string
+	}{
+		{"GET /pets", CoverageSummary{
+			Operations: CoverageStats{1, 1, 100}, Responses: CoverageStats{2, 2, 100},
+			Parameters: CoverageStats{2, 2, 100}, BodyFields: CoverageStats{0, 0, 100},
+			EnumValues: CoverageStats{2, 2, 100}, Total: CoverageStats{7, 7, 100},
+		}, nil},
+		{"POST /pets", CoverageSummary{
+			Operations: CoverageStats{1, 1, 100}, Responses: CoverageStats{1, 1, 100},
+			Parameters: CoverageStats{0, 0, 100}, BodyFields: CoverageStats{3, 4, 75},
+			EnumValues: CoverageStats{1, 2, 50}, Total: CoverageStats{6, 8, 75},
+		}, []string{"body field tag", "body field kind=cat"}},
+		{"GET /health", CoverageSummary{
+			Operations: CoverageStats{0, 1, 0}, Responses: CoverageStats{0, 1, 0},
+			Parameters: CoverageStats{0, 0, 100}, BodyFields: CoverageStats{0, 0, 100},
+			EnumValues: CoverageStats{0, 0, 100}, Total: CoverageStats{0, 2, 0},
+		}, []string{"operation", "response 200"}},
+	}
+	for _, tt := range tests {
+		operation := operations[tt.name]
+		if operation == nil {
+			t.Errorf("%s: no coverage", tt.name)
+			continue
+		}
+		if operation.Summary != tt.summary {
+			t.Errorf("%s: summary = %+v, want %+v", tt.name, operation.Summary, tt.summary)
+		}
+		if !reflect.DeepEqual(operation.Missing, tt.missing) {
+			t.Errorf("%s: missing = %q, want %q", tt.name, operation.Missing, tt.missing)
+		}
+	}
+
+	if got := report.Tags["pets"].Total; got.Covered != 13 || got.Total != 15 {
+		t.Errorf("pets tag total = %+v, want 13 of 15", got)
+	}
+	if got := report.Tags[untaggedCoverage].Operations; got.Covered != 0 || got.Total != 1 {
+		t.Errorf("untagged operations = %+v, want 0 of 1", got)
+	}
+	if got := report.Total.Total; got.Covered != 13 || got.Total != 17 {
+		t.Errorf("total = %+v, want 13 of 17", got)
+	}
+}
+
+func TestStatusObserved(t *testing.T) {
+	statuses := map[int]bool{201: true, 404: true}
+	tests := map[string]bool{"201": true, "200": false, "4XX": true, "4xx": true, "5XX": false, "2X": false}
+	for code, want := range tests {
+		if got := statusObserved(code, statuses); got != want {
+			t.Errorf("statusObserved(%s) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestCheckCoverage(t *testing.T) {
+	report := &CoverageReport{Total: CoverageSummary{Operations: CoverageStats{Covered: 3, Total: 4}}}
+	report.Total.finish()
+
+	if err := CheckCoverage(report, 0); err != nil {
+		t.Errorf("CheckCoverage() without minimum = %v", err)
+	}
+	if err := CheckCoverage(report, 75); err != nil {
+		t.Errorf("CheckCoverage() at the minimum = %v", err)
+	}
+	err := CheckCoverage(report, 80)
+	if err == nil || !strings.Contains(err.Error(), "API coverage 75.0% is below the minimum of 80.0%") {
+		t.Errorf("CheckCoverage() below the minimum = %v", err)
+	}
+}
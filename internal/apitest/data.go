@@ -0,0 +1,153 @@
+package apitest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// loadDataTable reads the rows of a CSV or JSON data file. CSV files use the
+// first line as the column names, JSON files contain an array of objects.
+func loadDataTable(filePath string) ([]map[string]interface{}, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening data file: %w", err)
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".csv":
+		records, err := csv.NewReader(file).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("reading data file %s: %w", filePath, err)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("data file %s has no header row", filePath)
+		}
+
+		var rows []map[string]interface{}
+		for _, record := range records[1:] {
+			row := make(map[string]interface{})
+			for i, column := range records[0] {
+				if i < len(record) {
+					row[strings.TrimSpace(column)] = record[i]
+				}
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	case ".json":
+		var rows []map[string]interface{}
+		if err := json.NewDecoder(file).Decode(&rows); err != nil {
+			return nil, fmt.Errorf("decoding data file %s: %w", filePath, err)
+		}
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("data file %s must be a .csv or .json file", filePath)
+	}
+}
+
+// applyDataRow layers the values of a data row on top of the operation config.
+// Columns are mapped to parameters by name or by an "in." prefix (path.id,
+// query.limit, header.X-Id, cookie.session), to body fields by name or a
+// "body." prefix, and to nested body fields by a JSON pointer (/owner/id).
+// The expected_status and case_name columns set the expected status code and the
+// label shown in the results.
+func applyDataRow(base *OperationConfig, operation *Operation, row map[string]interface{}) (*OperationConfig, int, string) {
+	rowConfig := &OperationConfig{
+		Parameters: make(map[string]map[string]interface{}),
+		Body:       make(map[string]interface{}),
+		Patch:      append([]PatchOperation{}, base.Patch...),
+
+		ExpectCookies: base.ExpectCookies,
+		MaxLatency:    base.MaxLatency,
+		Scripts:       base.Scripts,
+	}
+	for in, params := range base.Parameters {
+		rowConfig.Parameters[in] = make(map[string]interface{})
+		for name, value := range params {
+			rowConfig.Parameters[in][name] = value
+		}
+	}
+	for name, value := range base.Body {
+		rowConfig.Body[name] = value
+	}
+
+	setParameter := func(in, name string, value interface{}) {
+		if rowConfig.Parameters[in] == nil {
+			rowConfig.Parameters[in] = make(map[string]interface{})
+		}
+		rowConfig.Parameters[in][name] = value
+	}
+
+	var expectedStatus int
+	var label string
+
+	for column, value := range row {
+		if cell, ok := value.(string); ok {
+			if cell == "" {
+				continue
+			}
+			value = parseCell(cell)
+		}
+
+		lower := strings.ToLower(column)
+		switch {
+		case lower == "expected_status" || lower == "expectedstatus":
+			expectedStatus, _ = strconv.Atoi(formatValue(value))
+		case lower == "case_name":
+			label = formatValue(value)
+		case strings.HasPrefix(column, "/"):
+			rowConfig.Patch = append(rowConfig.Patch, PatchOperation{Op: "add", Path: column, Value: value})
+		case strings.HasPrefix(lower, "body."):
+			rowConfig.Body[column[len("body."):]] = value
+		default:
+			if in, name, ok := strings.Cut(column, "."); ok && isParameterLocation(in) {
+				setParameter(strings.ToLower(in), name, value)
+				continue
+			}
+			if in, ok := parameterLocation(operation, column); ok {
+				setParameter(in, column, value)
+				continue
+			}
+			rowConfig.Body[column] = value
+		}
+	}
+
+	return rowConfig, expectedStatus, label
+}
+
+// parseCell turns CSV cells holding JSON objects or arrays into their decoded values
+func parseCell(cell string) interface{} {
+	trimmed := strings.TrimSpace(cell)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(trimmed), &decoded); err == nil {
+			return decoded
+		}
+	}
+	return cell
+}
+
+func isParameterLocation(in string) bool {
+	switch strings.ToLower(in) {
+	case "path", "query", "header", "cookie":
+		return true
+	}
+	return false
+}
+
+func parameterLocation(operation *Operation, name string) (string, bool) {
+	for _, param := range operation.Parameters {
+		paramName, _ := param["name"].(string)
+		if strings.EqualFold(paramName, name) {
+			in, ok := param["in"].(string)
+			return in, ok
+		}
+	}
+	return "", false
+}
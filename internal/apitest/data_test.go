@@ -0,0 +1,157 @@
+package apitest
+
+import (
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadDataTable(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"rows.csv":  "name, limit,tags\nRex,10,\"[\"\"a\"\"]\"\nMax,,\n",
+		"rows.json": `[{"name": "Rex", "limit": 10}, {"name": "Max"}]`,
+		"empty.csv": "",
+		"bad.json":  `{"name": "Rex"}`,
+		"rows.txt":  "name\nRex\n",
+	})
+
+	rows, err := loadDataTable(filepath.Join(dir, "rows.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{{"name": "Rex", "limit": "10", "tags": `["a"]`}, {"name": "Max", "limit": "", "tags": ""}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("CSV rows = %v, want %v", rows, want)
+	}
+
+	rows, err = loadDataTable(filepath.Join(dir, "rows.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []map[string]interface{}{{"name": "Rex", "limit": 10.0}, {"name": "Max"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("JSON rows = %v, want %v", rows, want)
+	}
+
+	failures := map[string]string{
+		"empty.csv":   "has no header row",
+		"bad.json":    "decoding data file",
+		"rows.txt":    "must be a .csv or .json file",
+		"missing.csv": "opening data file",
+	}
+	for name, want := range failures {
+		if _, err := loadDataTable(filepath.Join(dir, name)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadDataTable(%s) error = %v, want %q", name, err, want)
+		}
+	}
+}
+
+func TestApplyDataRow(t *testing.T) {
+	operation := &Operation{Parameters: []map[string]interface{}{
+		{"name": "orderId", "in": "path"},
+		{"name": "X-Tenant", "in": "header"},
+	}}
+	base := &OperationConfig{
+		Parameters:    map[string]map[string]interface{}{"query": {"limit": 10}},
+		Body:          map[string]interface{}{"currency": "EUR"},
+		Patch:         []PatchOperation{{Path: "/note", Value: "base"}},
+		ExpectCookies: []string{"session"},
+		MaxLatency:    "200ms",
+	}
+	row := map[string]interface{}{
+		"case_name":       "missing zip",
+		"expected_status": "400",
+		"orderid":         "1001",
+		"x-tenant":        "acme",
+		"query.limit":     "5",
+		"cookie.session":  "s-1",
+		"body.quantity":   "2",
+		"customerId":      "c-1",
+		"items":           `[{"sku": "A"}]`,
+		"/shipping/zip":   "",
+		"/shipping/city":  "Paris",
+	}
+
+	rowConfig, expectedStatus, label := applyDataRow(base, operation, row)
+	if expectedStatus != 400 || label != "missing zip" {
+		t.Errorf("expected status and label = %d, %q", expectedStatus, label)
+	}
+	wantParameters := map[string]map[string]interface{}{
+		"path":   {"orderid": "1001"},
+		"header": {"x-tenant": "acme"},
+		"query":  {"limit": "5"},
+		"cookie": {"session": "s-1"},
+	}
+	if !reflect.DeepEqual(rowConfig.Parameters, wantParameters) {
+		t.Errorf("parameters = %v, want %v", rowConfig.Parameters, wantParameters)
+	}
+	wantBody := map[string]interface{}{
+		"currency":   "EUR",
+		"quantity":   "2",
+		"customerId": "c-1",
+		"items":      []interface{}{map[string]interface{}{"sku": "A"}},
+	}
+	if !reflect.DeepEqual(rowConfig.Body, wantBody) {
+		t.Errorf("body = %v, want %v", rowConfig.Body, wantBody)
+	}
+	wantPatch := []PatchOperation{{Path: "/note", Value: "base"}, {Op: "add", Path: "/shipping/city", Value: "Paris"}}
+	if !reflect.DeepEqual(rowConfig.Patch, wantPatch) {
+		t.Errorf("patch = %v, want %v without the empty cell", rowConfig.Patch, wantPatch)
+	}
+	if rowConfig.MaxLatency != "200ms" || !reflect.DeepEqual(rowConfig.ExpectCookies, base.ExpectCookies) {
+		t.Errorf("row config = %+v, want the latency and cookies of the operation", rowConfig)
+	}
+
+	if base.Parameters["query"]["limit"] != 10 || len(base.Body) != 1 || len(base.Patch) != 1 {
+		t.Errorf("the operation config was changed: %+v", base)
+	}
+}
+
+func TestDataDrivenRun(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"valida.yaml": `operations:
+  createOrder:
+    body:
+      customerId: c-0
+    data: orders.csv
+`,
+		"orders.csv": `case_name,customerId,/shippingAddress/zipCode,expected_status
+valid,c-1,12345,201
+rejected,c-2,,400
+,c-3,99999,
+`,
+	})
+	server, bodies := captureService(t, http.StatusCreated)
+
+	rows := runTestConfig(t, ordersSpec, server, filepath.Join(dir, "valida.yaml"))
+
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want one per data row", len(rows))
+	}
+	results := make(map[string]TableRow)
+	for _, row := range rows {
+		label := row.Endpoint[strings.LastIndex(row.Endpoint, "[")+1 : len(row.Endpoint)-1]
+		results[label] = row
+	}
+	if results["valid"].Failed() || results["row 3"].Failed() {
+		t.Errorf("rows = %+v, want the valid and unlabelled rows to pass", rows)
+	}
+	if !results["rejected"].Failed() {
+		t.Errorf("rejected row = %+v, want a failure for the unexpected 201", results["rejected"])
+	}
+
+	customers := make(map[interface{}]interface{})
+	for _, body := range bodies() {
+		customers[body["customerId"]] = body["shippingAddress"]
+	}
+	if len(customers) != 3 || customers["c-2"] == nil {
+		t.Errorf("customers = %v, want one request per data row", customers)
+	}
+	for customer, zipCode := range map[string]string{"c-1": "12345", "c-3": "99999"} {
+		if want := map[string]interface{}{"zipCode": zipCode}; !reflect.DeepEqual(customers[customer], want) {
+			t.Errorf("shipping address of %s = %v, want %v", customer, customers[customer], want)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package apitest
 
 import (
 	"fmt"
+	"net/http"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -43,6 +45,14 @@ type TableRow struct {
 	Method    string
 	Response  string
 	Assertion string
+	Command   string
+	Operation string
+	Timing    *RequestTiming
+}
+
+// Failed reports whether the request broke the contract or missed its SLA
+func (row TableRow) Failed() bool {
+	return strings.HasPrefix(row.Assertion, "FAIL")
 }
 
 func DisplayTable(rows []TableRow) {
@@ -58,6 +68,7 @@ func DisplayTable(rows []TableRow) {
 		maxEndpoint  = 60
 		maxMethod    = 15
 		maxResponse  = 30
+		maxLatency   = 12
 		maxAssertion = 40
 	)
 
@@ -72,6 +83,8 @@ func DisplayTable(rows []TableRow) {
 		borderStyle.Render("│"),
 		headerStyle.Width(maxResponse).Render("Response"),
 		borderStyle.Render("│"),
+		headerStyle.Width(maxLatency).Render("Latency"),
+		borderStyle.Render("│"),
 		headerStyle.Width(maxAssertion).Render("Assertion"),
 	)
 
@@ -84,6 +97,8 @@ func DisplayTable(rows []TableRow) {
 			borderStyle.Render("│"),
 			cellStyle.Width(maxResponse).Render(truncate(row.Response, maxResponse)),
 			borderStyle.Render("│"),
+			cellStyle.Width(maxLatency).Render(rowLatency(row)),
+			borderStyle.Render("│"),
 			renderMultilineAssertion(row.Assertion, maxAssertion),
 		)
 		renderedRows = append(renderedRows, renderedRow)
@@ -95,10 +110,67 @@ func DisplayTable(rows []TableRow) {
 	)
 
 	totalEndpoints := fmt.Sprintf("Total Endpoints Tested: %d", len(rows))
+	retried := 0
+	var throttled time.Duration
+	for _, row := range rows {
+		if row.Timing != nil && row.Timing.Attempts > 1 {
+			retried++
+		}
+		if row.Timing != nil {
+			throttled += row.Timing.Throttle
+		}
+	}
+	if retried > 0 {
+		totalEndpoints += fmt.Sprintf(" | Retried: %d", retried)
+	}
+	if throttled > 0 {
+		totalEndpoints += fmt.Sprintf(" | Throttled: %s", formatDuration(throttled))
+	}
 	renderedTotal := totalStyle.Render(totalEndpoints)
 
 	fmt.Println(table.Render(renderedTable))
 	fmt.Println(renderedTotal)
+
+	displayFailedCommands(rows)
+	displayLatencySummary(rows)
+}
+
+// responseSummary describes the response status, with the number of attempts when the request was retried
+func responseSummary(resp *http.Response, timing *RequestTiming) string {
+	summary := "No response"
+	if resp != nil {
+		summary = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	if timing != nil && timing.Attempts > 1 {
+		summary += fmt.Sprintf(" (%d attempts)", timing.Attempts)
+	}
+	return summary
+}
+
+func rowLatency(row TableRow) string {
+	if row.Timing == nil || row.Timing.Total == 0 {
+		return "-"
+	}
+	return formatDuration(row.Timing.Total)
+}
+
+// displayFailedCommands prints a ready-to-run command for every failed row
+func displayFailedCommands(rows []TableRow) {
+	var failed []TableRow
+	for _, row := range rows {
+		if strings.HasPrefix(row.Assertion, "FAIL") && row.Command != "" {
+			failed = append(failed, row)
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(errorStyle.Render("Reproduce failed requests:"))
+	for _, row := range failed {
+		fmt.Printf("\n# %s %s\n%s\n", row.Method, row.Endpoint, row.Command)
+	}
 }
 
 func renderMultilineAssertion(assertion string, width int) string {
@@ -0,0 +1,373 @@
+package apitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maskedValue = "****"
+
+// redactor masks credentials in the log, reproduce commands and HAR
+// archives, and the values of the configured fields in logged bodies
+type redactor struct {
+	showSecrets bool
+	fields      []string
+}
+
+func parseCommandFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", "curl":
+		return "curl", nil
+	case "httpie":
+		return "httpie", nil
+	}
+	return "", fmt.Errorf("unknown command format %q, expected curl or httpie", format)
+}
+
+// harArchive represents a HAR 1.2 archive of the requests sent during a run
+type harArchive struct {
+	mu  sync.Mutex
+	Log struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harNameVal `json:"cookies"`
+	Headers     []harNameVal `json:"headers"`
+	QueryString []harNameVal `json:"queryString"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int          `json:"status"`
+	StatusText  string       `json:"statusText"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harNameVal `json:"cookies"`
+	Headers     []harNameVal `json:"headers"`
+	Content     harContent   `json:"content"`
+	RedirectURL string       `json:"redirectURL"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func newHARArchive(creatorVersion string) *harArchive {
+	archive := &harArchive{}
+	archive.Log.Version = "1.2"
+	archive.Log.Creator = harCreator{Name: "valida", Version: creatorVersion}
+	archive.Log.Entries = []harEntry{}
+	return archive
+}
+
+// write writes the recorded requests and responses to a HAR 1.2 file
+func (h *harArchive) write(filePath string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding HAR archive: %w", err)
+	}
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		return fmt.Errorf("writing HAR archive: %w", err)
+	}
+	return nil
+}
+
+// record adds a request and its response to the archive, masking their
+// credentials and the redacted fields of their bodies like the log does
+func (h *harArchive) record(redact *redactor, req *http.Request, resp *http.Response, responseBody string, timing *RequestTiming) {
+	requestBody := requestBodyText(req)
+	entry := harEntry{
+		StartedDateTime: timing.Start.Format(time.RFC3339Nano),
+		Time:            harMillis(timing.Total),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         redact.maskURL(req.URL),
+			HTTPVersion: req.Proto,
+			Cookies:     redact.harCookies(req.Cookies()),
+			Headers:     redact.harHeaders(req.Header),
+			QueryString: redact.harQuery(req.URL.Query()),
+			HeadersSize: -1,
+			BodySize:    len(requestBody),
+		},
+		Response: harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Cookies:     redact.harCookies(resp.Cookies()),
+			Headers:     redact.harHeaders(resp.Header),
+			Content: harContent{
+				Size:     len(responseBody),
+				MimeType: resp.Header.Get("Content-Type"),
+				Text:     string(redact.redactBody(resp.Header.Get("Content-Type"), responseBody)),
+			},
+			HeadersSize: -1,
+			BodySize:    len(responseBody),
+		},
+		Timings: harTimings{
+			Blocked: harBlocked(timing.Throttle),
+			DNS:     harPhase(timing.DNS),
+			Connect: harPhase(timing.Connect + timing.TLS),
+			SSL:     harPhase(timing.TLS),
+			Send:    0,
+			Wait:    harMillis(timing.wait()),
+			Receive: harMillis(timing.Total - timing.TTFB),
+		},
+	}
+	if requestBody != "" {
+		entry.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: string(redact.redactBody(req.Header.Get("Content-Type"), requestBody))}
+	}
+
+	h.mu.Lock()
+	h.Log.Entries = append(h.Log.Entries, entry)
+	h.mu.Unlock()
+}
+
+func harMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// harBlocked returns the time the request was queued by the rate limiter, or -1 when it was not
+func harBlocked(d time.Duration) float64 {
+	if d == 0 {
+		return -1
+	}
+	return harMillis(d)
+}
+
+// harPhase returns the duration of a connection phase, or -1 when it did not
+// happen because the connection was reused
+func harPhase(d time.Duration) float64 {
+	if d == 0 {
+		return -1
+	}
+	return harMillis(d)
+}
+
+func (m *redactor) harHeaders(header http.Header) []harNameVal {
+	values := []harNameVal{}
+	for _, name := range sortedHeaderNames(header) {
+		for _, value := range header[name] {
+			values = append(values, harNameVal{Name: name, Value: m.maskHeader(name, value)})
+		}
+	}
+	return values
+}
+
+func (m *redactor) harQuery(query url.Values) []harNameVal {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := []harNameVal{}
+	for _, name := range names {
+		for _, value := range query[name] {
+			if isSecretName(name) && !m.showSecrets {
+				value = maskedValue
+			}
+			values = append(values, harNameVal{Name: name, Value: value})
+		}
+	}
+	return values
+}
+
+func (m *redactor) harCookies(cookies []*http.Cookie) []harNameVal {
+	values := []harNameVal{}
+	for _, cookie := range cookies {
+		value := cookie.Value
+		if !m.showSecrets {
+			value = maskedValue
+		}
+		values = append(values, harNameVal{Name: cookie.Name, Value: value})
+	}
+	return values
+}
+
+// curlCommand returns a curl command line that sends the same request, with
+// the credentials and redacted body fields masked
+func (m *redactor) curlCommand(req *http.Request, body string) string {
+	body = string(m.redactBody(req.Header.Get("Content-Type"), body))
+	parts := []string{"curl", "-X", req.Method, shellQuote(m.maskURL(req.URL))}
+	for _, name := range sortedHeaderNames(req.Header) {
+		for _, value := range req.Header[name] {
+			parts = append(parts, "-H", shellQuote(name+": "+m.maskHeader(name, value)))
+		}
+	}
+	if body != "" {
+		parts = append(parts, "--data-raw", shellQuote(body))
+	}
+	return strings.Join(parts, " ")
+}
+
+// httpieCommand returns an HTTPie command line that sends the same request,
+// with the credentials and redacted body fields masked
+func (m *redactor) httpieCommand(req *http.Request, body string) string {
+	body = string(m.redactBody(req.Header.Get("Content-Type"), body))
+	parts := []string{"http"}
+	if body != "" {
+		parts = append(parts, "--raw", shellQuote(body))
+	}
+	parts = append(parts, req.Method, shellQuote(m.maskURL(req.URL)))
+	for _, name := range sortedHeaderNames(req.Header) {
+		for _, value := range req.Header[name] {
+			parts = append(parts, shellQuote(name+":"+m.maskHeader(name, value)))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// reproduceCommand returns the command of the selected format for a request
+func (r *Runner) reproduceCommand(req *http.Request, body string) string {
+	if r.commandFormat == "httpie" {
+		return r.redact.httpieCommand(req, body)
+	}
+	return r.redact.curlCommand(req, body)
+}
+
+// requestBodyText reads the body of a request without consuming it
+func requestBodyText(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// isSecretName reports whether a header, query parameter or cookie name
+// usually carries credentials
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie", "key":
+		return true
+	}
+	for _, marker := range []string{"token", "secret", "password", "apikey", "api-key", "api_key", "session"} {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskHeader hides the credentials of a header value, keeping the
+// authorization scheme and cookie names so the command stays readable
+func (m *redactor) maskHeader(name, value string) string {
+	if m.showSecrets || !isSecretName(name) {
+		return value
+	}
+
+	switch strings.ToLower(name) {
+	case "authorization", "proxy-authorization":
+		if scheme, _, ok := strings.Cut(value, " "); ok {
+			return scheme + " " + maskedValue
+		}
+	case "cookie":
+		var cookies []string
+		for _, cookie := range strings.Split(value, ";") {
+			cookieName, _, _ := strings.Cut(strings.TrimSpace(cookie), "=")
+			cookies = append(cookies, cookieName+"="+maskedValue)
+		}
+		return strings.Join(cookies, "; ")
+	}
+	return maskedValue
+}
+
+// maskURL hides credentials passed in the query string or the user info of a URL
+func (m *redactor) maskURL(u *url.URL) string {
+	if m.showSecrets {
+		return u.String()
+	}
+
+	masked := *u
+	if masked.User != nil {
+		masked.User = url.User(masked.User.Username())
+	}
+	if masked.RawQuery != "" {
+		var pairs []string
+		for _, pair := range strings.Split(masked.RawQuery, "&") {
+			name, _, hasValue := strings.Cut(pair, "=")
+			decodedName, err := url.QueryUnescape(name)
+			if err == nil && hasValue && isSecretName(decodedName) {
+				pair = name + "=" + maskedValue
+			}
+			pairs = append(pairs, pair)
+		}
+		masked.RawQuery = strings.Join(pairs, "&")
+	}
+	return masked.String()
+}
+
+func sortedHeaderNames(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// shellQuote quotes a value for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,121 @@
+package apitest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHARRedactsBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token": "abc", "user": {"pin": "1234"}}`))
+	}))
+	defer server.Close()
+
+	runner, err := NewRunner(RunnerOptions{RecordHAR: true, Log: LogOptions{File: "none", Redact: []string{"pin"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	body := `{"username": "rex", "password": "hunter2"}`
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/login", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, responseBody, timing, err := runner.sendWithRetry(context.Background(), runner.logger, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.har.record(runner.redact, req, resp, string(responseBody), timing)
+
+	harFile := filepath.Join(t.TempDir(), "run.har")
+	if err := runner.WriteHAR(harFile); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(harFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "abc", "1234"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("the HAR archive contains %q:\n%s", secret, data)
+		}
+	}
+
+	var archive harArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		t.Fatal(err)
+	}
+	entry := archive.Log.Entries[0]
+	if !strings.Contains(entry.Request.PostData.Text, `"username":"rex"`) || entry.Request.BodySize != len(body) {
+		t.Errorf("request body = %s (%d bytes), want the other fields kept and the original size", entry.Request.PostData.Text, entry.Request.BodySize)
+	}
+}
+
+func TestReproduceCommandIncludesJarCookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t", Path: "/"})
+		}
+	}))
+	defer server.Close()
+
+	for _, format := range []string{"curl", "httpie"} {
+		t.Run(format, func(t *testing.T) {
+			runner, err := NewRunner(RunnerOptions{CookieJar: true, ShowSecrets: true, CommandFormat: format, Log: LogOptions{File: "none"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer runner.Close()
+
+			for _, path := range []string{"/login", "/pets"} {
+				req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, _, _, err := runner.sendWithRetry(context.Background(), runner.logger, req); err != nil {
+					t.Fatal(err)
+				}
+				command := runner.reproduceCommand(req, "")
+				if sent := strings.Contains(command, "session=s3cr3t"); sent != (path == "/pets") {
+					t.Errorf("%s: command %s, want the session cookie only once it was set", path, command)
+				}
+			}
+		})
+	}
+}
+
+func TestReproduceCommandRedactsBody(t *testing.T) {
+	body := `{"username": "rex", "password": "hunter2", "pin": "1234"}`
+	for _, format := range []string{"curl", "httpie"} {
+		for _, showSecrets := range []bool{false, true} {
+			runner, err := NewRunner(RunnerOptions{ShowSecrets: showSecrets, CommandFormat: format, Log: LogOptions{File: "none", Redact: []string{"pin"}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer runner.Close()
+
+			req, err := http.NewRequest(http.MethodPost, "http://api.valida.test/login", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			command := runner.reproduceCommand(req, body)
+			for _, secret := range []string{"hunter2", "1234"} {
+				if strings.Contains(command, secret) != showSecrets {
+					t.Errorf("%s with showSecrets=%t: command %s", format, showSecrets, command)
+				}
+			}
+			if !strings.Contains(command, "rex") {
+				t.Errorf("%s: command %s, want the other fields kept", format, command)
+			}
+		}
+	}
+}
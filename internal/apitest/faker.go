@@ -1,25 +1,183 @@
 package apitest
 
 import (
+	"fmt"
 	"github.com/brianvoe/gofakeit/v7"
-	"math/rand"
+	"math"
 	"time"
 )
 
-var seededRand *rand.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+func fakeString(fake *gofakeit.Faker) string {
+	return fake.Word()
+}
+
+func fakeInt(fake *gofakeit.Faker) int {
+	return fake.Number(1, 99999)
+}
+
+func fakeEmail(fake *gofakeit.Faker) string {
+	return fake.Email()
+}
+
+func randInt(fake *gofakeit.Faker, min int, max int) int {
+	return fake.IntRange(min, max)
+}
+
+// fakeSchemaValue generates a value of any type that satisfies the given schema
+func fakeSchemaValue(fake *gofakeit.Faker, schema map[string]interface{}) interface{} {
+	if value, ok := schema["const"]; ok {
+		return value
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[fake.IntN(len(enum))]
+	}
+	if examples, ok := schema["examples"].([]interface{}); ok && len(examples) > 0 {
+		return examples[fake.IntN(len(examples))]
+	}
+
+	switch primaryType(schema) {
+	case "string":
+		switch schema["format"] {
+		case "email":
+			return fakeEmail(fake)
+		case "uuid":
+			return fake.UUID()
+		case "date":
+			return fake.Date().Format("2006-01-02")
+		case "date-time":
+			return fake.Date().Format(time.RFC3339)
+		case "uri", "url":
+			return fake.URL()
+		}
+		return fakeString(fake)
+	case "integer":
+		min, max := 1, 99999
+		lower, lowerExclusive, hasLower := lowerBound(schema)
+		upper, upperExclusive, hasUpper := upperBound(schema)
+		if hasLower {
+			min = int(math.Ceil(lower))
+			if lowerExclusive && float64(min) == lower {
+				min++
+			}
+		}
+		if hasUpper {
+			max = int(math.Floor(upper))
+			if upperExclusive && float64(max) == upper {
+				max--
+			}
+			if !hasLower && max < min {
+				min = max
+			}
+		}
+		if max < min {
+			max = min
+		}
+		return randInt(fake, min, max)
+	case "number":
+		lower, lowerExclusive, hasLower := lowerBound(schema)
+		upper, upperExclusive, hasUpper := upperBound(schema)
+		switch {
+		case hasLower && !hasUpper:
+			upper = lower + 1000
+		case hasUpper && !hasLower:
+			lower = upper - 1000
+		case !hasLower && !hasUpper:
+			lower, upper = 0.01, 999.99
+		}
+		if upper <= lower {
+			return lower
+		}
+		value := math.Round((lower+fake.Float64()*(upper-lower))*100) / 100
+		if value < lower || value > upper || (lowerExclusive && value == lower) || (upperExclusive && value == upper) {
+			value = (lower + upper) / 2
+		}
+		return value
+	case "boolean":
+		return fake.Bool()
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		if prefixItems, ok := schema["prefixItems"].([]interface{}); ok {
+			values := make([]interface{}, 0, len(prefixItems))
+			for _, prefixItem := range prefixItems {
+				prefixSchema, _ := prefixItem.(map[string]interface{})
+				values = append(values, fakeSchemaValue(fake, prefixSchema))
+			}
+			return values
+		}
+		count := randInt(fake, 1, 3)
+		if v, ok := numberValue(schema["minItems"]); ok && int(v) > count {
+			count = int(v)
+		}
+		if v, ok := numberValue(schema["maxItems"]); ok && int(v) < count {
+			count = int(v)
+		}
+		values := make([]interface{}, count)
+		for i := range values {
+			values[i] = fakeSchemaValue(fake, items)
+		}
+		return values
+	case "object":
+		object := make(map[string]interface{})
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, property := range properties {
+			if propertySchema, ok := property.(map[string]interface{}); ok {
+				object[name] = fakeSchemaValue(fake, propertySchema)
+			}
+		}
+		return object
+	default:
+		return fakeString(fake)
+	}
+}
 
-func FakeString() string {
-	return gofakeit.Word()
+// lowerBound returns the lower bound of a numeric schema and whether it is
+// excluded, reading both the boolean exclusiveMinimum of OpenAPI 3.0 and the
+// numeric one of JSON Schema 2020-12
+func lowerBound(schema map[string]interface{}) (float64, bool, bool) {
+	bound, hasBound := numberValue(schema["minimum"])
+	exclusive, _ := schema["exclusiveMinimum"].(bool)
+	if v, ok := numberValue(schema["exclusiveMinimum"]); ok && (!hasBound || v >= bound) {
+		return v, true, true
+	}
+	return bound, exclusive, hasBound
 }
 
-func FakeInt() int {
-	return gofakeit.Number(1, 99999)
+// upperBound returns the upper bound of a numeric schema like lowerBound
+func upperBound(schema map[string]interface{}) (float64, bool, bool) {
+	bound, hasBound := numberValue(schema["maximum"])
+	exclusive, _ := schema["exclusiveMaximum"].(bool)
+	if v, ok := numberValue(schema["exclusiveMaximum"]); ok && (!hasBound || v <= bound) {
+		return v, true, true
+	}
+	return bound, exclusive, hasBound
 }
 
-func FakeEmail() string {
-	return gofakeit.Email()
+// numberValue reads a numeric schema keyword, which is decoded as an int from
+// YAML and as a float64 from JSON
+func numberValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
 }
 
-func randInt(min int, max int) int {
-	return seededRand.Intn(max-min+1) + min
+// primaryType returns the type used to generate a value, skipping "null" in
+// the type arrays of OpenAPI 3.1
+func primaryType(schema map[string]interface{}) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, item := range t {
+			if item != "null" {
+				return fmt.Sprint(item)
+			}
+		}
+	}
+	return ""
 }
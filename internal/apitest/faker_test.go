@@ -0,0 +1,35 @@
+package apitest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+func TestFakeSchemaValueBounds(t *testing.T) {
+	schemas := []string{
+		`{"type": "integer", "minimum": 5, "maximum": 6, "exclusiveMinimum": true}`,
+		`{"type": "integer", "minimum": 5, "maximum": 6, "exclusiveMaximum": true}`,
+		`{"type": "integer", "exclusiveMinimum": 5, "exclusiveMaximum": 7}`,
+		`{"type": "integer", "maximum": -10}`,
+		`{"type": "integer", "minimum": 1.5, "maximum": 2.5}`,
+		`{"type": "number", "minimum": 0, "maximum": 0.02, "exclusiveMinimum": true, "exclusiveMaximum": true}`,
+		`{"type": "number", "exclusiveMinimum": 100}`,
+		`{"type": "number", "maximum": -5}`,
+	}
+	fake := gofakeit.New(1)
+	for _, schema := range schemas {
+		t.Run(schema, func(t *testing.T) {
+			for i := 0; i < 200; i++ {
+				value := fakeSchemaValue(fake, decode(t, schema))
+				if n, ok := value.(int); ok {
+					value = float64(n)
+				}
+				if problems := validateSchema(nil, decode(t, schema), value, "value"); len(problems) > 0 {
+					t.Fatalf("generated %v: %s", value, strings.Join(problems, "; "))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package apitest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+)
+
+// handlerTransport serves requests with an http.Handler in the same process,
+// without opening a listener
+type handlerTransport struct {
+	handler http.Handler
+}
+
+// HandlerTransport returns a transport passing every request straight to the handler
+func HandlerTransport(handler http.Handler) http.RoundTripper {
+	return &handlerTransport{handler: handler}
+}
+
+func (t *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the handler sees the request as a server would
+	serverReq := req.Clone(req.Context())
+	serverReq.RequestURI = req.URL.RequestURI()
+	serverReq.RemoteAddr = "127.0.0.1:0"
+	if serverReq.Host == "" {
+		serverReq.Host = req.URL.Host
+	}
+	if serverReq.Body == nil {
+		serverReq.Body = http.NoBody
+	}
+
+	recorder := httptest.NewRecorder()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("handler panicked: %v", r)
+			}
+		}()
+		t.handler.ServeHTTP(recorder, serverReq)
+		done <- nil
+	}()
+
+	select {
+	case <-req.Context().Done():
+		// a handler ignoring the context keeps running until it returns, but
+		// the recorder it writes to is never read
+		return nil, req.Context().Err()
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
@@ -0,0 +1,89 @@
+package apitest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerTransport(t *testing.T) {
+	transport := HandlerTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Seen", r.Method+" "+r.Host+" "+r.RequestURI+" "+string(body))
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created")
+	}))
+
+	req, _ := http.NewRequest(http.MethodPost, "http://api.valida.test/pets?limit=5", strings.NewReader(`{"name":"Rex"}`))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusCreated || string(body) != "created" || resp.Request != req {
+		t.Errorf("RoundTrip() = %d %q, want 201 \"created\" for the request", resp.StatusCode, body)
+	}
+	if want := `POST api.valida.test /pets?limit=5 {"name":"Rex"}`; resp.Header.Get("X-Seen") != want {
+		t.Errorf("the handler saw %q, want %q", resp.Header.Get("X-Seen"), want)
+	}
+}
+
+func TestHandlerTransportPanic(t *testing.T) {
+	transport := HandlerTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	req, _ := http.NewRequest(http.MethodGet, "http://api.valida.test/pets", nil)
+	if _, err := transport.RoundTrip(req); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("RoundTrip() error = %v, want the panic", err)
+	}
+}
+
+func TestHandlerTransportCancel(t *testing.T) {
+	transport := HandlerTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		// writes after the cancellation must not race with the transport
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(w, "too late")
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://api.valida.test/pets", nil)
+	if _, err := transport.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RoundTrip() error = %v, want context.DeadlineExceeded", err)
+	}
+	// let the handler write to the recorder after RoundTrip returned
+	time.Sleep(20 * time.Millisecond)
+}
+
+func TestHandlerTransportIgnoredContext(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	transport := HandlerTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://api.valida.test/pets", nil)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := transport.RoundTrip(req)
+		errs <- err
+	}()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("RoundTrip() error = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RoundTrip() hung on a handler that never returns")
+	}
+}
@@ -0,0 +1,370 @@
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"plugin"
+	"strings"
+)
+
+// Hook stages, as named in the config file and the messages of command hooks
+const (
+	StageBeforeRequest = "beforeRequest"
+	StageAfterResponse = "afterResponse"
+	StageAssert        = "assert"
+	StageOnResult      = "onResult"
+)
+
+// Exchange represents a request of a run and, once received, its response.
+// Hooks change the request body through RequestBody and the response body
+// through ResponseBody rather than the Body of the messages.
+type Exchange struct {
+	// Operation is the operationId or "METHOD /path" of the request, empty
+	// when it matches no documented operation
+	Operation    string
+	Request      *http.Request
+	RequestBody  []byte
+	Response     *http.Response
+	ResponseBody []byte
+
+	scripts []*Scripts
+	timing  *RequestTiming
+	log     *Logger
+}
+
+// Hook represents code run around every request of a runner, such as signing
+// requests, decrypting responses or domain-specific checks. Embed NopHook to
+// implement only some of the methods.
+type Hook interface {
+	// BeforeRequest may change the request before it is logged and sent
+	BeforeRequest(ctx context.Context, ex *Exchange) error
+	// AfterResponse may change the response before it is validated
+	AfterResponse(ctx context.Context, ex *Exchange) error
+	// Assert fails the request with the returned error
+	Assert(ctx context.Context, ex *Exchange) error
+	// OnResult receives the result of every completed request
+	OnResult(ctx context.Context, result TableRow)
+}
+
+// NopHook implements every method of Hook by doing nothing
+type NopHook struct{}
+
+func (NopHook) BeforeRequest(ctx context.Context, ex *Exchange) error { return nil }
+func (NopHook) AfterResponse(ctx context.Context, ex *Exchange) error { return nil }
+func (NopHook) Assert(ctx context.Context, ex *Exchange) error        { return nil }
+func (NopHook) OnResult(ctx context.Context, result TableRow)         {}
+
+// HookConfig represents a hook of the config file: a command run by the shell
+// or a WebAssembly module for the given stages, all of them by default, or a
+// Go plugin
+type HookConfig struct {
+	Command string   `mapstructure:"command"`
+	Wasm    string   `mapstructure:"wasm"`
+	Stages  []string `mapstructure:"stages"`
+	Plugin  string   `mapstructure:"plugin"`
+}
+
+// newHook creates the hook described by the config file
+func newHook(hookConfig HookConfig) (Hook, error) {
+	kinds := 0
+	for _, value := range []string{hookConfig.Command, hookConfig.Wasm, hookConfig.Plugin} {
+		if value != "" {
+			kinds++
+		}
+	}
+	switch {
+	case kinds > 1:
+		return nil, errors.New("a hook has only one of a command, a wasm module or a plugin")
+	case hookConfig.Plugin != "":
+		return LoadHookPlugin(hookConfig.Plugin)
+	case hookConfig.Wasm != "":
+		return NewWasmHook(hookConfig.Wasm, hookConfig.Stages...)
+	case hookConfig.Command != "":
+		return NewCommandHook(hookConfig.Command, hookConfig.Stages...)
+	}
+	return nil, errors.New("a hook needs a command, a wasm module or a plugin")
+}
+
+// LoadHookPlugin opens a Go plugin exporting a Hook variable
+func LoadHookPlugin(path string) (Hook, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening hook plugin: %w", err)
+	}
+	symbol, err := p.Lookup("Hook")
+	if err != nil {
+		return nil, fmt.Errorf("hook plugin %s: %w", path, err)
+	}
+	hook, ok := symbol.(Hook)
+	if !ok {
+		return nil, fmt.Errorf("hook plugin %s: Hook is a %T, which does not implement the hook methods", path, symbol)
+	}
+	return hook, nil
+}
+
+// commandHook runs a command for every request. It receives a hookMessage as
+// JSON on stdin and may answer with a changed message on stdout. The command
+// is a shell command or a WebAssembly module, as run by run.
+type commandHook struct {
+	command string
+	stages  map[string]bool
+	run     func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// hookMessage represents the JSON exchanged with a command hook. The Error
+// of the reply to an assert message fails the request.
+type hookMessage struct {
+	Stage     string        `json:"stage"`
+	Operation string        `json:"operation,omitempty"`
+	Request   *hookRequest  `json:"request,omitempty"`
+	Response  *hookResponse `json:"response,omitempty"`
+	Result    *hookResult   `json:"result,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// hookRequest and hookResponse leave out an empty body. A reply without a body
+// keeps the current one, while an empty string clears it.
+type hookRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
+	Body    *string     `json:"body,omitempty"`
+}
+
+type hookResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers"`
+	Body    *string     `json:"body,omitempty"`
+}
+
+type hookResult struct {
+	Endpoint  string `json:"endpoint"`
+	Method    string `json:"method"`
+	Operation string `json:"operation,omitempty"`
+	Response  string `json:"response"`
+	Assertion string `json:"assertion"`
+	Failed    bool   `json:"failed"`
+}
+
+// NewCommandHook returns a hook running a shell command at the given stages,
+// or at all of them when none is given
+func NewCommandHook(command string, stages ...string) (Hook, error) {
+	return newCommandHook(command, stages, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdin = stdin
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		return cmd.Run()
+	})
+}
+
+func newCommandHook(command string, stages []string, run func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error) (*commandHook, error) {
+	h := &commandHook{command: command, stages: make(map[string]bool), run: run}
+	for _, stage := range stages {
+		switch stage {
+		case StageBeforeRequest, StageAfterResponse, StageAssert, StageOnResult:
+			h.stages[stage] = true
+		default:
+			return nil, fmt.Errorf("unknown hook stage %q, expected %s, %s, %s or %s", stage, StageBeforeRequest, StageAfterResponse, StageAssert, StageOnResult)
+		}
+	}
+	return h, nil
+}
+
+func (h *commandHook) runs(stage string) bool {
+	return len(h.stages) == 0 || h.stages[stage]
+}
+
+func (h *commandHook) BeforeRequest(ctx context.Context, ex *Exchange) error {
+	if !h.runs(StageBeforeRequest) {
+		return nil
+	}
+	reply, err := h.call(ctx, &hookMessage{Stage: StageBeforeRequest, Operation: ex.Operation, Request: exchangeRequest(ex)})
+	if err != nil || reply == nil || reply.Request == nil {
+		return err
+	}
+
+	changed := reply.Request
+	if changed.Method != "" {
+		ex.Request.Method = strings.ToUpper(changed.Method)
+	}
+	if changed.URL != "" {
+		u, err := url.Parse(changed.URL)
+		if err != nil {
+			return fmt.Errorf("hook %q returned an invalid URL: %w", h.command, err)
+		}
+		ex.Request.URL = u
+		ex.Request.Host = ""
+	}
+	if changed.Headers != nil {
+		ex.Request.Header = changed.Headers
+	}
+	if changed.Body != nil {
+		ex.RequestBody = []byte(*changed.Body)
+	}
+	return nil
+}
+
+func (h *commandHook) AfterResponse(ctx context.Context, ex *Exchange) error {
+	if !h.runs(StageAfterResponse) {
+		return nil
+	}
+	reply, err := h.call(ctx, &hookMessage{Stage: StageAfterResponse, Operation: ex.Operation, Request: exchangeRequest(ex), Response: exchangeResponse(ex)})
+	if err != nil || reply == nil || reply.Response == nil {
+		return err
+	}
+
+	changed := reply.Response
+	if changed.Status != 0 {
+		ex.Response.StatusCode = changed.Status
+		ex.Response.Status = fmt.Sprintf("%d %s", changed.Status, http.StatusText(changed.Status))
+	}
+	if changed.Headers != nil {
+		ex.Response.Header = changed.Headers
+	}
+	if changed.Body != nil {
+		ex.ResponseBody = []byte(*changed.Body)
+	}
+	return nil
+}
+
+func (h *commandHook) Assert(ctx context.Context, ex *Exchange) error {
+	if !h.runs(StageAssert) {
+		return nil
+	}
+	reply, err := h.call(ctx, &hookMessage{Stage: StageAssert, Operation: ex.Operation, Request: exchangeRequest(ex), Response: exchangeResponse(ex)})
+	if err != nil {
+		return err
+	}
+	if reply != nil && reply.Error != "" {
+		return errors.New(reply.Error)
+	}
+	return nil
+}
+
+func (h *commandHook) OnResult(ctx context.Context, result TableRow) {
+	if !h.runs(StageOnResult) {
+		return
+	}
+	// the result is final, so a failing command is ignored
+	h.call(ctx, &hookMessage{Stage: StageOnResult, Operation: result.Operation, Result: &hookResult{
+		Endpoint:  result.Endpoint,
+		Method:    result.Method,
+		Operation: result.Operation,
+		Response:  result.Response,
+		Assertion: result.Assertion,
+		Failed:    result.Failed(),
+	}})
+}
+
+// call sends the message to the command and reads its reply, nil when the
+// command prints nothing
+func (h *commandHook) call(ctx context.Context, message *hookMessage) (*hookMessage, error) {
+	input, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("encoding hook message: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := h.run(ctx, bytes.NewReader(input), &stdout, &stderr); err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return nil, fmt.Errorf("hook %q failed: %w: %s", h.command, err, detail)
+		}
+		return nil, fmt.Errorf("hook %q failed: %w", h.command, err)
+	}
+
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil, nil
+	}
+	reply := &hookMessage{}
+	if err := json.Unmarshal(stdout.Bytes(), reply); err != nil {
+		return nil, fmt.Errorf("decoding reply of hook %q: %w", h.command, err)
+	}
+	return reply, nil
+}
+
+func exchangeRequest(ex *Exchange) *hookRequest {
+	return &hookRequest{
+		Method:  ex.Request.Method,
+		URL:     ex.Request.URL.String(),
+		Headers: ex.Request.Header,
+		Body:    hookBody(ex.RequestBody),
+	}
+}
+
+func exchangeResponse(ex *Exchange) *hookResponse {
+	return &hookResponse{
+		Status:  ex.Response.StatusCode,
+		Headers: ex.Response.Header,
+		Body:    hookBody(ex.ResponseBody),
+	}
+}
+
+// hookBody returns the body sent to a hook, nil when it is empty
+func hookBody(body []byte) *string {
+	if len(body) == 0 {
+		return nil
+	}
+	s := string(body)
+	return &s
+}
+
+// beforeRequest runs the pre-request scripts and the BeforeRequest hooks,
+// then sets the body of the request to the one they left
+func (r *Runner) beforeRequest(ctx context.Context, ex *Exchange) error {
+	if len(r.hooks) == 0 && len(ex.scripts) == 0 {
+		return nil
+	}
+	if err := r.runPreRequestScripts(ctx, ex); err != nil {
+		return err
+	}
+	for _, hook := range r.hooks {
+		if err := hook.BeforeRequest(ctx, ex); err != nil {
+			return fmt.Errorf("before-request hook: %w", err)
+		}
+	}
+
+	req, body := ex.Request, ex.RequestBody
+	if len(body) == 0 {
+		req.Body, req.GetBody, req.ContentLength = http.NoBody, nil, 0
+		return nil
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+	return nil
+}
+
+// afterResponse runs the AfterResponse hooks, then sets the body of the
+// response to the one they left
+func (r *Runner) afterResponse(ctx context.Context, ex *Exchange) error {
+	for _, hook := range r.hooks {
+		if err := hook.AfterResponse(ctx, ex); err != nil {
+			return fmt.Errorf("after-response hook: %w", err)
+		}
+	}
+	ex.Response.Body = io.NopCloser(bytes.NewReader(ex.ResponseBody))
+	return nil
+}
+
+// assert runs the test scripts, then the Assert hooks, returning the first failure
+func (r *Runner) assert(ctx context.Context, ex *Exchange) error {
+	if err := r.runTestScripts(ctx, ex); err != nil {
+		return err
+	}
+	for _, hook := range r.hooks {
+		if err := hook.Assert(ctx, ex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
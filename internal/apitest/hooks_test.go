@@ -0,0 +1,150 @@
+package apitest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestExchange(t *testing.T, body string) *Exchange {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "http://api.valida.test/pets", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return &Exchange{
+		Operation:    "createPet",
+		Request:      req,
+		RequestBody:  []byte(body),
+		Response:     &http.Response{StatusCode: http.StatusOK, Header: http.Header{}},
+		ResponseBody: []byte(`{"name":"Rex"}`),
+	}
+}
+
+func TestCommandHookBody(t *testing.T) {
+	tests := []struct {
+		name, reply, wantRequest, wantResponse string
+	}{
+		{"no reply", ``, `{"name":"Rex"}`, `{"name":"Rex"}`},
+		{"reply without body", `{"request": {"headers": {"X-Trace": ["1"]}}, "response": {"status": 201}}`, `{"name":"Rex"}`, `{"name":"Rex"}`},
+		{"empty body", `{"request": {"body": ""}, "response": {"body": ""}}`, ``, ``},
+		{"changed body", `{"request": {"body": "{}"}, "response": {"body": "[]"}}`, `{}`, `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook, err := NewCommandHook("cat >/dev/null; printf '%s' '" + tt.reply + "'")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ex := newTestExchange(t, `{"name":"Rex"}`)
+			if err := hook.BeforeRequest(context.Background(), ex); err != nil {
+				t.Fatal(err)
+			}
+			if err := hook.AfterResponse(context.Background(), ex); err != nil {
+				t.Fatal(err)
+			}
+			if string(ex.RequestBody) != tt.wantRequest || string(ex.ResponseBody) != tt.wantResponse {
+				t.Errorf("bodies = %q, %q, want %q, %q", ex.RequestBody, ex.ResponseBody, tt.wantRequest, tt.wantResponse)
+			}
+		})
+	}
+}
+
+func TestCommandHookFailure(t *testing.T) {
+	hook, err := NewCommandHook("echo 'bad signature key' >&2; exit 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hook.BeforeRequest(context.Background(), newTestExchange(t, ""))
+	if err == nil || !strings.Contains(err.Error(), "bad signature key") {
+		t.Errorf("BeforeRequest() error = %v, want the stderr of the command", err)
+	}
+}
+
+// buildWasmHook compiles testdata/wasmhook for WASI, skipping the test when
+// the toolchain cannot
+func buildWasmHook(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building a wasm module is slow")
+	}
+	path := filepath.Join(t.TempDir(), "hook.wasm")
+	cmd := exec.Command("go", "build", "-o", path, "./testdata/wasmhook")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("building the wasm hook: %v\n%s", err, output)
+	}
+	return path
+}
+
+func TestWasmHook(t *testing.T) {
+	hook, err := NewWasmHook(buildWasmHook(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex := newTestExchange(t, `{"name":"Rex"}`)
+	if err := hook.BeforeRequest(context.Background(), ex); err != nil {
+		t.Fatal(err)
+	}
+	if got := ex.Request.Header.Get("X-Signature"); got != "len=14" {
+		t.Errorf("X-Signature = %q, want len=14", got)
+	}
+	if string(ex.RequestBody) != `{"name":"Rex"}` {
+		t.Errorf("RequestBody = %q, want it kept", ex.RequestBody)
+	}
+
+	if err := hook.Assert(context.Background(), ex); err != nil {
+		t.Errorf("Assert() = %v, want a pass", err)
+	}
+	ex.ResponseBody = []byte(`{}`)
+	if err := hook.Assert(context.Background(), ex); err == nil || err.Error() != "the response has no name" {
+		t.Errorf("Assert() = %v, want the error of the module", err)
+	}
+	if err := hook.BeforeRequest(context.Background(), newTestExchange(t, "")); err != nil {
+		t.Errorf("BeforeRequest() without a body: %v", err)
+	}
+}
+
+func TestNewHook(t *testing.T) {
+	if _, err := newHook(HookConfig{Command: "true", Wasm: "hook.wasm"}); err == nil {
+		t.Error("newHook() accepted a command and a wasm module")
+	}
+	if _, err := newHook(HookConfig{Wasm: filepath.Join(t.TempDir(), "missing.wasm")}); err == nil {
+		t.Error("newHook() accepted a missing wasm module")
+	}
+	if _, err := newHook(HookConfig{Command: "true", Stages: []string{"before"}}); err == nil {
+		t.Error("newHook() accepted an unknown stage")
+	}
+}
+
+func TestRunnerClosesWasmHooks(t *testing.T) {
+	path := buildWasmHook(t)
+	hook, err := NewWasmHook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if err := hook.BeforeRequest(context.Background(), newTestExchange(t, `{}`)); err == nil {
+		t.Error("BeforeRequest() ran a closed hook")
+	}
+
+	runner, err := NewRunner(RunnerOptions{Config: &Config{Hooks: []HookConfig{{Wasm: path}}}, Log: LogOptions{File: "none"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Close(); err != nil {
+		t.Fatalf("Runner.Close() = %v", err)
+	}
+	if err := runner.hooks[0].BeforeRequest(context.Background(), newTestExchange(t, `{}`)); err == nil {
+		t.Error("the runner did not close the hook of its config file")
+	}
+}
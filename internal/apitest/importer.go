@@ -0,0 +1,465 @@
+package apitest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// postmanCollection represents the parts of a Postman v2.1 collection used by the importer
+type postmanCollection struct {
+	Info struct {
+		Name string `json:"name"`
+	} `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanVariable `json:"variable"`
+	Auth     *postmanAuth      `json:"auth"`
+	Event    []postmanEvent    `json:"event"`
+}
+
+type postmanItem struct {
+	Name     string           `json:"name"`
+	Item     []postmanItem    `json:"item"`
+	Request  *postmanRequest  `json:"request"`
+	Response []postmanExample `json:"response"`
+	Auth     *postmanAuth     `json:"auth"`
+	Event    []postmanEvent   `json:"event"`
+}
+
+// postmanEvent represents a pre-request or test script
+type postmanEvent struct {
+	Listen string `json:"listen"`
+	Script struct {
+		Exec json.RawMessage `json:"exec"`
+	} `json:"script"`
+}
+
+type postmanRequest struct {
+	Method string            `json:"method"`
+	Header []postmanVariable `json:"header"`
+	URL    json.RawMessage   `json:"url"`
+	Body   *struct {
+		Mode       string             `json:"mode"`
+		Raw        string             `json:"raw"`
+		URLEncoded []postmanVariable  `json:"urlencoded"`
+		FormData   []postmanFormField `json:"formdata"`
+	} `json:"body"`
+	Auth *postmanAuth `json:"auth"`
+}
+
+type postmanExample struct {
+	Code int    `json:"code"`
+	Body string `json:"body"`
+}
+
+type postmanVariable struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+// postmanFormField represents a field of a form-data body, a text value or a file
+type postmanFormField struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Type        string `json:"type"`
+	ContentType string `json:"contentType"`
+	Disabled    bool   `json:"disabled"`
+}
+
+type postmanAuth struct {
+	Type   string            `json:"type"`
+	Bearer []postmanVariable `json:"bearer"`
+	Basic  []postmanVariable `json:"basic"`
+	APIKey []postmanVariable `json:"apikey"`
+}
+
+// harLog represents the parts of a HAR 1.2 archive used by the importer
+type harLog struct {
+	Log struct {
+		Pages []struct {
+			Title string `json:"title"`
+		} `json:"pages"`
+		Entries []struct {
+			Request struct {
+				Method   string       `json:"method"`
+				URL      string       `json:"url"`
+				Headers  []harNameVal `json:"headers"`
+				PostData *struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				Status  int `json:"status"`
+				Content struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+type harNameVal struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ImportPostman converts a Postman v2.1 collection, and optionally a Postman
+// environment, into a scenario. The warnings list the parts of the requests
+// that could not be imported, such as file uploads.
+func ImportPostman(collectionData, environmentData []byte) (*Scenario, []string, error) {
+	var collection postmanCollection
+	if err := json.Unmarshal(collectionData, &collection); err != nil {
+		return nil, nil, fmt.Errorf("decoding Postman collection: %w", err)
+	}
+
+	scenario := &Scenario{
+		Name:      collection.Info.Name,
+		Variables: make(map[string]string),
+	}
+	for _, variable := range collection.Variable {
+		if !variable.Disabled {
+			scenario.Variables[variable.Key] = variable.Value
+		}
+	}
+
+	if environmentData != nil {
+		var environment struct {
+			Values []postmanVariable `json:"values"`
+		}
+		if err := json.Unmarshal(environmentData, &environment); err != nil {
+			return nil, nil, fmt.Errorf("decoding Postman environment: %w", err)
+		}
+		for _, variable := range environment.Values {
+			if variable.Enabled == nil || *variable.Enabled {
+				scenario.Variables[variable.Key] = variable.Value
+			}
+		}
+	}
+
+	var warnings []string
+	addPostmanItems(scenario, &warnings, collection.Item, collection.Auth, postmanScripts(nil, collection.Event), "")
+	return scenario, warnings, nil
+}
+
+// addPostmanItems adds a step for every request of the items. The scripts of
+// collections and folders run before those of their requests.
+func addPostmanItems(scenario *Scenario, warnings *[]string, items []postmanItem, auth *postmanAuth, scripts *Scripts, folder string) {
+	for _, item := range items {
+		itemAuth := auth
+		if item.Auth != nil {
+			itemAuth = item.Auth
+		}
+		itemScripts := postmanScripts(scripts, item.Event)
+
+		name := item.Name
+		if folder != "" {
+			name = folder + " / " + item.Name
+		}
+
+		if item.Request == nil {
+			addPostmanItems(scenario, warnings, item.Item, itemAuth, itemScripts, name)
+			continue
+		}
+
+		if item.Request.Auth != nil {
+			itemAuth = item.Request.Auth
+		}
+
+		step := &ScenarioStep{
+			Name: name,
+			Request: ScenarioRequest{
+				Method:  strings.ToUpper(item.Request.Method),
+				URL:     postmanURL(item.Request.URL),
+				Headers: make(map[string]string),
+			},
+			Scripts: itemScripts,
+		}
+		if step.Request.Method == "" {
+			step.Request.Method = "GET"
+		}
+
+		for _, header := range item.Request.Header {
+			if !header.Disabled {
+				step.Request.Headers[header.Key] = header.Value
+			}
+		}
+		applyPostmanAuth(&step.Request, itemAuth)
+
+		if body := item.Request.Body; body != nil {
+			switch body.Mode {
+			case "raw":
+				step.Request.Body = body.Raw
+			case "urlencoded":
+				values := url.Values{}
+				for _, field := range body.URLEncoded {
+					if !field.Disabled {
+						values.Add(field.Key, field.Value)
+					}
+				}
+				step.Request.Body = values.Encode()
+				if _, ok := lookupHeader(step.Request.Headers, "Content-Type"); !ok {
+					step.Request.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+				}
+			case "formdata":
+				formBody, contentType, skipped := postmanFormData(body.FormData)
+				for _, field := range skipped {
+					*warnings = append(*warnings, fmt.Sprintf("%s: file field %q of the form-data body is not imported", name, field))
+				}
+				step.Request.Body = formBody
+				// the boundary of the body replaces any Content-Type set in Postman
+				for key := range step.Request.Headers {
+					if strings.EqualFold(key, "Content-Type") {
+						delete(step.Request.Headers, key)
+					}
+				}
+				step.Request.Headers["Content-Type"] = contentType
+			case "", "none":
+			default:
+				*warnings = append(*warnings, fmt.Sprintf("%s: %s body is not imported", name, body.Mode))
+			}
+		}
+
+		if len(item.Response) > 0 {
+			step.Expect = &ScenarioExpect{Status: item.Response[0].Code}
+			var body map[string]interface{}
+			if json.Unmarshal([]byte(item.Response[0].Body), &body) == nil {
+				step.Expect.Body = body
+			}
+		}
+
+		scenario.Steps = append(scenario.Steps, step)
+	}
+}
+
+// postmanFormBoundary keeps imported multipart bodies identical between imports
+const postmanFormBoundary = "valida-form-data-boundary"
+
+// postmanFormData encodes the text fields of a form-data body as multipart,
+// returning the body, its Content-Type and the keys of the file fields skipped
+func postmanFormData(fields []postmanFormField) (string, string, []string) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.SetBoundary(postmanFormBoundary)
+
+	var skipped []string
+	for _, field := range fields {
+		if field.Disabled {
+			continue
+		}
+		if field.Type == "file" {
+			skipped = append(skipped, field.Key)
+			continue
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(field.Key)))
+		if field.ContentType != "" {
+			header.Set("Content-Type", field.ContentType)
+		}
+		part, _ := writer.CreatePart(header)
+		part.Write([]byte(field.Value))
+	}
+	writer.Close()
+	return buf.String(), writer.FormDataContentType(), skipped
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// postmanScripts appends the scripts of the events to the inherited ones
+func postmanScripts(inherited *Scripts, events []postmanEvent) *Scripts {
+	scripts := &Scripts{}
+	if inherited != nil {
+		*scripts = *inherited
+	}
+	for _, event := range events {
+		src := postmanScriptSource(event.Script.Exec)
+		switch event.Listen {
+		case "prerequest":
+			scripts.PreRequest = joinScripts(scripts.PreRequest, src)
+		case "test":
+			scripts.Test = joinScripts(scripts.Test, src)
+		}
+	}
+	if scripts.PreRequest == "" && scripts.Test == "" {
+		return nil
+	}
+	return scripts
+}
+
+// postmanScriptSource reads a script, which Postman stores either as an array of lines or as a string
+func postmanScriptSource(raw json.RawMessage) string {
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err == nil {
+		return strings.TrimSpace(strings.Join(lines, "\n"))
+	}
+	var s string
+	json.Unmarshal(raw, &s)
+	return strings.TrimSpace(s)
+}
+
+// postmanURL reads a request URL, which Postman stores either as a string or as an object with a raw field
+func postmanURL(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var u struct {
+		Raw string `json:"raw"`
+	}
+	json.Unmarshal(raw, &u)
+	return u.Raw
+}
+
+// applyPostmanAuth turns the bearer, basic and API key auth of Postman into request headers or query parameters
+func applyPostmanAuth(request *ScenarioRequest, auth *postmanAuth) {
+	if auth == nil {
+		return
+	}
+
+	value := func(vars []postmanVariable, key string) string {
+		for _, v := range vars {
+			if v.Key == key {
+				return v.Value
+			}
+		}
+		return ""
+	}
+
+	switch auth.Type {
+	case "bearer":
+		request.Headers["Authorization"] = "Bearer " + value(auth.Bearer, "token")
+	case "basic":
+		credentials := value(auth.Basic, "username") + ":" + value(auth.Basic, "password")
+		request.Headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	case "apikey":
+		key, keyValue := value(auth.APIKey, "key"), value(auth.APIKey, "value")
+		if value(auth.APIKey, "in") == "query" {
+			separator := "?"
+			if strings.Contains(request.URL, "?") {
+				separator = "&"
+			}
+			request.URL += separator + url.QueryEscape(key) + "=" + url.QueryEscape(keyValue)
+		} else {
+			request.Headers[key] = keyValue
+		}
+	}
+}
+
+// ImportHAR converts the entries of a HAR archive into a scenario, keeping the
+// captured status and JSON body as expectations. Credentials in headers and
+// query parameters are replaced by {{env.VALIDA_NAME}} templates unless
+// showSecrets is set.
+func ImportHAR(data []byte, showSecrets bool) (*Scenario, error) {
+	var har harLog
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("decoding HAR archive: %w", err)
+	}
+
+	scenario := &Scenario{Name: "Imported HAR capture"}
+	if len(har.Log.Pages) > 0 && har.Log.Pages[0].Title != "" {
+		scenario.Name = har.Log.Pages[0].Title
+	}
+	for _, entry := range har.Log.Entries {
+		method := strings.ToUpper(entry.Request.Method)
+		step := &ScenarioStep{
+			Name: method + " " + entry.Request.URL,
+			Request: ScenarioRequest{
+				Method:  method,
+				URL:     entry.Request.URL,
+				Headers: make(map[string]string),
+			},
+			Expect: &ScenarioExpect{Status: entry.Response.Status},
+		}
+		if u, err := url.Parse(entry.Request.URL); err == nil {
+			step.Name = method + " " + u.Path
+			if u.RawQuery != "" && !showSecrets {
+				u.RawQuery = templateQuerySecrets(u.RawQuery)
+				step.Request.URL = u.String()
+			}
+		}
+
+		for _, header := range entry.Request.Headers {
+			switch strings.ToLower(header.Name) {
+			case "host", "content-length", "accept-encoding", "connection":
+				continue
+			}
+			if strings.HasPrefix(header.Name, ":") {
+				continue
+			}
+			value := header.Value
+			if !showSecrets {
+				value = secretTemplate(header.Name, value)
+			}
+			step.Request.Headers[header.Name] = value
+		}
+		if entry.Request.PostData != nil {
+			step.Request.Body = entry.Request.PostData.Text
+			if _, ok := lookupHeader(step.Request.Headers, "Content-Type"); !ok && entry.Request.PostData.MimeType != "" {
+				step.Request.Headers["Content-Type"] = entry.Request.PostData.MimeType
+			}
+		}
+
+		content := entry.Response.Content
+		if isJSONMediaType(strings.Split(content.MimeType, ";")[0]) && content.Encoding == "" {
+			var body map[string]interface{}
+			if json.Unmarshal([]byte(content.Text), &body) == nil {
+				step.Expect.Body = body
+			}
+		}
+
+		scenario.Steps = append(scenario.Steps, step)
+	}
+	return scenario, nil
+}
+
+// MatchScenario links each step of a scenario to the operation of the
+// specification it exercises and returns the steps that match no documented
+// operation. Faker templates in URLs are rendered with the data generator of the runner.
+func (r *Runner) MatchScenario(apiSpec *APISpec, scenario *Scenario) []*ScenarioStep {
+	var unmatched []*ScenarioStep
+	for _, step := range scenario.Steps {
+		rawURL := renderVariables(r.fake, step.Request.URL, scenario.Variables)
+		requestURL, err := url.Parse(rawURL)
+		if err != nil || requestURL.Path == "" {
+			unmatched = append(unmatched, step)
+			continue
+		}
+
+		// Unresolved variables such as {{baseUrl}} leave the host part in the path
+		if strings.HasPrefix(requestURL.Path, "{{") {
+			if index := strings.Index(requestURL.Path, "}}"); index >= 0 {
+				requestURL.Path = requestURL.Path[index+2:]
+			}
+		}
+
+		path, operation := matchOperation(apiSpec, step.Request.Method, requestURL)
+		if operation == nil {
+			unmatched = append(unmatched, step)
+			continue
+		}
+		step.Operation = operationName(path, operation)
+	}
+	return unmatched
+}
+
+func lookupHeader(headers map[string]string, name string) (string, bool) {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,146 @@
+package apitest
+
+import (
+	"mime"
+	"mime/multipart"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportPostmanFormData(t *testing.T) {
+	collection := `{
+		"info": {"name": "uploads"},
+		"item": [{
+			"name": "upload",
+			"request": {
+				"method": "POST",
+				"url": "{{baseUrl}}/uploads",
+				"header": [{"key": "content-type", "value": "multipart/form-data"}],
+				"body": {"mode": "formdata", "formdata": [
+					{"key": "title", "value": "{{title}}", "type": "text"},
+					{"key": "draft", "value": "true", "type": "text", "disabled": true},
+					{"key": "file", "src": "/tmp/report.pdf", "type": "file"}
+				]}
+			}
+		}]
+	}`
+
+	scenario, warnings, err := ImportPostman([]byte(collection), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `file field "file"`) {
+		t.Errorf("warnings = %q, want one about the skipped file field", warnings)
+	}
+
+	request := scenario.Steps[0].Request
+	if len(request.Headers) != 1 {
+		t.Errorf("headers = %v, want only the Content-Type with the boundary", request.Headers)
+	}
+	mediaType, params, err := mime.ParseMediaType(request.Headers["Content-Type"])
+	if err != nil || mediaType != "multipart/form-data" {
+		t.Fatalf("Content-Type = %q", request.Headers["Content-Type"])
+	}
+	form, err := multipart.NewReader(strings.NewReader(request.Body), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := form.Value["title"]; len(got) != 1 || got[0] != "{{title}}" {
+		t.Errorf("title = %q, want the {{title}} placeholder", got)
+	}
+	if _, ok := form.Value["draft"]; ok {
+		t.Error("the disabled field was imported")
+	}
+}
+
+func TestMatchScenario(t *testing.T) {
+	apiSpec := loadTestSpec(t, proxySpec)
+	runner, err := NewRunner(RunnerOptions{Log: LogOptions{File: "none"}, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	scenario := &Scenario{
+		Variables: map[string]string{"version": "v1"},
+		Steps: []*ScenarioStep{
+			{Request: ScenarioRequest{Method: "GET", URL: "{{baseUrl}}/pets?limit={{$randomInt}}"}},
+			{Request: ScenarioRequest{Method: "GET", URL: "http://localhost/pets"}},
+			{Request: ScenarioRequest{Method: "DELETE", URL: "http://localhost/pets"}},
+			{Request: ScenarioRequest{Method: "GET", URL: "http://localhost/{{version}}/owners"}},
+		},
+	}
+	unmatched := runner.MatchScenario(apiSpec, scenario)
+
+	if len(unmatched) != 2 || unmatched[0] != scenario.Steps[2] || unmatched[1] != scenario.Steps[3] {
+		t.Errorf("MatchScenario() left %d steps unmatched, want the DELETE and /v1/owners ones", len(unmatched))
+	}
+	for _, step := range scenario.Steps[:2] {
+		if step.Operation != "listPets" {
+			t.Errorf("%s was linked to %q, want listPets", step.Request.URL, step.Operation)
+		}
+	}
+}
+
+func TestImportHAR(t *testing.T) {
+	har := `{"log": {
+		"pages": [{"title": "Checkout"}],
+		"entries": [{
+			"request": {
+				"method": "post",
+				"url": "https://shop.example.com/v1/orders?api_key=k-1&page=2",
+				"headers": [
+					{"name": "Authorization", "value": "Bearer t-1"},
+					{"name": "X-Api-Key", "value": "k-2"},
+					{"name": "Accept", "value": "application/json"},
+					{"name": "Content-Length", "value": "2"}
+				],
+				"postData": {"mimeType": "application/json", "text": "{}"}
+			},
+			"response": {"status": 201, "content": {"mimeType": "application/json", "text": "{\"id\": \"o-1\"}"}}
+		}]
+	}}`
+
+	scenario, err := ImportHAR([]byte(har), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scenario.Name != "Checkout" || len(scenario.Steps) != 1 {
+		t.Fatalf("scenario = %q with %d steps, want Checkout with 1", scenario.Name, len(scenario.Steps))
+	}
+	step := scenario.Steps[0]
+	if step.Name != "POST /v1/orders" {
+		t.Errorf("step name = %q, want the method and path", step.Name)
+	}
+	request := step.Request
+	if request.URL != "https://shop.example.com/v1/orders?api_key={{env.VALIDA_API_KEY}}&page=2" {
+		t.Errorf("URL = %s, want the API key as a template", request.URL)
+	}
+	want := map[string]string{
+		"Authorization": "Bearer {{env.VALIDA_AUTHORIZATION}}",
+		"X-Api-Key":     "{{env.VALIDA_X_API_KEY}}",
+		"Accept":        "application/json",
+		"Content-Type":  "application/json",
+	}
+	if !reflect.DeepEqual(request.Headers, want) {
+		t.Errorf("headers = %v, want %v", request.Headers, want)
+	}
+	if step.Expect.Status != 201 || step.Expect.Body["id"] != "o-1" {
+		t.Errorf("expect = %+v, want the captured response", step.Expect)
+	}
+
+	shown, err := ImportHAR([]byte(har), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request = shown.Steps[0].Request
+	if request.Headers["Authorization"] != "Bearer t-1" || !strings.Contains(request.URL, "api_key=k-1") {
+		t.Errorf("request = %+v, want the captured credentials with secrets shown", request)
+	}
+
+	unnamed, err := ImportHAR([]byte(`{"log": {"entries": []}}`), false)
+	if err != nil || unnamed.Name != "Imported HAR capture" {
+		t.Errorf("scenario name = %q, %v, want the default name", unnamed.Name, err)
+	}
+}
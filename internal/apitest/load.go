@@ -0,0 +1,752 @@
+package apitest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Load test executors
+const (
+	ConstantRate = "constant-rate"
+	RampingRate  = "ramping-rate"
+	ConstantVUs  = "constant-vus"
+	RampingVUs   = "ramping-vus"
+)
+
+// LoadStage represents a stage of a ramping executor: the target rate or
+// number of virtual users reached linearly over the stage duration
+type LoadStage struct {
+	Duration time.Duration
+	Target   int
+}
+
+// LoadOptions represents the settings of a load test
+type LoadOptions struct {
+	Executor   string
+	Rate       int
+	VUs        int
+	MaxVUs     int
+	Duration   time.Duration
+	Iterations int
+	Stages     []LoadStage
+	Weights    map[string]int
+}
+
+// LoadLatency represents latency percentiles in milliseconds
+type LoadLatency struct {
+	Min float64 `json:"min"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// OperationLoadStats represents the results of a load test for one operation
+type OperationLoadStats struct {
+	Operation string      `json:"operation"`
+	Requests  int         `json:"requests"`
+	Errors    int         `json:"errors"`
+	Latency   LoadLatency `json:"latencyMs"`
+
+	latency latencyHistogram
+}
+
+// LoadReport represents the summary of a load test
+type LoadReport struct {
+	Executor    string                `json:"executor"`
+	Duration    float64               `json:"durationSeconds"`
+	Requests    int                   `json:"requests"`
+	Errors      int                   `json:"errors"`
+	Dropped     int                   `json:"dropped"`
+	RPS         float64               `json:"rps"`
+	ErrorRate   float64               `json:"errorRate"`
+	Latency     LoadLatency           `json:"latencyMs"`
+	StatusCodes map[string]int        `json:"statusCodes"`
+	Operations  []*OperationLoadStats `json:"operations"`
+	ErrorKinds  map[string]int        `json:"errorKinds,omitempty"`
+}
+
+// loadTarget represents an operation that can be picked by the load test
+type loadTarget struct {
+	name      string
+	pathItem  *PathItem
+	operation *Operation
+	opConfig  *OperationConfig
+	weight    int
+}
+
+// loadStats collects the results of a running load test
+type loadStats struct {
+	mu         sync.Mutex
+	started    time.Time
+	requests   int
+	errors     int
+	dropped    int
+	active     int
+	latency    latencyHistogram
+	recent     []time.Time
+	statuses   map[string]int
+	errorKinds map[string]int
+	operations map[string]*OperationLoadStats
+}
+
+// ParseStages reads ramping stages written as duration:target pairs, such as
+// "30s:10,1m:50,30s:0"
+func ParseStages(s string) ([]LoadStage, error) {
+	var stages []LoadStage
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		durationText, targetText, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid stage %q, expected duration:target", part)
+		}
+		duration, err := time.ParseDuration(durationText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stage duration %q: %w", durationText, err)
+		}
+		target, err := strconv.Atoi(targetText)
+		if err != nil || target < 0 {
+			return nil, fmt.Errorf("invalid stage target %q", targetText)
+		}
+		stages = append(stages, LoadStage{Duration: duration, Target: target})
+	}
+	return stages, nil
+}
+
+// RunLoad drives the operations of the spec with the given executor until the
+// duration, stages or iteration limit is reached or ctx is cancelled, showing
+// live statistics while it runs
+func (r *Runner) RunLoad(ctx context.Context, apiSpec *APISpec, options LoadOptions) (*LoadReport, error) {
+	targets, err := r.loadTargets(apiSpec, options.Weights)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalDuration time.Duration
+	switch options.Executor {
+	case ConstantRate, ConstantVUs:
+		if options.Duration <= 0 && options.Iterations <= 0 {
+			return nil, fmt.Errorf("%s needs a duration or an iteration limit", options.Executor)
+		}
+		totalDuration = options.Duration
+	case RampingRate, RampingVUs:
+		if len(options.Stages) == 0 {
+			return nil, fmt.Errorf("%s needs at least one stage", options.Executor)
+		}
+		for _, stage := range options.Stages {
+			totalDuration += stage.Duration
+		}
+	default:
+		return nil, fmt.Errorf("unknown executor %q, expected %s, %s, %s or %s", options.Executor, ConstantRate, RampingRate, ConstantVUs, RampingVUs)
+	}
+	if options.Executor == ConstantRate && options.Rate <= 0 {
+		return nil, fmt.Errorf("%s needs a rate above 0", ConstantRate)
+	}
+	if options.Executor == ConstantVUs && options.VUs <= 0 {
+		return nil, fmt.Errorf("%s needs at least one virtual user", ConstantVUs)
+	}
+	if options.MaxVUs <= 0 {
+		options.MaxVUs = 100
+	}
+
+	if totalDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, totalDuration)
+		defer cancel()
+	}
+	// the executors stop once the iteration limit is reached, while requests
+	// in flight run until the duration ends or ctx is cancelled
+	scheduleCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	stats := &loadStats{
+		started:    time.Now(),
+		statuses:   make(map[string]int),
+		errorKinds: make(map[string]int),
+		operations: make(map[string]*OperationLoadStats),
+	}
+	loadClient := r.newLoadClient(options.MaxVUs)
+
+	var issued int
+	var issuedMu sync.Mutex
+	// nextIteration reserves an iteration, returning false once the iteration limit is reached
+	nextIteration := func() bool {
+		issuedMu.Lock()
+		defer issuedMu.Unlock()
+		if options.Iterations > 0 && issued >= options.Iterations {
+			stop()
+			return false
+		}
+		issued++
+		return true
+	}
+	iterate := func() {
+		target := pickTarget(r.fake, targets)
+		r.sendLoadRequest(ctx, loadClient, apiSpec, target, stats)
+	}
+
+	done := make(chan struct{})
+	go displayLoadStats(scheduleCtx, stats, done)
+
+	switch options.Executor {
+	case ConstantRate, RampingRate:
+		runRateExecutor(scheduleCtx, options, stats, nextIteration, iterate)
+	case ConstantVUs, RampingVUs:
+		runVUExecutor(scheduleCtx, options, nextIteration, iterate)
+	}
+
+	stop()
+	<-done
+	return stats.report(options.Executor), nil
+}
+
+// loadTargets lists the operations of the spec with their weights. Operations
+// without a weight get 1 and a weight of 0 leaves the operation out.
+func (r *Runner) loadTargets(apiSpec *APISpec, weights map[string]int) ([]*loadTarget, error) {
+	var targets []*loadTarget
+	used := make(map[string]bool)
+
+	var paths []string
+	for path := range apiSpec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		pathItem := apiSpec.Paths[path]
+		var methods []string
+		for method := range pathItem.Operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			operation := pathItem.Operations[method]
+			target := &loadTarget{
+				name:      operationName(path, operation),
+				pathItem:  pathItem,
+				operation: operation,
+				opConfig:  r.config.findOperationConfig(path, operation),
+				weight:    1,
+			}
+			for key, weight := range weights {
+				if strings.EqualFold(key, target.name) || strings.EqualFold(key, strings.ToUpper(method)+" "+path) {
+					target.weight = weight
+					used[key] = true
+				}
+			}
+			if target.weight > 0 {
+				targets = append(targets, target)
+			}
+		}
+	}
+
+	for key := range weights {
+		if !used[key] {
+			return nil, fmt.Errorf("weight given for unknown operation %s", key)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no operations to load test")
+	}
+	return targets, nil
+}
+
+func pickTarget(fake *gofakeit.Faker, targets []*loadTarget) *loadTarget {
+	total := 0
+	for _, target := range targets {
+		total += target.weight
+	}
+	n := randInt(fake, 1, total)
+	for _, target := range targets {
+		n -= target.weight
+		if n <= 0 {
+			return target
+		}
+	}
+	return targets[len(targets)-1]
+}
+
+// newLoadClient copies the client of the runner with a connection pool sized for the load test
+func (r *Runner) newLoadClient(maxVUs int) *http.Client {
+	loadClient := *r.client
+	switch t := r.client.Transport.(type) {
+	case *http.Transport:
+		loadClient.Transport = pooledTransport(t, maxVUs)
+	case *tlsTransport:
+		loadClient.Transport = t.withPool(maxVUs)
+	case nil:
+		loadClient.Transport = pooledTransport(http.DefaultTransport.(*http.Transport), maxVUs)
+	}
+	return &loadClient
+}
+
+// currentTarget returns the rate or number of virtual users at a point of the
+// run, interpolating linearly within the current stage
+func currentTarget(options LoadOptions, elapsed time.Duration) float64 {
+	switch options.Executor {
+	case ConstantRate:
+		return float64(options.Rate)
+	case ConstantVUs:
+		return float64(options.VUs)
+	}
+
+	previous := 0.0
+	for _, stage := range options.Stages {
+		if elapsed < stage.Duration {
+			progress := float64(elapsed) / float64(stage.Duration)
+			return previous + (float64(stage.Target)-previous)*progress
+		}
+		elapsed -= stage.Duration
+		previous = float64(stage.Target)
+	}
+	return previous
+}
+
+// runRateExecutor starts iterations at the target rate, whatever the response
+// times, using at most MaxVUs concurrent requests. Iterations that cannot start
+// because every virtual user is busy are counted as dropped.
+func runRateExecutor(ctx context.Context, options LoadOptions, stats *loadStats, nextIteration func() bool, iterate func()) {
+	slots := make(chan struct{}, options.MaxVUs)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	started := time.Now()
+	next := started
+	for {
+		rate := currentTarget(options, time.Since(started))
+		if rate < 0.1 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+			next = time.Now()
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		next = next.Add(time.Duration(float64(time.Second) / rate))
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			stats.drop()
+			continue
+		}
+		if !nextIteration() {
+			<-slots
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			iterate()
+		}()
+	}
+}
+
+// runVUExecutor keeps the target number of virtual users running iterations back to back
+func runVUExecutor(ctx context.Context, options LoadOptions, nextIteration func() bool, iterate func()) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var stops []chan struct{}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	started := time.Now()
+	for {
+		target := int(currentTarget(options, time.Since(started)) + 0.5)
+		for len(stops) < target {
+			stopVU := make(chan struct{})
+			stops = append(stops, stopVU)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-stopVU:
+						return
+					default:
+					}
+					if !nextIteration() {
+						return
+					}
+					iterate()
+				}
+			}()
+		}
+		for len(stops) > target {
+			close(stops[len(stops)-1])
+			stops = stops[:len(stops)-1]
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendLoadRequest sends one generated request for the target and records the
+// outcome. Requests still running when ctx is done are abandoned, not counted.
+func (r *Runner) sendLoadRequest(ctx context.Context, loadClient *http.Client, apiSpec *APISpec, target *loadTarget, stats *loadStats) {
+	stats.begin()
+
+	req, requestBody := r.prepareRequest(apiSpec, target.pathItem, target.operation, target.opConfig)
+	if req == nil {
+		stats.record(target.name, 0, 0, "request preparation error")
+		return
+	}
+	req = req.WithContext(ctx)
+	// requests are signed or otherwise changed as in tests, but not checked by scripts or hooks
+	ex := &Exchange{Operation: target.name, Request: req, RequestBody: []byte(requestBody)}
+	ex.scripts = r.config.requestScripts(target.operation, target.opConfig.scripts())
+	if err := r.beforeRequest(ctx, ex); err != nil {
+		if ctx.Err() != nil {
+			stats.abandon()
+			return
+		}
+		stats.record(target.name, 0, 0, "pre-request error")
+		return
+	}
+	req = ex.Request
+
+	started := time.Now()
+	resp, err := loadClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			stats.abandon()
+			return
+		}
+		stats.record(target.name, 0, time.Since(started), "transport error")
+		return
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	elapsed := time.Since(started)
+	if err != nil {
+		if ctx.Err() != nil {
+			stats.abandon()
+			return
+		}
+		stats.record(target.name, resp.StatusCode, elapsed, "error reading body")
+		return
+	}
+
+	errorKind := ""
+	if resp.StatusCode >= 400 {
+		errorKind = fmt.Sprintf("status %d", resp.StatusCode)
+	} else if _, err := validateResponse(apiSpec, target.operation, resp, body); err != nil {
+		errorKind = "contract violation"
+	}
+	stats.record(target.name, resp.StatusCode, elapsed, errorKind)
+}
+
+func (s *loadStats) begin() {
+	s.mu.Lock()
+	s.active++
+	s.mu.Unlock()
+}
+
+// abandon forgets a request interrupted by the end of the run
+func (s *loadStats) abandon() {
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+}
+
+func (s *loadStats) drop() {
+	s.mu.Lock()
+	s.dropped++
+	s.mu.Unlock()
+}
+
+func (s *loadStats) record(operation string, status int, elapsed time.Duration, errorKind string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active--
+	s.requests++
+	s.recent = append(s.recent, time.Now())
+	if status > 0 {
+		s.statuses[strconv.Itoa(status)]++
+	}
+
+	operationStats, ok := s.operations[operation]
+	if !ok {
+		operationStats = &OperationLoadStats{Operation: operation}
+		s.operations[operation] = operationStats
+	}
+	operationStats.Requests++
+
+	if errorKind != "" {
+		s.errors++
+		s.errorKinds[errorKind]++
+		operationStats.Errors++
+	}
+	if elapsed > 0 {
+		s.latency.add(elapsed)
+		operationStats.latency.add(elapsed)
+	}
+}
+
+// snapshot returns the live figures shown while the load test runs
+func (s *loadStats) snapshot() (elapsed time.Duration, requests, errors, active int, rps float64, latency LoadLatency) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-time.Second)
+	i := sort.Search(len(s.recent), func(i int) bool { return s.recent[i].After(cutoff) })
+	s.recent = s.recent[i:]
+
+	return time.Since(s.started), s.requests, s.errors, s.active, float64(len(s.recent)), s.latency.summary()
+}
+
+func (s *loadStats) report(executor string) *LoadReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := time.Since(s.started)
+	report := &LoadReport{
+		Executor:    executor,
+		Duration:    elapsed.Seconds(),
+		Requests:    s.requests,
+		Errors:      s.errors,
+		Dropped:     s.dropped,
+		Latency:     s.latency.summary(),
+		StatusCodes: s.statuses,
+		ErrorKinds:  s.errorKinds,
+	}
+	if elapsed > 0 {
+		report.RPS = float64(s.requests) / elapsed.Seconds()
+	}
+	if s.requests > 0 {
+		report.ErrorRate = float64(s.errors) / float64(s.requests)
+	}
+
+	var names []string
+	for name := range s.operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		operationStats := s.operations[name]
+		operationStats.Latency = operationStats.latency.summary()
+		report.Operations = append(report.Operations, operationStats)
+	}
+	return report
+}
+
+// histogramGrowth is the ratio between the bounds of a latency bucket, which
+// keeps percentiles within 1% of the measured latency
+const histogramGrowth = 1.01
+
+// latencyHistogram counts latencies in logarithmic buckets of microseconds, so
+// a long load test keeps its percentiles in constant memory
+type latencyHistogram struct {
+	counts []int
+	total  int
+	min    time.Duration
+	max    time.Duration
+}
+
+func (h *latencyHistogram) add(d time.Duration) {
+	bucket := 0
+	if us := d.Microseconds(); us > 1 {
+		bucket = int(math.Log(float64(us)) / math.Log(histogramGrowth))
+	}
+	if bucket >= len(h.counts) {
+		h.counts = append(h.counts, make([]int, bucket+1-len(h.counts))...)
+	}
+	h.counts[bucket]++
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.total++
+}
+
+// percentile returns the middle of the bucket holding the pth percentile,
+// kept within the smallest and largest latency seen
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	seen := 0
+	for bucket, count := range h.counts {
+		seen += count
+		if seen < rank {
+			continue
+		}
+		d := time.Duration(math.Pow(histogramGrowth, float64(bucket)+0.5) * float64(time.Microsecond))
+		return max(h.min, min(d, h.max))
+	}
+	return h.max
+}
+
+func (h *latencyHistogram) summary() LoadLatency {
+	if h.total == 0 {
+		return LoadLatency{}
+	}
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return LoadLatency{
+		Min: ms(h.min),
+		P50: ms(h.percentile(50)),
+		P90: ms(h.percentile(90)),
+		P95: ms(h.percentile(95)),
+		P99: ms(h.percentile(99)),
+		Max: ms(h.max),
+	}
+}
+
+// displayLoadStats refreshes the live statistics every second until ctx is
+// done. On a terminal the block is redrawn in place, otherwise a line is
+// printed every five seconds.
+func displayLoadStats(ctx context.Context, stats *loadStats, done chan<- struct{}) {
+	defer close(done)
+
+	interactive := false
+	if info, err := os.Stdout.Stat(); err == nil {
+		interactive = info.Mode()&os.ModeCharDevice != 0
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	drawn := 0
+	ticks := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ticks++
+
+		elapsed, requests, errors, active, rps, latency := stats.snapshot()
+		errorRate := 0.0
+		if requests > 0 {
+			errorRate = float64(errors) * 100 / float64(requests)
+		}
+
+		if !interactive {
+			if ticks%5 == 0 {
+				fmt.Printf("%s requests=%d rps=%.1f errors=%.1f%% p50=%.1fms p95=%.1fms p99=%.1fms\n",
+					elapsed.Truncate(time.Second), requests, rps, errorRate, latency.P50, latency.P95, latency.P99)
+			}
+			continue
+		}
+
+		lines := []string{
+			headerStyle.Render(fmt.Sprintf("Load test running for %s", elapsed.Truncate(time.Second))),
+			cellStyle.Render(fmt.Sprintf("Requests: %-8d Active: %-6d RPS: %.1f", requests, active, rps)),
+			errorRateStyle(errorRate).Render(fmt.Sprintf("Error rate: %.2f%% (%d)", errorRate, errors)),
+			cellStyle.Render(fmt.Sprintf("Latency p50: %.1fms  p95: %.1fms  p99: %.1fms", latency.P50, latency.P95, latency.P99)),
+		}
+		if drawn > 0 {
+			fmt.Printf("\033[%dA", drawn)
+		}
+		for _, line := range lines {
+			fmt.Printf("\033[2K%s\n", line)
+		}
+		drawn = len(lines)
+	}
+}
+
+func errorRateStyle(errorRate float64) lipgloss.Style {
+	switch {
+	case errorRate == 0:
+		return successStyle.Copy().Padding(0, 1)
+	case errorRate < 5:
+		return warningStyle.Copy().Padding(0, 1)
+	default:
+		return errorStyle.Copy().Padding(0, 1)
+	}
+}
+
+// DisplayLoadReport prints the summary of a load test
+func DisplayLoadReport(report *LoadReport) {
+	fmt.Println()
+	fmt.Println(totalStyle.Render(fmt.Sprintf("Load test summary (%s)", report.Executor)))
+	fmt.Printf("Duration: %.1fs  Requests: %d  RPS: %.1f  Errors: %d (%.2f%%)  Dropped: %d\n",
+		report.Duration, report.Requests, report.RPS, report.Errors, report.ErrorRate*100, report.Dropped)
+	fmt.Println()
+
+	fmt.Printf("%-40s %9s %7s %9s %9s %9s %9s %9s\n", "Operation", "Requests", "Errors", "Min", "p50", "p95", "p99", "Max")
+	row := func(name string, requests, errors int, latency LoadLatency) {
+		fmt.Printf("%-40s %9d %7d %8.1fms %8.1fms %8.1fms %8.1fms %8.1fms\n", truncate(name, 40), requests, errors,
+			latency.Min, latency.P50, latency.P95, latency.P99, latency.Max)
+	}
+	for _, operation := range report.Operations {
+		row(operation.Operation, operation.Requests, operation.Errors, operation.Latency)
+	}
+	row("All", report.Requests, report.Errors, report.Latency)
+
+	if len(report.StatusCodes) > 0 {
+		var codes []string
+		for code := range report.StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		var parts []string
+		for _, code := range codes {
+			parts = append(parts, fmt.Sprintf("%s: %d", code, report.StatusCodes[code]))
+		}
+		fmt.Printf("\nStatus codes: %s\n", strings.Join(parts, ", "))
+	}
+	if len(report.ErrorKinds) > 0 {
+		var kinds []string
+		for kind := range report.ErrorKinds {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		var parts []string
+		for _, kind := range kinds {
+			parts = append(parts, fmt.Sprintf("%s: %d", kind, report.ErrorKinds[kind]))
+		}
+		fmt.Println(errorStyle.Render("Errors: " + strings.Join(parts, ", ")))
+	}
+}
+
+// WriteLoadReport writes the summary of a load test as JSON
+func WriteLoadReport(report *LoadReport, filePath string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding load report: %w", err)
+	}
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		return fmt.Errorf("writing load report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package apitest
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramPercentiles(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	var h latencyHistogram
+	var durations []time.Duration
+	for i := 0; i < 100000; i++ {
+		d := time.Duration(random.ExpFloat64() * float64(20*time.Millisecond))
+		h.add(d)
+		durations = append(durations, d)
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	if h.min != durations[0] || h.max != durations[len(durations)-1] {
+		t.Errorf("min, max = %s, %s, want %s, %s", h.min, h.max, durations[0], durations[len(durations)-1])
+	}
+	for _, p := range []float64{50, 90, 95, 99} {
+		want := percentile(durations, p)
+		got := h.percentile(p)
+		if diff := math.Abs(float64(got-want)) / float64(want); diff > 0.01 {
+			t.Errorf("p%g = %s, want %s within 1%%", p, got, want)
+		}
+	}
+	if len(h.counts) > 2000 {
+		t.Errorf("the histogram grew to %d buckets", len(h.counts))
+	}
+}
+
+func TestRunLoadCancelsRequestsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer service.Close()
+	defer close(release)
+
+	apiSpec := loadTestSpec(t, strings.Replace(proxySpec, "http://localhost", service.URL, 1))
+	runner, err := NewRunner(RunnerOptions{Log: LogOptions{File: "none"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	report, err := runner.RunLoad(ctx, apiSpec, LoadOptions{Executor: ConstantVUs, VUs: 2, Duration: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RunLoad() returned %s after ctx was done", elapsed)
+	}
+	if report.Requests != 0 || report.Errors != 0 {
+		t.Errorf("requests interrupted by the end of the run were counted: %+v", report)
+	}
+}
@@ -1,65 +1,357 @@
 package apitest
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
-type Logger struct {
-	file *os.File
+// LogOptions represents where and how the run is logged. File is a path,
+// "stderr" or "none"; when empty the log goes to test_log_<timestamp>.txt.
+type LogOptions struct {
+	Format string
+	Level  string
+	File   string
+	Redact []string
 }
 
-func NewLogger() (*Logger, error) {
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	filename := fmt.Sprintf("test_log_%s.txt", timestamp)
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+	}
+	return level, nil
+}
 
-	file, err := os.Create(filename)
+// Logger writes the requests, responses and errors of a run as structured
+// records. A logger derived with forCase tags every record with the
+// correlation id of one test case.
+type Logger struct {
+	log    *slog.Logger
+	redact *redactor
+	closer io.Closer
+}
+
+// newLogger opens the log described by the options, masking bodies and
+// commands with redact
+func newLogger(options LogOptions, redact *redactor) (*Logger, error) {
+	switch strings.ToLower(options.Format) {
+	case "", "text", "json":
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected text or json", options.Format)
+	}
+	level, err := parseLogLevel(options.Level)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create log file: %w", err)
+		return nil, err
+	}
+
+	var out io.Writer
+	var closer io.Closer
+	switch options.File {
+	case "none":
+		out = io.Discard
+	case "stderr":
+		out = os.Stderr
+	default:
+		filename := options.File
+		if filename == "" {
+			timestamp := time.Now().Format("2006-01-02_15-04-05")
+			filename = fmt.Sprintf("test_log_%s.txt", timestamp)
+			if strings.EqualFold(options.Format, "json") {
+				filename = fmt.Sprintf("test_log_%s.json", timestamp)
+			}
+		}
+		file, err := os.Create(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create log file: %w", err)
+		}
+		out, closer = file, file
 	}
 
-	return &Logger{file: file}, nil
+	handlerOptions := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.EqualFold(options.Format, "json") {
+		handler = slog.NewJSONHandler(out, handlerOptions)
+	} else {
+		handler = slog.NewTextHandler(out, handlerOptions)
+	}
+	return &Logger{log: slog.New(handler), redact: redact, closer: closer}, nil
 }
 
 func (l *Logger) Close() error {
-	return l.file.Close()
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// forCase returns a logger tagging its records with a new correlation id
+func (l *Logger) forCase(operation string) *Logger {
+	if l == nil {
+		return nil
+	}
+	attrs := []any{slog.String("correlation_id", newCorrelationID())}
+	if operation != "" {
+		attrs = append(attrs, slog.String("operation", operation))
+	}
+	return &Logger{log: l.log.With(attrs...), redact: l.redact}
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
 }
 
 func (l *Logger) LogRequest(req *http.Request, body string) {
-	l.writeLog(fmt.Sprintf("REQUEST: %s %s\n", req.Method, req.URL))
-	l.writeLog("Headers:\n")
-	for key, values := range req.Header {
-		for _, value := range values {
-			l.writeLog(fmt.Sprintf("%s: %s\n", key, value))
-		}
+	if !l.enabled(slog.LevelInfo) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", l.redact.maskURL(req.URL)),
+		l.redact.headerAttr(req.Header),
 	}
 	if body != "" {
-		l.writeLog(fmt.Sprintf("Body:\n%s\n", body))
+		attrs = append(attrs, slog.Any("body", l.redact.redactBody(req.Header.Get("Content-Type"), body)))
 	}
-	l.writeLog("\n")
+	attrs = append(attrs, slog.String("curl", l.redact.curlCommand(req, body)), slog.String("httpie", l.redact.httpieCommand(req, body)))
+	l.log.LogAttrs(context.Background(), slog.LevelInfo, "request", attrs...)
 }
 
 func (l *Logger) LogResponse(resp *http.Response, body string) {
-	l.writeLog(fmt.Sprintf("RESPONSE: %s\n", resp.Status))
-	l.writeLog("Headers:\n")
-	for key, values := range resp.Header {
-		for _, value := range values {
-			l.writeLog(fmt.Sprintf("%s: %s\n", key, value))
-		}
+	if !l.enabled(slog.LevelInfo) {
+		return
 	}
-	l.writeLog(fmt.Sprintf("Body:\n%s\n", body))
-	l.writeLog("\n")
+	l.log.LogAttrs(context.Background(), slog.LevelInfo, "response",
+		slog.Int("status", resp.StatusCode),
+		l.redact.headerAttr(resp.Header),
+		slog.Any("body", l.redact.redactBody(resp.Header.Get("Content-Type"), body)))
+}
+
+func (l *Logger) LogTiming(timing *RequestTiming) {
+	if !l.enabled(slog.LevelInfo) || timing == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.Duration("dns", timing.DNS),
+		slog.Duration("connect", timing.Connect),
+		slog.Duration("tls", timing.TLS),
+		slog.Duration("ttfb", timing.TTFB),
+		slog.Duration("total", timing.Total),
+	}
+	if timing.Attempts > 1 {
+		attrs = append(attrs, slog.Int("attempts", timing.Attempts), slog.Duration("retry_wait", timing.RetryWait))
+	}
+	if timing.Throttle > 0 {
+		attrs = append(attrs, slog.Duration("throttle", timing.Throttle))
+	}
+	l.log.LogAttrs(context.Background(), slog.LevelInfo, "timing", attrs...)
+}
+
+// LogResult records the assertion of a test case, at error level when it failed
+func (l *Logger) LogResult(assertion string) {
+	level := slog.LevelInfo
+	switch {
+	case strings.HasPrefix(assertion, "FAIL"):
+		level = slog.LevelError
+	case strings.HasPrefix(assertion, "WARNING"):
+		level = slog.LevelWarn
+	}
+	if !l.enabled(level) {
+		return
+	}
+	l.log.LogAttrs(context.Background(), level, "result", slog.String("assertion", assertion))
+}
+
+// LogScript records a message logged by a script
+func (l *Logger) LogScript(stage, message string) {
+	if !l.enabled(slog.LevelInfo) {
+		return
+	}
+	l.log.LogAttrs(context.Background(), slog.LevelInfo, "script", slog.String("stage", stage), slog.String("message", message))
+}
+
+func (l *Logger) LogWarning(message string) {
+	if !l.enabled(slog.LevelWarn) {
+		return
+	}
+	l.log.Warn(message)
 }
 
 func (l *Logger) LogError(err error) {
-	l.writeLog(fmt.Sprintf("ERROR: %v\n\n", err))
+	if !l.enabled(slog.LevelError) {
+		return
+	}
+	l.log.Error(err.Error())
 }
 
-func (l *Logger) writeLog(message string) {
-	_, err := l.file.WriteString(message)
+func (l *Logger) enabled(level slog.Level) bool {
+	return l != nil && l.log.Enabled(context.Background(), level)
+}
+
+// headerAttr groups the headers of a message, masking credentials
+func (m *redactor) headerAttr(header http.Header) slog.Attr {
+	var attrs []any
+	for _, name := range sortedHeaderNames(header) {
+		values := header.Values(name)
+		masked := make([]string, len(values))
+		for i, value := range values {
+			masked[i] = m.maskHeader(name, value)
+		}
+		attrs = append(attrs, slog.String(name, strings.Join(masked, ", ")))
+	}
+	return slog.Group("headers", attrs...)
+}
+
+// logBody represents a message body, written as nested JSON by the JSON
+// handler when it is valid JSON and as plain text otherwise
+type logBody []byte
+
+func (b logBody) MarshalJSON() ([]byte, error) {
+	if json.Valid(b) {
+		return b, nil
+	}
+	return json.Marshal(string(b))
+}
+
+func (b logBody) MarshalText() ([]byte, error) {
+	return b, nil
+}
+
+// redactBody masks the values of secret fields, and of the fields configured
+// with --redact or the redact list of the config file, at any depth of a JSON
+// body and in the fields of form and multipart bodies
+func (m *redactor) redactBody(contentType, body string) logBody {
+	if m.showSecrets || body == "" {
+		return logBody(body)
+	}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		return logBody(m.redactForm(body))
+	case "multipart/form-data":
+		if redacted, err := m.redactMultipart(body, params["boundary"]); err == nil {
+			return logBody(redacted)
+		}
+		return logBody(body)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		return logBody(body)
+	}
+	if !m.redactValue(value) {
+		return logBody(body)
+	}
+	redacted, err := json.Marshal(value)
 	if err != nil {
-		fmt.Printf("Failed to write to log file: %v\n", err)
+		return logBody(body)
+	}
+	return logBody(redacted)
+}
+
+// redactForm masks the values of redacted fields in a URL encoded form,
+// leaving the encoding of the other fields untouched
+func (m *redactor) redactForm(body string) string {
+	pairs := strings.Split(body, "&")
+	for i, pair := range pairs {
+		name, _, hasValue := strings.Cut(pair, "=")
+		if decodedName, err := url.QueryUnescape(name); err == nil && hasValue && m.isRedactedField(decodedName) {
+			pairs[i] = name + "=" + maskedValue
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// redactMultipart masks the values of redacted fields in a multipart form,
+// keeping the boundary and the headers of every part
+func (m *redactor) redactMultipart(body, boundary string) (string, error) {
+	if boundary == "" {
+		return "", fmt.Errorf("multipart body without boundary")
+	}
+	reader := multipart.NewReader(strings.NewReader(body), boundary)
+	var out strings.Builder
+	writer := multipart.NewWriter(&out)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return "", err
+	}
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return "", err
+		}
+		if part.FileName() == "" && m.isRedactedField(part.FormName()) {
+			value = []byte(maskedValue)
+		}
+		partWriter, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return "", err
+		}
+		partWriter.Write(value)
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func (m *redactor) redactValue(value interface{}) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if m.isRedactedField(key) {
+				v[key] = maskedValue
+				changed = true
+				continue
+			}
+			if m.redactValue(field) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if m.redactValue(item) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func (m *redactor) isRedactedField(name string) bool {
+	if isSecretName(name) {
+		return true
+	}
+	for _, field := range m.fields {
+		if strings.EqualFold(field, name) {
+			return true
+		}
 	}
+	return false
 }
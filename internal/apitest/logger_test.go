@@ -0,0 +1,157 @@
+package apitest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactBody(t *testing.T) {
+	var multipartBody bytes.Buffer
+	writer := multipart.NewWriter(&multipartBody)
+	writer.WriteField("username", "rex")
+	writer.WriteField("password", "hunter2")
+	file, _ := writer.CreateFormFile("token", "token.txt")
+	file.Write([]byte("file content"))
+	writer.Close()
+
+	redact := &redactor{fields: []string{"pin"}}
+	tests := []struct {
+		name, contentType, body string
+		want                    []string
+		masked                  []string
+	}{
+		{"json", "application/json", `{"username": "rex", "password": "hunter2", "user": {"pin": "1234"}}`, []string{`"username":"rex"`}, []string{"hunter2", "1234"}},
+		{"json without content type", "", `{"api_key": "k-1"}`, []string{`"api_key":"****"`}, []string{"k-1"}},
+		{"form", "application/x-www-form-urlencoded", "username=rex&password=hunter2&pin=1234&note=a%20b", []string{"username=rex&password=****&pin=****&note=a%20b"}, []string{"hunter2", "1234"}},
+		{"form with charset", "application/x-www-form-urlencoded; charset=utf-8", "access_token=abc", []string{"access_token=****"}, []string{"abc"}},
+		{"multipart", writer.FormDataContentType(), multipartBody.String(), []string{"rex", "file content", writer.Boundary()}, []string{"hunter2"}},
+		{"text", "text/plain", "password=hunter2", []string{"password=hunter2"}, nil},
+	}
+	for _, tt := range tests {
+		got := string(redact.redactBody(tt.contentType, tt.body))
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: redactBody() = %q, want it to contain %q", tt.name, got, want)
+			}
+		}
+		for _, secret := range tt.masked {
+			if strings.Contains(got, secret) {
+				t.Errorf("%s: redactBody() = %q, want %q masked", tt.name, got, secret)
+			}
+		}
+	}
+
+	shown := &redactor{showSecrets: true}
+	if got := string(shown.redactBody("application/x-www-form-urlencoded", "password=hunter2")); got != "password=hunter2" {
+		t.Errorf("redactBody() with secrets shown = %q", got)
+	}
+}
+
+// readLog parses the records of a JSON log file
+func readLog(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid log record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogRequestRedacts(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "run.json")
+	logger, err := newLogger(LogOptions{Format: "json", File: logFile}, &redactor{fields: []string{"email"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"email": "rex@example.com", "password": "hunter2", "name": "Rex"}`
+	req, _ := http.NewRequest(http.MethodPost, "http://api.valida.test/login?api_key=k-1&page=2", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer t-1")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Id", "r-1")
+	logger.forCase("login").LogRequest(req, body)
+	logger.Close()
+
+	records := readLog(t, logFile)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	record := records[0]
+	data, _ := json.Marshal(record)
+	for _, secret := range []string{"t-1", "k-1", "hunter2", "rex@example.com"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("the log contains %q: %s", secret, data)
+		}
+	}
+
+	headers, _ := record["headers"].(map[string]interface{})
+	if headers["Authorization"] != "Bearer ****" || headers["X-Request-Id"] != "r-1" {
+		t.Errorf("headers = %v, want the authorization masked and the other headers kept", headers)
+	}
+	if record["url"] != "http://api.valida.test/login?api_key=****&page=2" {
+		t.Errorf("url = %v, want the API key masked", record["url"])
+	}
+	if logged, _ := record["body"].(map[string]interface{}); logged["name"] != "Rex" || logged["password"] != maskedValue {
+		t.Errorf("body = %v, want the password masked and the name kept", record["body"])
+	}
+}
+
+func TestLoggerLevelAndCorrelationID(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "run.json")
+	logger, err := newLogger(LogOptions{Format: "json", Level: "warn", File: logFile}, &redactor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := logger.forCase("listPets"), logger.forCase("")
+	req, _ := http.NewRequest(http.MethodGet, "http://api.valida.test/pets", nil)
+	first.LogRequest(req, "")
+	first.LogResult("PASS")
+	first.LogWarning("attempt 1 failed, retrying")
+	first.LogResult("FAIL: status 500")
+	second.LogError(errors.New("no response"))
+	logger.Close()
+
+	records := readLog(t, logFile)
+	var levels []string
+	for _, record := range records {
+		levels = append(levels, record["level"].(string)+" "+record["msg"].(string))
+	}
+	if want := []string{"WARN attempt 1 failed, retrying", "ERROR result", "ERROR no response"}; strings.Join(levels, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("records = %v, want %v", levels, want)
+	}
+
+	if records[0]["correlation_id"] == "" || records[0]["correlation_id"] != records[1]["correlation_id"] {
+		t.Errorf("the records of a test case have correlation ids %v and %v", records[0]["correlation_id"], records[1]["correlation_id"])
+	}
+	if records[2]["correlation_id"] == records[0]["correlation_id"] {
+		t.Error("two test cases share a correlation id")
+	}
+	if records[0]["operation"] != "listPets" {
+		t.Errorf("operation = %v, want listPets", records[0]["operation"])
+	}
+	if _, ok := records[2]["operation"]; ok {
+		t.Error("a test case without operation has an operation attribute")
+	}
+
+	if _, err := newLogger(LogOptions{Level: "verbose", File: "none"}, &redactor{}); err == nil {
+		t.Error("newLogger() accepted an unknown level")
+	}
+}
@@ -0,0 +1,232 @@
+package apitest
+
+import (
+	"strings"
+)
+
+// isOpenAPI31 reports whether a decoded document declares OpenAPI 3.1
+func isOpenAPI31(document map[string]interface{}) bool {
+	version, _ := document["openapi"].(string)
+	return strings.HasPrefix(version, "3.1")
+}
+
+// downgradeOpenAPI31 returns an OpenAPI 3.0 copy of a 3.1 document so it can be
+// loaded and validated by the OpenAPI 3.0 loader. The JSON Schema 2020-12
+// keywords are rewritten to their closest 3.0 form or dropped; the original
+// document keeps them for data generation and response validation.
+func downgradeOpenAPI31(document map[string]interface{}) (map[string]interface{}, []string) {
+	var warnings []string
+	if webhooks, ok := document["webhooks"].(map[string]interface{}); ok && len(webhooks) > 0 {
+		warnings = append(warnings, "webhooks are documented but not tested")
+	}
+
+	downgraded, _ := downgradeNode(document, document, "", nil).(map[string]interface{})
+	downgraded["openapi"] = "3.0.3"
+	delete(downgraded, "webhooks")
+	delete(downgraded, "jsonSchemaDialect")
+	if _, ok := downgraded["paths"]; !ok {
+		downgraded["paths"] = map[string]interface{}{}
+	}
+	if info, ok := downgraded["info"].(map[string]interface{}); ok {
+		delete(info, "summary")
+		if license, ok := info["license"].(map[string]interface{}); ok {
+			delete(license, "identifier")
+		}
+	}
+
+	return downgraded, warnings
+}
+
+// Keywords of a schema whose values are schemas, lists of schemas, or maps
+// from names to schemas
+var (
+	subschemaKeywords = map[string]bool{
+		"items": true, "additionalProperties": true, "not": true, "contains": true,
+		"if": true, "then": true, "else": true, "propertyNames": true,
+		"unevaluatedItems": true, "unevaluatedProperties": true, "contentSchema": true,
+	}
+	subschemaListKeywords = map[string]bool{
+		"allOf": true, "anyOf": true, "oneOf": true, "prefixItems": true,
+	}
+	subschemaMapKeywords = map[string]bool{
+		"properties": true, "patternProperties": true, "$defs": true, "dependentSchemas": true,
+	}
+)
+
+// dropped2020Keywords have no OpenAPI 3.0 equivalent
+var dropped2020Keywords = []string{
+	"$defs", "$schema", "$id", "$anchor", "$comment", "$dynamicRef", "$dynamicAnchor",
+	"prefixItems", "contains", "minContains", "maxContains", "unevaluatedItems",
+	"unevaluatedProperties", "dependentRequired", "dependentSchemas", "propertyNames",
+	"patternProperties", "if", "then", "else", "contentMediaType", "contentEncoding",
+	"contentSchema",
+}
+
+// downgradeNode copies a part of the document that is not a schema, such as
+// a path item, parameter or media type, downgrading the schemas it holds
+func downgradeNode(document map[string]interface{}, node interface{}, key string, seen []string) interface{} {
+	switch v := node.(type) {
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = downgradeNode(document, item, key, seen)
+		}
+		return copied
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			switch {
+			case k == "schema":
+				copied[k] = downgradeSchema(document, item, seen)
+			case key == "components" && k == "schemas":
+				copied[k] = downgradeSchemaMap(document, item, seen)
+			case k == "example" || k == "examples" || strings.HasPrefix(k, "x-"):
+				// examples and extensions are kept as written
+				copied[k] = item
+			default:
+				copied[k] = downgradeNode(document, item, k, seen)
+			}
+		}
+		return copied
+	default:
+		return node
+	}
+}
+
+// downgradeSchema copies a schema, rewriting the 2020-12 keywords of the
+// schema and of its subschemas
+func downgradeSchema(document map[string]interface{}, node interface{}, seen []string) interface{} {
+	switch v := node.(type) {
+	case bool:
+		// Boolean schemas are not valid in OpenAPI 3.0
+		if v {
+			return map[string]interface{}{}
+		}
+		return map[string]interface{}{"not": map[string]interface{}{}}
+	case map[string]interface{}:
+		// References into $defs cannot be followed once $defs is dropped, so inline them
+		if ref, ok := v["$ref"].(string); ok && strings.Contains(ref, "/$defs/") {
+			for _, s := range seen {
+				if s == ref {
+					return map[string]interface{}{}
+				}
+			}
+			resolved := resolveSchema(document, map[string]interface{}{"$ref": ref})
+			if _, unresolved := resolved["$ref"]; !unresolved {
+				return downgradeSchema(document, resolved, append(seen, ref))
+			}
+		}
+
+		copied := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			switch {
+			case k == "additionalProperties":
+				// additionalProperties may still be a boolean in OpenAPI 3.0
+				if _, ok := item.(bool); ok {
+					copied[k] = item
+				} else {
+					copied[k] = downgradeSchema(document, item, seen)
+				}
+			case subschemaKeywords[k]:
+				copied[k] = downgradeSchema(document, item, seen)
+			case subschemaListKeywords[k]:
+				copied[k] = downgradeSchemaList(document, item, seen)
+			case subschemaMapKeywords[k]:
+				copied[k] = downgradeSchemaMap(document, item, seen)
+			default:
+				copied[k] = item
+			}
+		}
+		downgradeSchemaKeywords(copied)
+		return copied
+	default:
+		return node
+	}
+}
+
+// downgradeSchemaList copies a list of schemas, such as the members of allOf
+func downgradeSchemaList(document map[string]interface{}, node interface{}, seen []string) interface{} {
+	schemas, ok := node.([]interface{})
+	if !ok {
+		return node
+	}
+	copied := make([]interface{}, len(schemas))
+	for i, schema := range schemas {
+		copied[i] = downgradeSchema(document, schema, seen)
+	}
+	return copied
+}
+
+// downgradeSchemaMap copies a map from names to schemas, such as properties
+func downgradeSchemaMap(document map[string]interface{}, node interface{}, seen []string) interface{} {
+	schemas, ok := node.(map[string]interface{})
+	if !ok {
+		return node
+	}
+	copied := make(map[string]interface{}, len(schemas))
+	for name, schema := range schemas {
+		copied[name] = downgradeSchema(document, schema, seen)
+	}
+	return copied
+}
+
+// downgradeSchemaKeywords rewrites the 2020-12 keywords of a single schema object in place
+func downgradeSchemaKeywords(schema map[string]interface{}) {
+	if types, ok := schema["type"].([]interface{}); ok {
+		var remaining []interface{}
+		for _, t := range types {
+			if t == "null" {
+				schema["nullable"] = true
+				continue
+			}
+			remaining = append(remaining, t)
+		}
+		switch len(remaining) {
+		case 0:
+			delete(schema, "type")
+		case 1:
+			schema["type"] = remaining[0]
+		default:
+			delete(schema, "type")
+			anyOf := make([]interface{}, len(remaining))
+			for i, t := range remaining {
+				anyOf[i] = map[string]interface{}{"type": t}
+			}
+			schema["anyOf"] = anyOf
+		}
+	}
+
+	if value, ok := schema["const"]; ok {
+		schema["enum"] = []interface{}{value}
+		delete(schema, "const")
+	}
+
+	for _, bound := range []string{"Minimum", "Maximum"} {
+		if limit, ok := schema["exclusive"+bound].(float64); ok {
+			schema[strings.ToLower(bound)] = limit
+			schema["exclusive"+bound] = true
+		}
+	}
+
+	if examples, ok := schema["examples"].([]interface{}); ok {
+		if len(examples) > 0 {
+			if _, exists := schema["example"]; !exists {
+				schema["example"] = examples[0]
+			}
+		}
+		delete(schema, "examples")
+	}
+
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		if not, ok := items["not"].(map[string]interface{}); ok && len(not) == 0 && len(items) == 1 {
+			delete(schema, "items")
+		}
+	}
+	if prefixItems, ok := schema["prefixItems"].([]interface{}); ok && schema["items"] == nil && schema["type"] == "array" {
+		schema["items"] = map[string]interface{}{"anyOf": prefixItems}
+	}
+
+	for _, keyword := range dropped2020Keywords {
+		delete(schema, keyword)
+	}
+}
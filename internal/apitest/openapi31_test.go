@@ -0,0 +1,141 @@
+package apitest
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/invopop/yaml"
+)
+
+const openAPI31Spec = `openapi: 3.1.0
+info:
+  title: Shapes
+  version: "1.0"
+  summary: Shapes of all kinds
+servers:
+  - url: http://localhost
+paths:
+  /shapes:
+    get:
+      operationId: listShapes
+      parameters:
+        - $ref: "#/components/parameters/if"
+      responses:
+        "200":
+          description: Shapes
+          headers:
+            contains:
+              schema:
+                type: integer
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Shape"
+              examples:
+                not:
+                  value: {contains: [1]}
+components:
+  parameters:
+    if:
+      name: if
+      in: query
+      schema:
+        type: [string, "null"]
+  schemas:
+    Shape:
+      type: object
+      $defs:
+        side:
+          type: number
+          exclusiveMinimum: 0
+      properties:
+        contains:
+          type: array
+          items:
+            $ref: "#/components/schemas/Shape/$defs/side"
+          contains:
+            const: 1
+        if:
+          const: square
+        kind:
+          oneOf:
+            - type: [string, "null"]
+            - type: integer
+      additionalProperties: false
+`
+
+func TestDowngradeOpenAPI31(t *testing.T) {
+	var document map[string]interface{}
+	if err := yaml.Unmarshal([]byte(openAPI31Spec), &document); err != nil {
+		t.Fatal(err)
+	}
+	downgraded, warnings := downgradeOpenAPI31(document)
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v", warnings)
+	}
+
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"/openapi", "3.0.3"},
+		{"/components/parameters/if/name", "if"},
+		{"/components/parameters/if/schema", map[string]interface{}{"type": "string", "nullable": true}},
+		{"/paths/~1shapes/get/responses/200/headers/contains/schema/type", "integer"},
+		{"/paths/~1shapes/get/responses/200/content/application~1json/examples/not/value", map[string]interface{}{"contains": []interface{}{1.0}}},
+		{"/components/schemas/Shape/properties/contains/type", "array"},
+		{"/components/schemas/Shape/properties/contains/items", map[string]interface{}{"type": "number", "minimum": 0.0, "exclusiveMinimum": true}},
+		{"/components/schemas/Shape/properties/if", map[string]interface{}{"enum": []interface{}{"square"}}},
+		{"/components/schemas/Shape/properties/kind/oneOf/0", map[string]interface{}{"type": "string", "nullable": true}},
+		{"/components/schemas/Shape/additionalProperties", false},
+	}
+	for _, tt := range tests {
+		if got := lookupPointer(t, downgraded, tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.path, got, tt.want)
+		}
+	}
+
+	shape := lookupPointer(t, downgraded, "/components/schemas/Shape").(map[string]interface{})
+	contains := shape["properties"].(map[string]interface{})["contains"].(map[string]interface{})
+	for _, dropped := range []interface{}{shape["$defs"], contains["contains"]} {
+		if dropped != nil {
+			t.Errorf("a 2020-12 keyword was kept: %v", dropped)
+		}
+	}
+	if _, ok := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})["Shape"].(map[string]interface{})["$defs"]; !ok {
+		t.Error("the original document was changed")
+	}
+}
+
+func TestLoadOpenAPI31Spec(t *testing.T) {
+	apiSpec := loadTestSpec(t, openAPI31Spec)
+	operation := apiSpec.Paths["/shapes"].Operations["get"]
+	if operation == nil || len(operation.Parameters) != 1 || operation.Parameters[0]["name"] != "if" {
+		t.Fatalf("operation = %+v, want the if query parameter", operation)
+	}
+}
+
+// lookupPointer returns the value at a JSON pointer of a decoded document
+func lookupPointer(t *testing.T, doc interface{}, pointer string) interface{} {
+	t.Helper()
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range tokens {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			doc = v[token]
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(v) {
+				t.Fatalf("%s: invalid index %q", pointer, token)
+			}
+			doc = v[index]
+		default:
+			t.Fatalf("%s: %q is not in an object or array", pointer, token)
+		}
+	}
+	return doc
+}
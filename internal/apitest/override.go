@@ -0,0 +1,311 @@
+package apitest
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+var templatePattern = regexp.MustCompile(`\{\{\s*([a-zA-Z]+)\.([a-zA-Z0-9_:,\-]+)\s*\}\}`)
+
+// findOperationConfig returns the configured overrides for an operation,
+// matched by operationId first and then by "METHOD /path"
+func (c *Config) findOperationConfig(path string, operation *Operation) *OperationConfig {
+	if c == nil || len(c.Operations) == 0 {
+		return nil
+	}
+
+	methodPath := strings.ToUpper(operation.Method) + " " + path
+	for key, opConfig := range c.Operations {
+		if operation.OperationID != "" && strings.EqualFold(key, operation.OperationID) {
+			return opConfig
+		}
+	}
+	for key, opConfig := range c.Operations {
+		if strings.EqualFold(key, methodPath) {
+			return opConfig
+		}
+	}
+	return nil
+}
+
+// lookupParameter returns the value configured for a parameter, consulting the
+// operation overrides before the fixture files
+func (r *Runner) lookupParameter(opConfig *OperationConfig, in, name string) (interface{}, bool) {
+	if opConfig != nil {
+		if value, ok := lookupKey(opConfig.Parameters[in], name); ok {
+			return renderTemplate(r.fake, value), true
+		}
+	}
+	for _, fixture := range r.config.fixtures {
+		if value, ok := lookupKey(fixture.Parameters, name); ok {
+			return renderTemplate(r.fake, value), true
+		}
+	}
+	return nil, false
+}
+
+// lookupBodyField returns the value configured for a top level body field,
+// consulting the operation overrides before the fixture files
+func (r *Runner) lookupBodyField(opConfig *OperationConfig, name string) (interface{}, bool) {
+	if opConfig != nil {
+		if value, ok := lookupKey(opConfig.Body, name); ok {
+			return renderTemplate(r.fake, value), true
+		}
+	}
+	for _, fixture := range r.config.fixtures {
+		if value, ok := lookupKey(fixture.Body, name); ok {
+			return renderTemplate(r.fake, value), true
+		}
+	}
+	return nil, false
+}
+
+// applyBodyOverrides adds the configured body fields that are not part of the
+// schema and applies the configured JSON pointer patches
+func applyBodyOverrides(fake *gofakeit.Faker, opConfig *OperationConfig, body map[string]interface{}) (map[string]interface{}, error) {
+	if opConfig == nil {
+		return body, nil
+	}
+
+	for key, value := range opConfig.Body {
+		if _, ok := lookupKey(body, key); !ok {
+			body[key] = renderTemplate(fake, value)
+		}
+	}
+
+	var doc interface{} = body
+	for _, patch := range opConfig.Patch {
+		var err error
+		doc, err = applyPatch(fake, doc, patch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	patched, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("patched request body is not an object")
+	}
+	return patched, nil
+}
+
+func lookupKey(m map[string]interface{}, name string) (interface{}, bool) {
+	if value, ok := m[name]; ok {
+		return value, true
+	}
+	for key, value := range m {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// renderTemplate expands {{env.NAME}} and {{faker.function}} placeholders in
+// string values, recursing into maps and slices
+func renderTemplate(fake *gofakeit.Faker, value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return templatePattern.ReplaceAllStringFunc(v, func(match string) string {
+			parts := templatePattern.FindStringSubmatch(match)
+			switch strings.ToLower(parts[1]) {
+			case "env":
+				return os.Getenv(parts[2])
+			case "faker":
+				name := strings.ToLower(parts[2])
+				if gofakeit.GetFuncLookup(strings.SplitN(name, ":", 2)[0]) == nil {
+					return match
+				}
+				generated, err := fake.Generate("{" + name + "}")
+				if err != nil {
+					return match
+				}
+				return generated
+			}
+			return match
+		})
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered[key] = renderTemplate(fake, item)
+		}
+		return rendered
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered[i] = renderTemplate(fake, item)
+		}
+		return rendered
+	default:
+		return value
+	}
+}
+
+// applyPatch applies a single add, replace or remove operation addressed by a JSON pointer
+func applyPatch(fake *gofakeit.Faker, doc interface{}, patch PatchOperation) (interface{}, error) {
+	tokens, err := parsePointer(patch.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	op := strings.ToLower(patch.Op)
+	if op == "" {
+		op = "replace"
+	}
+	if op != "add" && op != "replace" && op != "remove" {
+		return nil, fmt.Errorf("unsupported patch operation %q", patch.Op)
+	}
+
+	if len(tokens) == 0 {
+		if op == "remove" {
+			return nil, fmt.Errorf("cannot remove the whole request body")
+		}
+		return renderTemplate(fake, patch.Value), nil
+	}
+
+	parent := doc
+	for _, token := range tokens[:len(tokens)-1] {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			child, ok := p[token]
+			if !ok {
+				if op != "add" {
+					return nil, fmt.Errorf("patch path %s not found", patch.Path)
+				}
+				child = make(map[string]interface{})
+				p[token] = child
+			}
+			parent = child
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(p) {
+				return nil, fmt.Errorf("patch path %s has invalid array index %q", patch.Path, token)
+			}
+			parent = p[index]
+		default:
+			return nil, fmt.Errorf("patch path %s traverses a scalar value", patch.Path)
+		}
+	}
+
+	last := tokens[len(tokens)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := p[last]; !ok && op != "add" {
+			return nil, fmt.Errorf("patch path %s not found", patch.Path)
+		}
+		if op == "remove" {
+			delete(p, last)
+		} else {
+			p[last] = renderTemplate(fake, patch.Value)
+		}
+	case []interface{}:
+		index, err := strconv.Atoi(last)
+		if last == "-" {
+			index = len(p)
+		} else if err != nil || index < 0 || index > len(p) || (op != "add" && index == len(p)) {
+			return nil, fmt.Errorf("patch path %s has invalid array index %q", patch.Path, last)
+		}
+		var updated []interface{}
+		switch op {
+		case "add":
+			updated = append(append(append([]interface{}{}, p[:index]...), renderTemplate(fake, patch.Value)), p[index:]...)
+		case "replace":
+			p[index] = renderTemplate(fake, patch.Value)
+			updated = p
+		case "remove":
+			updated = append(append([]interface{}{}, p[:index]...), p[index+1:]...)
+		}
+		return setPointer(doc, tokens[:len(tokens)-1], updated)
+	default:
+		return nil, fmt.Errorf("patch path %s traverses a scalar value", patch.Path)
+	}
+
+	return doc, nil
+}
+
+func setPointer(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		child, err := setPointer(d[tokens[0]], tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		d[tokens[0]] = child
+		return d, nil
+	case []interface{}:
+		index, err := strconv.Atoi(tokens[0])
+		if err != nil || index < 0 || index >= len(d) {
+			return nil, fmt.Errorf("invalid array index %q", tokens[0])
+		}
+		child, err := setPointer(d[index], tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		d[index] = child
+		return d, nil
+	default:
+		return nil, fmt.Errorf("cannot traverse a scalar value")
+	}
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+	return tokens, nil
+}
+
+// formatValue converts a configured value into its string form for use in parameters
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// coerceToSchemaType converts string values, such as CSV cells or rendered
+// templates, into the primitive type declared by the schema
+func coerceToSchemaType(value interface{}, schema map[string]interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	switch primaryType(schema) {
+	case "integer":
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return value
+}
@@ -0,0 +1,185 @@
+package apitest
+
+import (
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+func TestApplyPatch(t *testing.T) {
+	newBody := func() map[string]interface{} {
+		return map[string]interface{}{
+			"customer": map[string]interface{}{"id": "c-1", "email": "rex@example.com"},
+			"items":    []interface{}{"a", "b"},
+			"a/b":      1.0,
+		}
+	}
+	tests := []struct {
+		name  string
+		patch PatchOperation
+		path  string
+		want  interface{}
+	}{
+		{"replace by default", PatchOperation{Path: "/customer/id", Value: "c-2"}, "/customer/id", "c-2"},
+		{"add creates parents", PatchOperation{Op: "add", Path: "/shipping/address/zipCode", Value: "12345"}, "/shipping", map[string]interface{}{"address": map[string]interface{}{"zipCode": "12345"}}},
+		{"remove", PatchOperation{Op: "remove", Path: "/customer/email"}, "/customer", map[string]interface{}{"id": "c-1"}},
+		{"append to an array", PatchOperation{Op: "add", Path: "/items/-", Value: "c"}, "/items", []interface{}{"a", "b", "c"}},
+		{"insert into an array", PatchOperation{Op: "add", Path: "/items/0", Value: "z"}, "/items", []interface{}{"z", "a", "b"}},
+		{"replace in an array", PatchOperation{Op: "replace", Path: "/items/1", Value: "y"}, "/items", []interface{}{"a", "y"}},
+		{"remove from an array", PatchOperation{Op: "remove", Path: "/items/0"}, "/items", []interface{}{"b"}},
+		{"escaped pointer", PatchOperation{Path: "/a~1b", Value: 2.0}, "/a~1b", 2.0},
+		{"whole body", PatchOperation{Path: "", Value: map[string]interface{}{"id": "x"}}, "/id", "x"},
+	}
+	fake := gofakeit.New(1)
+	for _, tt := range tests {
+		got, err := applyPatch(fake, newBody(), tt.patch)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if value := lookupPointer(t, got, tt.path); !reflect.DeepEqual(value, tt.want) {
+			t.Errorf("%s: %s = %#v, want %#v", tt.name, tt.path, value, tt.want)
+		}
+	}
+
+	failures := []struct {
+		patch PatchOperation
+		want  string
+	}{
+		{PatchOperation{Op: "move", Path: "/customer"}, `unsupported patch operation "move"`},
+		{PatchOperation{Op: "replace", Path: "/missing/id", Value: 1}, "patch path /missing/id not found"},
+		{PatchOperation{Op: "remove", Path: "/customer/name"}, "patch path /customer/name not found"},
+		{PatchOperation{Op: "remove"}, "cannot remove the whole request body"},
+		{PatchOperation{Op: "replace", Path: "/items/2", Value: "c"}, `invalid array index "2"`},
+		{PatchOperation{Op: "add", Path: "/customer/id/x", Value: 1}, "traverses a scalar value"},
+		{PatchOperation{Path: "customer"}, `invalid JSON pointer "customer"`},
+	}
+	for _, tt := range failures {
+		if _, err := applyPatch(fake, newBody(), tt.patch); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("applyPatch(%+v) error = %v, want %q", tt.patch, err, tt.want)
+		}
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	t.Setenv("VALIDA_TEST_SKU", "SKU-1")
+	fake := gofakeit.New(1)
+
+	got := renderTemplate(fake, map[string]interface{}{
+		"sku":     "{{ env.VALIDA_TEST_SKU }}",
+		"prefix":  "id-{{env.VALIDA_TEST_SKU}}",
+		"id":      "{{faker.uuid}}",
+		"unknown": "{{faker.nothing}}",
+		"list":    []interface{}{"{{env.VALIDA_TEST_SKU}}", 3.0},
+	}).(map[string]interface{})
+
+	if got["sku"] != "SKU-1" || got["prefix"] != "id-SKU-1" {
+		t.Errorf("env templates = %v, %v", got["sku"], got["prefix"])
+	}
+	if id, _ := got["id"].(string); len(id) != 36 || strings.Contains(id, "{") {
+		t.Errorf("faker.uuid = %q, want a UUID", got["id"])
+	}
+	if got["unknown"] != "{{faker.nothing}}" {
+		t.Errorf("unknown faker function = %q, want the template kept", got["unknown"])
+	}
+	if !reflect.DeepEqual(got["list"], []interface{}{"SKU-1", 3.0}) {
+		t.Errorf("list = %v, want its strings rendered", got["list"])
+	}
+}
+
+func TestFindOperationConfig(t *testing.T) {
+	byID, byPath := &OperationConfig{Data: "id"}, &OperationConfig{Data: "path"}
+	cfg := &Config{Operations: map[string]*OperationConfig{"GetOrder": byID, "get /orders/{orderId}": byPath}}
+
+	tests := []struct {
+		path      string
+		operation *Operation
+		want      *OperationConfig
+	}{
+		{"/orders/{orderId}", &Operation{Method: "get", OperationID: "getOrder"}, byID},
+		{"/orders/{orderId}", &Operation{Method: "get"}, byPath},
+		{"/orders/{orderId}", &Operation{Method: "delete", OperationID: "deleteOrder"}, nil},
+	}
+	for _, tt := range tests {
+		if got := cfg.findOperationConfig(tt.path, tt.operation); got != tt.want {
+			t.Errorf("findOperationConfig(%s %s) = %+v, want %+v", tt.operation.Method, tt.path, got, tt.want)
+		}
+	}
+	if got := (*Config)(nil).findOperationConfig("/orders", &Operation{Method: "get"}); got != nil {
+		t.Errorf("findOperationConfig() without config = %+v", got)
+	}
+}
+
+const orderSpec = `openapi: 3.0.3
+info:
+  title: Orders
+  version: "1.0"
+servers:
+  - url: http://localhost
+paths:
+  /orders/{orderId}:
+    get:
+      parameters:
+        - name: orderId
+          in: path
+          required: true
+          schema:
+            type: integer
+        - name: status
+          in: query
+          schema:
+            type: string
+        - name: X-Tenant
+          in: header
+          schema:
+            type: string
+        - name: session
+          in: cookie
+          schema:
+            type: string
+      responses:
+        "200":
+          description: Order
+`
+
+func TestParameterOverridesAndFixtures(t *testing.T) {
+	t.Setenv("VALIDA_TEST_ORDER", "1001")
+	dir := writeTestFiles(t, map[string]string{
+		"valida.yaml": `fixtures: [shared.yaml]
+operations:
+  GET /orders/{orderId}:
+    parameters:
+      path:
+        orderId: "{{env.VALIDA_TEST_ORDER}}"
+      header:
+        X-Tenant: acme
+      cookie:
+        session: s-1
+`,
+		"shared.yaml": `parameters:
+  status: shipped
+  X-Tenant: ignored
+`,
+	})
+	server, requests := recordingService(t, http.StatusOK, `{}`)
+
+	runTestConfig(t, orderSpec, server, filepath.Join(dir, "valida.yaml"))
+
+	sent := requests()
+	if len(sent) != 1 {
+		t.Fatalf("got %d requests, want 1", len(sent))
+	}
+	if sent[0].uri != "/orders/1001?status=shipped" {
+		t.Errorf("request URI = %q, want the configured path and fixture query parameters", sent[0].uri)
+	}
+	if got := sent[0].header.Get("X-Tenant"); got != "acme" {
+		t.Errorf("X-Tenant = %q, want the operation override before the fixture", got)
+	}
+	if got := sent[0].header.Get("Cookie"); got != "session=s-1" {
+		t.Errorf("Cookie = %q, want the configured cookie parameter", got)
+	}
+}
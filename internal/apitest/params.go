@@ -0,0 +1,224 @@
+package apitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// parameterSchema returns the schema of a parameter, taken from its content
+// media type when the parameter uses content instead of schema
+func parameterSchema(param map[string]interface{}) map[string]interface{} {
+	if schema, ok := param["schema"].(map[string]interface{}); ok {
+		return schema
+	}
+	if content, ok := param["content"].(map[string]interface{}); ok {
+		for _, mediaType := range content {
+			if mediaTypeMap, ok := mediaType.(map[string]interface{}); ok {
+				if schema, ok := mediaTypeMap["schema"].(map[string]interface{}); ok {
+					return schema
+				}
+			}
+		}
+	}
+	return map[string]interface{}{}
+}
+
+// fakeParameterValue generates a value for a query, header or cookie parameter.
+// Arrays and objects are generated from their schema.
+func fakeParameterValue(fake *gofakeit.Faker, name string, schema map[string]interface{}) interface{} {
+	if name == "page" {
+		return "1"
+	}
+	switch primaryType(schema) {
+	case "string":
+		return fakeString(fake)
+	case "integer":
+		return fakeInt(fake)
+	default:
+		return fakeSchemaValue(fake, schema)
+	}
+}
+
+// serializeParameter renders a parameter value following its style, explode,
+// allowReserved and content settings. Query parameters are returned as a
+// complete query string fragment, path parameters as the text replacing the
+// template and header and cookie parameters as their value.
+func serializeParameter(param map[string]interface{}, value interface{}) string {
+	name, _ := param["name"].(string)
+	in, _ := param["in"].(string)
+
+	if content, ok := param["content"].(map[string]interface{}); ok && len(content) > 0 {
+		encoded, _ := json.Marshal(value)
+		if in == "query" {
+			return url.QueryEscape(name) + "=" + url.QueryEscape(string(encoded))
+		}
+		if in == "path" {
+			return url.PathEscape(string(encoded))
+		}
+		return string(encoded)
+	}
+
+	style, _ := param["style"].(string)
+	if style == "" {
+		switch in {
+		case "query", "cookie":
+			style = "form"
+		default:
+			style = "simple"
+		}
+	}
+
+	explode := style == "form"
+	if v, ok := param["explode"].(bool); ok {
+		explode = v
+	}
+	allowReserved, _ := param["allowReserved"].(bool)
+
+	escape := func(s string) string {
+		switch in {
+		case "query":
+			if allowReserved {
+				return escapeAllowReserved(s)
+			}
+			return url.QueryEscape(s)
+		case "path":
+			return url.PathEscape(s)
+		}
+		return s
+	}
+
+	var items []string
+	var keys []string
+	object := false
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			items = append(items, escape(formatValue(item)))
+		}
+	case map[string]interface{}:
+		object = true
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			items = append(items, escape(formatValue(v[key])))
+		}
+		for i := range keys {
+			keys[i] = escape(keys[i])
+		}
+	default:
+		primitive := escape(formatValue(value))
+		switch style {
+		case "label":
+			return "." + primitive
+		case "matrix":
+			return ";" + name + "=" + primitive
+		case "form", "spaceDelimited", "pipeDelimited", "deepObject":
+			if in == "query" {
+				return escape(name) + "=" + primitive
+			}
+		}
+		return primitive
+	}
+
+	// pairs joins object keys and values, as key=value when exploded or as key,value otherwise
+	pairs := func(separator string) []string {
+		joined := make([]string, len(keys))
+		for i := range keys {
+			joined[i] = keys[i] + separator + items[i]
+		}
+		return joined
+	}
+	flat := items
+	if object {
+		flat = pairs(",")
+	}
+
+	switch style {
+	case "label":
+		if explode {
+			if object {
+				return "." + strings.Join(pairs("="), ".")
+			}
+			return "." + strings.Join(items, ".")
+		}
+		return "." + strings.Join(flat, ",")
+	case "matrix":
+		if explode {
+			if object {
+				return ";" + strings.Join(pairs("="), ";")
+			}
+			exploded := make([]string, len(items))
+			for i, item := range items {
+				exploded[i] = name + "=" + item
+			}
+			return ";" + strings.Join(exploded, ";")
+		}
+		return ";" + name + "=" + strings.Join(flat, ",")
+	case "form":
+		if in != "query" {
+			return strings.Join(flat, ",")
+		}
+		if explode {
+			if object {
+				return strings.Join(pairs("="), "&")
+			}
+			return joinQuery(escape(name), items)
+		}
+		return escape(name) + "=" + strings.Join(flat, ",")
+	case "spaceDelimited", "pipeDelimited":
+		if explode && !object {
+			return joinQuery(escape(name), items)
+		}
+		delimiter := "%20"
+		if style == "pipeDelimited" {
+			delimiter = "|"
+		}
+		if object {
+			flat = pairs(delimiter)
+		}
+		return escape(name) + "=" + strings.Join(flat, delimiter)
+	case "deepObject":
+		if !object {
+			return joinQuery(escape(name), items)
+		}
+		deep := make([]string, len(keys))
+		for i := range keys {
+			deep[i] = fmt.Sprintf("%s%%5B%s%%5D=%s", escape(name), keys[i], items[i])
+		}
+		return strings.Join(deep, "&")
+	default:
+		if explode && object {
+			return strings.Join(pairs("="), ",")
+		}
+		return strings.Join(flat, ",")
+	}
+}
+
+func joinQuery(name string, items []string) string {
+	exploded := make([]string, len(items))
+	for i, item := range items {
+		exploded[i] = name + "=" + item
+	}
+	return strings.Join(exploded, "&")
+}
+
+// escapeAllowReserved percent-encodes a query value while keeping the
+// characters reserved by RFC 3986, as requested by allowReserved
+func escapeAllowReserved(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(":/?#[]@!$&'()*+,;=", r) {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteString(url.QueryEscape(string(r)))
+	}
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package apitest
+
+import "testing"
+
+func TestSerializeParameter(t *testing.T) {
+	color := []interface{}{"blue", "black", "brown"}
+	rgb := map[string]interface{}{"R": float64(100), "G": float64(200), "B": float64(150)}
+
+	tests := []struct {
+		name  string
+		param map[string]interface{}
+		value interface{}
+		want  string
+	}{
+		{"path simple primitive", param("path", "", nil), "blue", "blue"},
+		{"path simple array", param("path", "", nil), color, "blue,black,brown"},
+		{"path simple object", param("path", "", nil), rgb, "B,150,G,200,R,100"},
+		{"path simple exploded object", param("path", "", true), rgb, "B=150,G=200,R=100"},
+		{"path escapes values", param("path", "", nil), "a/b c", "a%2Fb%20c"},
+		{"label primitive", param("path", "label", nil), "blue", ".blue"},
+		{"label array", param("path", "label", nil), color, ".blue,black,brown"},
+		{"label exploded array", param("path", "label", true), color, ".blue.black.brown"},
+		{"label object", param("path", "label", nil), rgb, ".B,150,G,200,R,100"},
+		{"label exploded object", param("path", "label", true), rgb, ".B=150.G=200.R=100"},
+		{"matrix primitive", param("path", "matrix", nil), "blue", ";color=blue"},
+		{"matrix array", param("path", "matrix", nil), color, ";color=blue,black,brown"},
+		{"matrix exploded array", param("path", "matrix", true), color, ";color=blue;color=black;color=brown"},
+		{"matrix object", param("path", "matrix", nil), rgb, ";color=B,150,G,200,R,100"},
+		{"matrix exploded object", param("path", "matrix", true), rgb, ";B=150;G=200;R=100"},
+		{"query form primitive", param("query", "", nil), "x y", "color=x+y"},
+		{"query form array", param("query", "", nil), color, "color=blue&color=black&color=brown"},
+		{"query form unexploded array", param("query", "form", false), color, "color=blue,black,brown"},
+		{"query form object", param("query", "", nil), rgb, "B=150&G=200&R=100"},
+		{"query form unexploded object", param("query", "form", false), rgb, "color=B,150,G,200,R,100"},
+		{"query spaceDelimited array", param("query", "spaceDelimited", false), color, "color=blue%20black%20brown"},
+		{"query pipeDelimited array", param("query", "pipeDelimited", false), color, "color=blue|black|brown"},
+		{"query pipeDelimited exploded array", param("query", "pipeDelimited", true), color, "color=blue&color=black&color=brown"},
+		{"query deepObject", param("query", "deepObject", true), rgb, "color%5BB%5D=150&color%5BG%5D=200&color%5BR%5D=100"},
+		{"query escapes reserved characters", param("query", "", nil), "a/b?c", "color=a%2Fb%3Fc"},
+		{"query allowReserved", withField(param("query", "", nil), "allowReserved", true), "a/b?c d", "color=a/b?c+d"},
+		{"header simple array", param("header", "", nil), color, "blue,black,brown"},
+		{"header exploded object", param("header", "", true), rgb, "B=150,G=200,R=100"},
+		{"cookie form primitive", param("cookie", "", nil), "blue", "blue"},
+		{"cookie form array", param("cookie", "form", false), color, "blue,black,brown"},
+		{"query content", contentParam("query"), map[string]interface{}{"a": float64(1)}, "color=%7B%22a%22%3A1%7D"},
+		{"header content", contentParam("header"), map[string]interface{}{"a": float64(1)}, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serializeParameter(tt.param, tt.value); got != tt.want {
+				t.Errorf("serializeParameter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// param returns a parameter named color, with explode left unset when nil
+func param(in, style string, explode interface{}) map[string]interface{} {
+	p := map[string]interface{}{"name": "color", "in": in}
+	if style != "" {
+		p["style"] = style
+	}
+	if explode != nil {
+		p["explode"] = explode
+	}
+	return p
+}
+
+func withField(p map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	p[key] = value
+	return p
+}
+
+func contentParam(in string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":    "color",
+		"in":      in,
+		"content": map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{"type": "object"}}},
+	}
+}
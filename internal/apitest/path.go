@@ -3,10 +3,14 @@ package apitest
 import (
 	"fmt"
 	"strings"
-
-	"github.com/spf13/viper"
+	"time"
 )
 
+var httpMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
 // PathItem represents a path in the API specification
 type PathItem struct {
 	Path       string
@@ -16,13 +20,17 @@ type PathItem struct {
 // Operation represents an operation in the API specification
 type Operation struct {
 	Method      string
+	OperationID string
+	Tags        []string
+	MaxLatency  time.Duration
+	Scripts     *Scripts
 	Parameters  []map[string]interface{}
 	RequestBody map[string]interface{}
 	Responses   map[string]map[string]interface{}
 }
 
 func processPaths(apiSpec *APISpec) error {
-	paths := viper.GetStringMap("paths")
+	paths, _ := inlineRefs(apiSpec.Document, apiSpec.Document["paths"], nil).(map[string]interface{})
 
 	for path, pathMap := range paths {
 		pathItem := &PathItem{
@@ -48,7 +56,13 @@ func processPaths(apiSpec *APISpec) error {
 }
 
 func processOperations(pathItem *PathItem, pathMaps map[string]interface{}) error {
+	pathParameters, _ := pathMaps["parameters"].([]interface{})
+
 	for method, operationMap := range pathMaps {
+		if !httpMethods[strings.ToLower(method)] {
+			continue
+		}
+
 		operation := &Operation{
 			Method: method,
 		}
@@ -61,6 +75,7 @@ func processOperations(pathItem *PathItem, pathMaps map[string]interface{}) erro
 		if err := processOperationDetails(operation, operationMaps); err != nil {
 			return err
 		}
+		mergePathParameters(operation, pathParameters)
 
 		pathItem.Operations[method] = operation
 	}
@@ -68,9 +83,53 @@ func processOperations(pathItem *PathItem, pathMaps map[string]interface{}) erro
 	return nil
 }
 
+// mergePathParameters adds the parameters declared on the path item that the
+// operation does not override
+func mergePathParameters(operation *Operation, pathParameters []interface{}) {
+	for _, param := range pathParameters {
+		paramMap, ok := param.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		overridden := false
+		for _, existing := range operation.Parameters {
+			if existing["name"] == paramMap["name"] && existing["in"] == paramMap["in"] {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			operation.Parameters = append(operation.Parameters, paramMap)
+		}
+	}
+}
+
 func processOperationDetails(operation *Operation, operationMaps map[string]interface{}) error {
 	for k, v := range operationMaps {
 		switch strings.ToLower(k) {
+		case "operationid":
+			if operationID, ok := v.(string); ok {
+				operation.OperationID = operationID
+			}
+		case "x-valida-max-latency":
+			latency, err := parseLatency(v)
+			if err != nil {
+				return fmt.Errorf("x-valida-max-latency of %s: %w", operation.Method, err)
+			}
+			operation.MaxLatency = latency
+		case "x-valida-script":
+			scripts, err := parseScripts(v)
+			if err != nil {
+				return fmt.Errorf("x-valida-script of %s: %w", operation.Method, err)
+			}
+			operation.Scripts = scripts
+		case "tags":
+			if tags, ok := v.([]interface{}); ok {
+				for _, tag := range tags {
+					operation.Tags = append(operation.Tags, fmt.Sprint(tag))
+				}
+			}
 		case "parameters":
 			if params, ok := v.([]interface{}); ok {
 				operation.Parameters = make([]map[string]interface{}, len(params))
@@ -98,3 +157,36 @@ func processOperationDetails(operation *Operation, operationMaps map[string]inte
 
 	return nil
 }
+
+// inlineRefs returns a copy of a document node with every local $ref replaced
+// by its target. Recursive references are left in place.
+func inlineRefs(document map[string]interface{}, node interface{}, seen []string) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok && strings.HasPrefix(ref, "#/") {
+			for _, s := range seen {
+				if s == ref {
+					return v
+				}
+			}
+			resolved := resolveSchema(document, map[string]interface{}{"$ref": ref})
+			if _, unresolved := resolved["$ref"]; unresolved {
+				return v
+			}
+			return inlineRefs(document, resolved, append(seen, ref))
+		}
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = inlineRefs(document, item, seen)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = inlineRefs(document, item, seen)
+		}
+		return copied
+	default:
+		return node
+	}
+}
@@ -0,0 +1,266 @@
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+type exchangeKey struct{}
+
+// exchange represents a request passing through the proxy and what was found
+// while checking it against the spec
+type exchange struct {
+	path        string
+	operation   *Operation
+	requestBody []byte
+	problems    []string
+}
+
+// ContractProxy forwards traffic to a service and checks every request and
+// response against the spec, optionally recording the exchanges as a scenario
+type ContractProxy struct {
+	runner  *Runner
+	apiSpec *APISpec
+	target  *url.URL
+	proxy   *httputil.ReverseProxy
+
+	mu           sync.Mutex
+	recording    *Scenario
+	passed       int
+	failed       int
+	undocumented int
+}
+
+// NewContractProxy creates a proxy in front of the target service, forwarding
+// traffic with the transport of the runner. When record is set, every exchange
+// is kept so it can be saved with Recording.
+func NewContractProxy(runner *Runner, apiSpec *APISpec, target *url.URL, record bool) *ContractProxy {
+	p := &ContractProxy{runner: runner, apiSpec: apiSpec, target: target}
+	if record {
+		p.recording = &Scenario{
+			Name:      "Recorded traffic for " + target.String(),
+			Variables: map[string]string{"baseUrl": strings.TrimSuffix(target.String(), "/")},
+		}
+	}
+
+	p.proxy = httputil.NewSingleHostReverseProxy(target)
+	p.proxy.Transport = runner.client.Transport
+	director := p.proxy.Director
+	p.proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Host = target.Host
+		// let the transport negotiate compression, so it decompresses the
+		// response before it is validated
+		req.Header.Del("Accept-Encoding")
+	}
+	p.proxy.ModifyResponse = p.checkResponse
+	p.proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		fmt.Println(errorStyle.Render(fmt.Sprintf("ERROR %s %s: %v", req.Method, req.URL.RequestURI(), err)))
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return p
+}
+
+func (p *ContractProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	ex := &exchange{requestBody: body}
+	ex.path, ex.operation = matchOperation(p.apiSpec, req.Method, req.URL)
+	if ex.operation != nil {
+		if err := validateRequest(p.apiSpec, ex.operation, req, body); err != nil {
+			ex.problems = append(ex.problems, err.Error())
+		}
+	}
+
+	p.proxy.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), exchangeKey{}, ex)))
+}
+
+// checkResponse validates the response of the service and reports the exchange
+func (p *ContractProxy) checkResponse(resp *http.Response) error {
+	ex, _ := resp.Request.Context().Value(exchangeKey{}).(*exchange)
+	if ex == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	p.runner.coverage.record(ex.operation, resp.Request, ex.requestBody, resp.StatusCode)
+	if ex.operation != nil {
+		if _, err := validateResponse(p.apiSpec, ex.operation, resp, body); err != nil {
+			ex.problems = append(ex.problems, err.Error())
+		}
+	}
+
+	p.report(resp, ex, body)
+	return nil
+}
+
+func (p *ContractProxy) report(resp *http.Response, ex *exchange, body []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	req := resp.Request
+	line := fmt.Sprintf("%s %s -> %d", req.Method, req.URL.RequestURI(), resp.StatusCode)
+	switch {
+	case ex.operation == nil:
+		p.undocumented++
+		fmt.Println(warningStyle.Render("UNDOCUMENTED " + line))
+	case len(ex.problems) > 0:
+		p.failed++
+		fmt.Println(errorStyle.Render(fmt.Sprintf("FAIL %s (%s): %s", line, operationName(ex.path, ex.operation), strings.Join(ex.problems, "; "))))
+	default:
+		p.passed++
+		fmt.Println(successStyle.Render(fmt.Sprintf("PASS %s (%s)", line, operationName(ex.path, ex.operation))))
+	}
+
+	if p.recording != nil {
+		p.recording.Steps = append(p.recording.Steps, p.recordedStep(req, ex, resp, body))
+	}
+}
+
+// recordedStep turns an exchange into a scenario step that replays the request
+// against the service and expects the recorded response. Credentials are
+// replaced by {{env.VALIDA_NAME}} templates unless secrets are shown.
+func (p *ContractProxy) recordedStep(req *http.Request, ex *exchange, resp *http.Response, body []byte) *ScenarioStep {
+	step := &ScenarioStep{
+		Name: fmt.Sprintf("%s %s", req.Method, req.URL.Path),
+		Request: ScenarioRequest{
+			Method:  req.Method,
+			URL:     "{{baseUrl}}" + p.recordedRequestURI(req.URL),
+			Headers: make(map[string]string),
+			Body:    string(ex.requestBody),
+		},
+		Expect: &ScenarioExpect{Status: resp.StatusCode},
+	}
+	if ex.operation != nil {
+		step.Operation = operationName(ex.path, ex.operation)
+	}
+
+	for name, values := range req.Header {
+		switch strings.ToLower(name) {
+		case "host", "content-length", "accept-encoding", "connection", "x-forwarded-for":
+			continue
+		}
+		step.Request.Headers[name] = p.recordedSecret(name, strings.Join(values, ", "))
+	}
+
+	mediaType := strings.Split(resp.Header.Get("Content-Type"), ";")[0]
+	if isJSONMediaType(strings.TrimSpace(mediaType)) {
+		var value map[string]interface{}
+		if json.Unmarshal(body, &value) == nil {
+			step.Expect.Body = value
+		}
+	}
+	return step
+}
+
+// recordedRequestURI returns the path and query of a request, with the
+// credentials of the query replaced like those of headers
+func (p *ContractProxy) recordedRequestURI(u *url.URL) string {
+	if u.RawQuery == "" || p.runner.redact.showSecrets {
+		return u.RequestURI()
+	}
+	return u.EscapedPath() + "?" + templateQuerySecrets(u.RawQuery)
+}
+
+// recordedSecret returns the value recorded for a header: a template read
+// from the environment when its name carries credentials
+func (p *ContractProxy) recordedSecret(name, value string) string {
+	if p.runner.redact.showSecrets {
+		return value
+	}
+	return secretTemplate(name, value)
+}
+
+// templateQuerySecrets replaces the credentials of a raw query with templates,
+// leaving the encoding of the other parameters untouched
+func templateQuerySecrets(rawQuery string) string {
+	var pairs []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		name, value, hasValue := strings.Cut(pair, "=")
+		if decodedName, err := url.QueryUnescape(name); err == nil && hasValue {
+			pair = name + "=" + secretTemplate(decodedName, value)
+		}
+		pairs = append(pairs, pair)
+	}
+	return strings.Join(pairs, "&")
+}
+
+// secretTemplate returns a {{env.VALIDA_NAME}} template in place of the value
+// of a header or query parameter whose name carries credentials. The
+// authorization scheme is kept, so the variable only holds the credentials.
+func secretTemplate(name, value string) string {
+	if !isSecretName(name) {
+		return value
+	}
+	variable := "{{env." + secretVariable(name) + "}}"
+	switch strings.ToLower(name) {
+	case "authorization", "proxy-authorization":
+		if scheme, _, ok := strings.Cut(value, " "); ok {
+			return scheme + " " + variable
+		}
+	}
+	return variable
+}
+
+// secretVariable returns the environment variable holding a recorded
+// credential, such as VALIDA_X_API_KEY for the X-Api-Key header
+func secretVariable(name string) string {
+	variable := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	return "VALIDA_" + variable
+}
+
+// Recording returns the exchanges recorded so far as a scenario
+func (p *ContractProxy) Recording() *Scenario {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.recording == nil {
+		return nil
+	}
+	recording := *p.recording
+	recording.Steps = append([]*ScenarioStep(nil), p.recording.Steps...)
+	return &recording
+}
+
+// Summary returns the number of passed, failed and undocumented exchanges
+func (p *ContractProxy) Summary() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return fmt.Sprintf("Passed: %d, Failed: %d, Undocumented: %d", p.passed, p.failed, p.undocumented)
+}
+
+// operationName returns the operationId of an operation, or "METHOD /path" when it has none
+func operationName(path string, operation *Operation) string {
+	if operation.OperationID != "" {
+		return operation.OperationID
+	}
+	return strings.ToUpper(operation.Method) + " " + path
+}
@@ -0,0 +1,134 @@
+package apitest
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const proxySpec = `openapi: 3.0.3
+info:
+  title: Pets
+  version: "1.0"
+servers:
+  - url: http://localhost
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      responses:
+        "200":
+          description: Pets
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [pets]
+                properties:
+                  pets:
+                    type: array
+                    items:
+                      type: string
+`
+
+// loadTestSpec writes a spec to a temporary file and loads it
+func loadTestSpec(t *testing.T, spec string) *APISpec {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "openapi.yaml")
+	if err := os.WriteFile(path, []byte(spec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	apiSpec, err := LoadAPISpec(path, SpecOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return apiSpec
+}
+
+// newTestProxy starts a gzip-compressing service and a recording proxy in front of it
+func newTestProxy(t *testing.T, showSecrets bool) (*ContractProxy, *httptest.Server) {
+	t.Helper()
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			gz.Write([]byte(`{"pets": ["Rex"]}`))
+			return
+		}
+		w.Write([]byte(`{"pets": ["Rex"]}`))
+	}))
+	t.Cleanup(service.Close)
+
+	apiSpec := loadTestSpec(t, proxySpec)
+	runner, err := NewRunner(RunnerOptions{Log: LogOptions{File: "none"}, ShowSecrets: showSecrets})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { runner.Close() })
+
+	target, _ := url.Parse(service.URL)
+	proxy := NewContractProxy(runner, apiSpec, target, true)
+	server := httptest.NewServer(proxy)
+	t.Cleanup(server.Close)
+	return proxy, server
+}
+
+func TestContractProxyCompressedResponse(t *testing.T) {
+	proxy, server := newTestProxy(t, false)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/pets", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got := proxy.Summary(); got != "Passed: 1, Failed: 0, Undocumented: 0" {
+		t.Errorf("Summary() = %q, want the gzip response to pass", got)
+	}
+}
+
+func TestContractProxyRecordsSecretsAsTemplates(t *testing.T) {
+	tests := []struct {
+		showSecrets               bool
+		authorization, apiKey, qs string
+	}{
+		{false, "Bearer {{env.VALIDA_AUTHORIZATION}}", "{{env.VALIDA_X_API_KEY}}", "?limit=5&api_key={{env.VALIDA_API_KEY}}"},
+		{true, "Bearer s3cret", "k3y", "?limit=5&api_key=q3ry"},
+	}
+	for _, tt := range tests {
+		proxy, server := newTestProxy(t, tt.showSecrets)
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/pets?limit=5&api_key=q3ry", nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		req.Header.Set("X-Api-Key", "k3y")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		steps := proxy.Recording().Steps
+		if len(steps) != 1 {
+			t.Fatalf("recorded %d steps, want 1", len(steps))
+		}
+		request := steps[0].Request
+		if got := request.Headers["Authorization"]; got != tt.authorization {
+			t.Errorf("showSecrets=%t: Authorization = %q, want %q", tt.showSecrets, got, tt.authorization)
+		}
+		if got := request.Headers["X-Api-Key"]; got != tt.apiKey {
+			t.Errorf("showSecrets=%t: X-Api-Key = %q, want %q", tt.showSecrets, got, tt.apiKey)
+		}
+		if want := "{{baseUrl}}/pets" + tt.qs; request.URL != want {
+			t.Errorf("showSecrets=%t: URL = %q, want %q", tt.showSecrets, request.URL, want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package apitest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// minAdaptiveRate is the slowest rate the limiter falls back to after
+// repeated 429 responses
+const minAdaptiveRate = 0.2
+
+// defaultMaxPause is the longest a host asking to back off is left alone when
+// RateLimitOptions.MaxPause is not set
+const defaultMaxPause = time.Minute
+
+// RateLimitOptions represents the client side rate limits in requests per
+// second. A zero rate means unlimited. MaxPause caps the pause a host asks for
+// through Retry-After or RateLimit-Reset, one minute by default.
+type RateLimitOptions struct {
+	Rate         float64
+	Burst        int
+	PerHostRate  float64
+	PerHostBurst int
+	MaxPause     time.Duration
+}
+
+// hostLimit represents the limiter of one host and the slow-down learnt from its responses
+type hostLimit struct {
+	limiter    *rate.Limiter
+	configured rate.Limit
+	pausedTill time.Time
+	successes  int
+}
+
+// requestLimiter throttles requests globally and per host. It is shared by
+// every worker of a run.
+type requestLimiter struct {
+	mu      sync.Mutex
+	options RateLimitOptions
+	global  *rate.Limiter
+	hosts   map[string]*hostLimit
+}
+
+func newRequestLimiter(options RateLimitOptions) *requestLimiter {
+	if options.MaxPause <= 0 {
+		options.MaxPause = defaultMaxPause
+	}
+	l := &requestLimiter{options: options, hosts: make(map[string]*hostLimit)}
+	if options.Rate > 0 {
+		l.global = rate.NewLimiter(rate.Limit(options.Rate), burst(options.Burst))
+	}
+	return l
+}
+
+func burst(b int) int {
+	if b < 1 {
+		return 1
+	}
+	return b
+}
+
+func (l *requestLimiter) host(name string) *hostLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h, ok := l.hosts[name]
+	if !ok {
+		configured := rate.Inf
+		if l.options.PerHostRate > 0 {
+			configured = rate.Limit(l.options.PerHostRate)
+		}
+		h = &hostLimit{
+			limiter:    rate.NewLimiter(configured, burst(l.options.PerHostBurst)),
+			configured: configured,
+		}
+		l.hosts[name] = h
+	}
+	return h
+}
+
+// wait blocks until a request to the host is allowed and returns how long it waited
+func (l *requestLimiter) wait(ctx context.Context, host string) (time.Duration, error) {
+	started := time.Now()
+	h := l.host(host)
+
+	l.mu.Lock()
+	pause := time.Until(h.pausedTill)
+	l.mu.Unlock()
+	if pause > 0 {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < pause {
+			return time.Since(started), fmt.Errorf("host %s asked to pause for %s, past the deadline", host, formatDuration(pause))
+		}
+		select {
+		case <-ctx.Done():
+			return time.Since(started), ctx.Err()
+		case <-time.After(pause):
+		}
+	}
+
+	if l.global != nil {
+		if err := l.global.Wait(ctx); err != nil {
+			return time.Since(started), err
+		}
+	}
+	if err := h.limiter.Wait(ctx); err != nil {
+		return time.Since(started), err
+	}
+	if pause <= 0 && (l.global == nil || l.global.Limit() == rate.Inf) && h.limiter.Limit() == rate.Inf {
+		// nothing could have delayed the request
+		return 0, nil
+	}
+	return time.Since(started), nil
+}
+
+// observe slows down requests to a host that answered 429 or announced that
+// its quota is exhausted through RateLimit-* headers, and speeds back up
+// towards the configured rate after successful responses
+func (l *requestLimiter) observe(host string, resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	h := l.host(host)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	remaining, hasRemaining := rateLimitHeader(resp.Header, "Remaining")
+	reset, hasReset := rateLimitHeader(resp.Header, "Reset")
+	if hasReset && reset > 1e9 {
+		// X-RateLimit-Reset is often a Unix timestamp rather than a number of seconds
+		reset -= float64(time.Now().Unix())
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		h.successes = 0
+		current := h.limiter.Limit()
+		if current == rate.Inf {
+			if limit, ok := rateLimitHeader(resp.Header, "Limit"); ok && limit > 0 && hasReset && reset > 0 {
+				current = rate.Limit(limit / reset)
+			} else {
+				current = 1
+			}
+		} else {
+			current /= 2
+		}
+		if current < minAdaptiveRate {
+			current = minAdaptiveRate
+		}
+		h.limiter.SetLimit(current)
+
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			h.pause(delay, l.options.MaxPause)
+		} else if hasReset {
+			h.pause(time.Duration(reset*float64(time.Second)), l.options.MaxPause)
+		}
+	case hasRemaining && remaining <= 0 && hasReset:
+		h.pause(time.Duration(reset*float64(time.Second)), l.options.MaxPause)
+	case resp.StatusCode < 400 && h.limiter.Limit() < h.configured:
+		h.successes++
+		if h.successes >= 10 {
+			h.successes = 0
+			increased := h.limiter.Limit() * 1.25
+			if increased > h.configured {
+				increased = h.configured
+			}
+			h.limiter.SetLimit(increased)
+		}
+	}
+}
+
+// pause holds back requests to the host for d, at most maxPause
+func (h *hostLimit) pause(d, maxPause time.Duration) {
+	if d > maxPause {
+		d = maxPause
+	}
+	if until := time.Now().Add(d); until.After(h.pausedTill) {
+		h.pausedTill = until
+	}
+}
+
+// rateLimitHeader reads a numeric RateLimit-* or X-RateLimit-* header. The
+// IETF RateLimit header fields may carry parameters, of which only the value is kept.
+func rateLimitHeader(header http.Header, name string) (float64, bool) {
+	for _, prefix := range []string{"RateLimit-", "X-RateLimit-", "X-Rate-Limit-"} {
+		value := header.Get(prefix + name)
+		if value == "" {
+			continue
+		}
+		value, _, _ = strings.Cut(value, ";")
+		value, _, _ = strings.Cut(value, ",")
+		if n, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,47 @@
+package apitest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRequestLimiterCapsPauses(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+	}{
+		{"Retry-After", http.StatusTooManyRequests, http.Header{"Retry-After": {"3600"}}},
+		{"RateLimit-Reset", http.StatusTooManyRequests, http.Header{"Ratelimit-Reset": {"3600"}}},
+		{"exhausted quota", http.StatusOK, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"3600"}}},
+	}
+	for _, tt := range tests {
+		limiter := newRequestLimiter(RateLimitOptions{MaxPause: 50 * time.Millisecond})
+		limiter.observe("example.com", &http.Response{StatusCode: tt.status, Header: tt.header})
+
+		waited, err := limiter.wait(context.Background(), "example.com")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if waited < 40*time.Millisecond || waited > time.Second {
+			t.Errorf("%s: waited %s, want the 50ms cap", tt.name, waited)
+		}
+	}
+}
+
+func TestRequestLimiterPausePastDeadline(t *testing.T) {
+	limiter := newRequestLimiter(RateLimitOptions{})
+	limiter.observe("example.com", &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"30"}}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := limiter.wait(ctx, "example.com"); err == nil {
+		t.Fatal("wait() succeeded although the pause outlasts the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("wait() failed after %s, want straight away", elapsed)
+	}
+}
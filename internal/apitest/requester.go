@@ -2,151 +2,228 @@ package apitest
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-)
-
-var client = &http.Client{}
-var logger *Logger
 
-func MakeRequest(apiSpec *APISpec) {
-	var err error
-	logger, err = NewLogger()
-	if err != nil {
-		fmt.Printf("Failed to create logger: %v\n", err)
-		return
-	}
-	defer logger.Close()
+	"github.com/brianvoe/gofakeit/v7"
+)
 
-	var tableRows []TableRow
+// PlanRequests returns a test case for every operation of the spec, or for
+// every row of its data table
+func (r *Runner) PlanRequests(apiSpec *APISpec) []TestCase {
+	var cases []TestCase
 
 	for _, pathItem := range apiSpec.Paths {
 		for _, operation := range pathItem.Operations {
-			endpoint := apiSpec.BaseURL + pathItem.Path
-			method := strings.ToUpper(operation.Method)
-
-			req, requestBody := prepareRequest(apiSpec, pathItem, operation)
-			if req == nil {
-				logger.LogError(fmt.Errorf("failed to prepare request for %s %s", method, endpoint))
-				tableRows = append(tableRows, TableRow{
-					Endpoint:  endpoint,
-					Method:    method,
-					Response:  "N/A",
-					Assertion: "FAIL: Request preparation error",
-				})
+			name := operationName(pathItem.Path, operation)
+			opConfig := r.config.findOperationConfig(pathItem.Path, operation)
+			if opConfig == nil || opConfig.Data == "" {
+				cases = append(cases, TestCase{Name: name, Run: func(ctx context.Context) TableRow {
+					expectedResponse, _ := GetExpectedResponse(operation)
+					expectedResponse = expectCookies(expectedResponse, opConfig)
+					return r.runOperation(ctx, apiSpec, pathItem, operation, opConfig, expectedResponse, "")
+				}})
 				continue
 			}
 
-			logger.LogRequest(req, requestBody)
+			dataRows, err := loadDataTable(opConfig.Data)
+			if err != nil {
+				r.logger.LogError(err)
+				cases = append(cases, TestCase{Name: name, Run: func(ctx context.Context) TableRow {
+					return TableRow{
+						Endpoint:  apiSpec.BaseURL + pathItem.Path,
+						Method:    strings.ToUpper(operation.Method),
+						Response:  "N/A",
+						Assertion: fmt.Sprintf("FAIL: %v", err),
+					}
+				}})
+				continue
+			}
 
-			expectedResponse, _ := GetExpectedResponse(operation)
-			resp, responseBody, assertionResult := requestAndValidate(req, expectedResponse, endpoint, method)
+			for i, dataRow := range dataRows {
+				rowConfig, expectedStatus, label := applyDataRow(opConfig, operation, dataRow)
+				if label == "" {
+					label = fmt.Sprintf("row %d", i+1)
+				}
 
-			if resp != nil {
-				logger.LogResponse(resp, responseBody)
-				responseInfo := fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
-				tableRows = append(tableRows, TableRow{
-					Endpoint:  endpoint,
-					Method:    method,
-					Response:  responseInfo,
-					Assertion: assertionResult,
-				})
-			} else {
-				logger.LogError(fmt.Errorf("no response received for %s %s", method, endpoint))
-				tableRows = append(tableRows, TableRow{
-					Endpoint:  endpoint,
-					Method:    method,
-					Response:  "No response",
-					Assertion: assertionResult,
-				})
+				cases = append(cases, TestCase{Name: fmt.Sprintf("%s [%s]", name, label), Run: func(ctx context.Context) TableRow {
+					expectedResponse, _ := GetExpectedResponse(operation)
+					if expectedStatus != 0 && (expectedResponse == nil || expectedResponse.StatusCode != expectedStatus) {
+						expectedResponse = &ExpectedResponse{StatusCode: expectedStatus}
+					}
+					expectedResponse = expectCookies(expectedResponse, opConfig)
+					return r.runOperation(ctx, apiSpec, pathItem, operation, rowConfig, expectedResponse, label)
+				}})
 			}
 		}
 	}
 
-	DisplayTable(tableRows)
+	sort.SliceStable(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+	return cases
 }
 
-func prepareRequest(apiSpec *APISpec, pathItem *PathItem, operation *Operation) (*http.Request, string) {
-	var jsonReader io.Reader
+// runOperation sends a single request for the operation and turns the outcome into a table row
+func (r *Runner) runOperation(ctx context.Context, apiSpec *APISpec, pathItem *PathItem, operation *Operation, opConfig *OperationConfig, expectedResponse *ExpectedResponse, label string) TableRow {
+	endpoint := apiSpec.BaseURL + pathItem.Path
+	method := strings.ToUpper(operation.Method)
+	displayEndpoint := endpoint
+	if label != "" {
+		displayEndpoint = fmt.Sprintf("%s [%s]", endpoint, label)
+	}
+
+	caseLog := r.logger.forCase(operationName(pathItem.Path, operation))
+	req, requestBody := r.prepareRequest(apiSpec, pathItem, operation, opConfig)
+	if req == nil {
+		caseLog.LogError(fmt.Errorf("failed to prepare request for %s %s", method, endpoint))
+		return TableRow{
+			Endpoint:  displayEndpoint,
+			Method:    method,
+			Response:  "N/A",
+			Assertion: "FAIL: Request preparation error",
+		}
+	}
+
+	ex := &Exchange{Operation: operationName(pathItem.Path, operation), Request: req, RequestBody: []byte(requestBody), log: caseLog}
+	ex.scripts = r.config.requestScripts(operation, opConfig.scripts())
+	if err := r.beforeRequest(ctx, ex); err != nil {
+		caseLog.LogError(err)
+		return TableRow{
+			Endpoint:  displayEndpoint,
+			Method:    method,
+			Response:  "N/A",
+			Assertion: fmt.Sprintf("FAIL: %v", err),
+			Operation: ex.Operation,
+		}
+	}
+	req, requestBody = ex.Request, string(ex.RequestBody)
+
+	caseLog.LogRequest(req, requestBody)
+
+	resp, responseBody, assertionResult, timing := r.requestAndValidate(ctx, caseLog, ex, apiSpec, operation, expectedResponse, endpoint, method)
+	assertionResult = checkLatency(assertionResult, timing, r.config.latencySLA(operation, opConfig))
+	if resp == nil {
+		caseLog.LogError(fmt.Errorf("no response received for %s %s", method, endpoint))
+		caseLog.LogResult(assertionResult)
+		return TableRow{
+			Endpoint:  displayEndpoint,
+			Method:    method,
+			Response:  responseSummary(resp, timing),
+			Assertion: assertionResult,
+			Command:   r.reproduceCommand(req, requestBody),
+			Operation: operationName(pathItem.Path, operation),
+			Timing:    timing,
+		}
+	}
+
+	caseLog.LogResponse(resp, responseBody)
+	caseLog.LogTiming(timing)
+	caseLog.LogResult(assertionResult)
+	return TableRow{
+		Endpoint:  displayEndpoint,
+		Method:    method,
+		Response:  responseSummary(resp, timing),
+		Assertion: assertionResult,
+		Command:   r.reproduceCommand(req, requestBody),
+		Operation: operationName(pathItem.Path, operation),
+		Timing:    timing,
+	}
+}
+
+func (r *Runner) prepareRequest(apiSpec *APISpec, pathItem *PathItem, operation *Operation, opConfig *OperationConfig) (*http.Request, string) {
+	var bodyReader io.Reader
 	var requestBody string
+	contentType := "application/json"
 
 	if operation.RequestBody != nil {
 		reqBody := make(map[string]interface{})
-		properties := operation.RequestBody["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"].(map[string]interface{})["properties"].(map[string]interface{})
+		mediaType, schema := requestBodySchema(operation.RequestBody)
+		properties, _ := schema["properties"].(map[string]interface{})
 
 		for k, v := range properties {
+			propertySchema, _ := v.(map[string]interface{})
+			if value, ok := r.lookupBodyField(opConfig, k); ok {
+				reqBody[k] = coerceToSchemaType(value, propertySchema)
+				continue
+			}
+
 			pattern := `\b(?:e[-]?mail|mail)\b`
 			re := regexp.MustCompile(pattern)
 			matches := re.FindAllString(k, -1)
-			vType := v.(map[string]interface{})["type"].(string)
+			vType := primaryType(propertySchema)
 			switch vType {
 			case "string":
 				if len(matches) > 0 {
-					reqBody[k] = FakeEmail()
+					reqBody[k] = fakeEmail(r.fake)
 				} else {
-					reqBody[k] = FakeString()
+					reqBody[k] = fakeSchemaValue(r.fake, propertySchema)
 				}
-			case "integer":
-				reqBody[k] = FakeInt()
+			default:
+				reqBody[k] = fakeSchemaValue(r.fake, propertySchema)
 			}
 		}
 
-		b, _ := json.Marshal(reqBody)
-		jsonReader = bytes.NewReader(b)
-		requestBody = string(b)
+		reqBody, err := applyBodyOverrides(r.fake, opConfig, reqBody)
+		if err != nil {
+			r.logger.LogError(fmt.Errorf("applying body overrides: %w", err))
+			return nil, ""
+		}
+
+		bodyReader, requestBody, contentType, err = encodeRequestBody(r.fake, mediaType, reqBody)
+		if err != nil {
+			r.logger.LogError(err)
+			return nil, ""
+		}
 	}
 
 	// Replace path parameters with fake values
-	endpoint := replacePathParameters(apiSpec.BaseURL+pathItem.Path, operation.Parameters)
+	endpoint := r.replacePathParameters(apiSpec.BaseURL+pathItem.Path, operation.Parameters, opConfig)
 
-	req, err := http.NewRequest(strings.ToUpper(operation.Method), endpoint, jsonReader)
+	req, err := http.NewRequest(strings.ToUpper(operation.Method), endpoint, bodyReader)
 	if err != nil {
 		return nil, ""
 	}
-	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Content-Type", contentType)
 
 	if operation.Parameters != nil {
-		q := req.URL.Query()
+		var query []string
+		if req.URL.RawQuery != "" {
+			query = append(query, req.URL.RawQuery)
+		}
 		for _, param := range operation.Parameters {
-			if inValue, ok := param["in"]; ok {
-				schema := param["schema"].(map[string]interface{})
-				typeValue, _ := schema["type"]
+			if inValue, ok := param["in"].(string); ok {
+				schema := parameterSchema(param)
+				paramName := param["name"].(string)
 
-				getValue := func(paramName string, typeValue interface{}) string {
-					if paramName == "page" {
-						return "1"
-					}
-					if typeValue == "string" {
-						return FakeString()
-					} else if typeValue == "integer" {
-						return strconv.Itoa(FakeInt())
-					}
-					return ""
+				var value interface{}
+				if override, ok := r.lookupParameter(opConfig, inValue, paramName); ok {
+					value = override
+				} else {
+					value = fakeParameterValue(r.fake, paramName, schema)
 				}
 
-				value := getValue(param["name"].(string), typeValue)
-				paramName := param["name"].(string)
-
 				switch inValue {
 				case "query":
-					q.Add(paramName, value)
+					query = append(query, serializeParameter(param, value))
 				case "header":
-					req.Header.Add(paramName, value)
+					req.Header.Add(paramName, serializeParameter(param, value))
+				case "cookie":
+					req.AddCookie(&http.Cookie{Name: paramName, Value: serializeParameter(param, value)})
 				}
 			}
 		}
-		req.URL.RawQuery = q.Encode()
+		req.URL.RawQuery = strings.Join(query, "&")
 	}
 
 	return req, requestBody
 }
 
-func replacePathParameters(path string, parameters []map[string]interface{}) string {
+func (r *Runner) replacePathParameters(path string, parameters []map[string]interface{}, opConfig *OperationConfig) string {
 	for _, param := range parameters {
 		if in, ok := param["in"].(string); ok && in == "path" {
 			name, ok := param["name"].(string)
@@ -154,60 +231,86 @@ func replacePathParameters(path string, parameters []map[string]interface{}) str
 				continue
 			}
 			placeholder := fmt.Sprintf("{%s}", name)
-			var fakeValue string
-			if name == "id" {
-				fakeValue = strconv.Itoa(randInt(1, 10))
+			schema := parameterSchema(param)
+			var fakeValue interface{}
+			if override, ok := r.lookupParameter(opConfig, "path", name); ok {
+				fakeValue = override
+			} else if name == "id" {
+				fakeValue = strconv.Itoa(randInt(r.fake, 1, 10))
+			} else if primaryType(schema) == "array" || primaryType(schema) == "object" {
+				fakeValue = fakeSchemaValue(r.fake, schema)
 			} else {
-				fakeValue = generateFakeValue(param["schema"].(map[string]interface{}))
+				fakeValue = generateFakeValue(r.fake, schema)
 			}
-			path = strings.Replace(path, placeholder, fakeValue, 1)
+			path = strings.Replace(path, placeholder, serializeParameter(param, fakeValue), 1)
 		}
 	}
 	return path
 }
 
-func generateFakeValue(schema map[string]interface{}) string {
-	schemaType, ok := schema["type"].(string)
-	if !ok {
-		return FakeString()
+func generateFakeValue(fake *gofakeit.Faker, schema map[string]interface{}) string {
+	schemaType := primaryType(schema)
+	if schemaType == "" {
+		return fakeString(fake)
 	}
 
 	switch schemaType {
 	case "string":
-		return FakeString()
+		return fakeString(fake)
 	case "integer":
 		return strconv.Itoa(1)
 	case "number":
-		return fmt.Sprintf("%.2f", float64(FakeInt()))
+		return fmt.Sprintf("%.2f", float64(fakeInt(fake)))
 	default:
-		return FakeString()
+		return fakeString(fake)
 	}
 }
 
-func requestAndValidate(req *http.Request, expectedResp *ExpectedResponse, endpoint, method string) (*http.Response, string, string) {
-	resp, err := client.Do(req)
+func (r *Runner) requestAndValidate(ctx context.Context, caseLog *Logger, ex *Exchange, apiSpec *APISpec, operation *Operation, expectedResp *ExpectedResponse, endpoint, method string) (*http.Response, string, string, *RequestTiming) {
+	req := ex.Request
+	resp, body, timing, err := r.sendWithRetry(ctx, caseLog, req)
+	if err != nil && resp == nil {
+		caseLog.LogError(fmt.Errorf("error doing request: %v", err))
+		return nil, "", fmt.Sprintf("FAIL: Error doing request: %v", err), timing
+	}
 	if err != nil {
-		logger.LogError(fmt.Errorf("error doing request: %v", err))
-		return nil, "", fmt.Sprintf("FAIL: Error doing request: %v", err)
+		caseLog.LogError(fmt.Errorf("error reading body: %v", err))
+		resp.Body = io.NopCloser(bytes.NewReader(nil))
+		return resp, "", fmt.Sprintf("FAIL: Error reading body: %v", err), timing
 	}
 
-	defer resp.Body.Close()
+	responseBody := string(body)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if r.har != nil {
+		r.har.record(r.redact, req, resp, responseBody, timing)
+	}
+	r.coverage.record(operation, req, []byte(requestBodyText(req)), resp.StatusCode)
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.LogError(fmt.Errorf("error reading body: %v", err))
-		return resp, "", fmt.Sprintf("FAIL: Error reading body: %v", err)
+	ex.Response, ex.ResponseBody, ex.timing = resp, body, timing
+	if err := r.afterResponse(ctx, ex); err != nil {
+		caseLog.LogError(err)
+		return resp, responseBody, fmt.Sprintf("FAIL: %v", err), timing
 	}
+	body = ex.ResponseBody
+	responseBody = string(body)
 
-	responseBody := string(body)
+	validated, err := validateResponse(apiSpec, operation, resp, body)
+	if err != nil {
+		return resp, responseBody, fmt.Sprintf("FAIL: %v", err), timing
+	}
 
 	if expectedResp != nil {
 		if err := CompareResponses(resp, expectedResp); err != nil {
-			return resp, responseBody, fmt.Sprintf("FAIL: %v", err)
-		} else {
-			return resp, responseBody, "PASS"
+			return resp, responseBody, fmt.Sprintf("FAIL: %v", err), timing
 		}
-	} else {
-		return resp, responseBody, "WARNING: No expected response to validate against"
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if err := r.assert(ctx, ex); err != nil {
+		return resp, responseBody, fmt.Sprintf("FAIL: %v", err), timing
+	}
+
+	if expectedResp != nil || validated {
+		return resp, responseBody, "PASS", timing
 	}
+	return resp, responseBody, "WARNING: No expected response to validate against", timing
 }
@@ -0,0 +1,186 @@
+package apitest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy represents when and how often a failed request is sent again
+type RetryPolicy struct {
+	MaxRetries       int
+	RetryConnections bool
+	RetryStatuses    map[int]bool
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+}
+
+// ParseRetryOn reads a comma separated list of retry conditions: "connection"
+// for network errors and timeouts, and HTTP status codes such as 429 or 503
+func ParseRetryOn(s string) (bool, map[int]bool, error) {
+	connections := false
+	statuses := make(map[int]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+		case strings.EqualFold(item, "connection"):
+			connections = true
+		default:
+			status, err := strconv.Atoi(item)
+			if err != nil || status < 100 || status > 599 {
+				return false, nil, fmt.Errorf("invalid retry condition %q, expected connection or a status code", item)
+			}
+			statuses[status] = true
+		}
+	}
+	return connections, statuses, nil
+}
+
+// sendWithRetry sends the request and reads its body, retrying connection
+// errors and retryable status codes with exponential backoff and jitter. The
+// returned timing covers the last attempt and counts all attempts.
+func (r *Runner) sendWithRetry(ctx context.Context, caseLog *Logger, req *http.Request) (*http.Response, []byte, *RequestTiming, error) {
+	var waited, throttled time.Duration
+	for attempt := 1; ; attempt++ {
+		throttle, err := r.limiter.wait(ctx, req.URL.Host)
+		throttled += throttle
+		if err != nil {
+			return nil, nil, &RequestTiming{Attempts: attempt, RetryWait: waited, Throttle: throttled}, fmt.Errorf("%s while throttled: %w", r.interruption(ctx), err)
+		}
+
+		attemptReq := req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, nil, &RequestTiming{Attempts: attempt}, fmt.Errorf("rewinding request body: %w", err)
+			}
+			attemptReq.Body = body
+		}
+
+		attemptReq, timing := traceRequest(attemptReq)
+		timing.Attempts = attempt
+		timing.RetryWait = waited
+		timing.Throttle = throttled
+
+		resp, err := r.client.Do(attemptReq)
+		var body []byte
+		if err == nil {
+			body, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		timing.finish()
+		r.limiter.observe(req.URL.Host, resp)
+
+		reason, retry := r.retryReason(resp, err)
+		retry = retry && attempt <= r.retryPolicy.MaxRetries && ctx.Err() == nil
+		var delay time.Duration
+		if retry {
+			delay = r.retryDelay(attempt, resp)
+			// a retry that could only start after the run deadline is not attempted
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				retry = false
+			}
+		}
+		if !retry {
+			keepJarCookies(req, attemptReq, r.client.Jar)
+			if err != nil {
+				if ctx.Err() != nil {
+					err = fmt.Errorf("%s: %w", r.interruption(ctx), err)
+				}
+				return resp, nil, timing, err
+			}
+			return resp, body, timing, nil
+		}
+
+		caseLog.LogWarning(fmt.Sprintf("attempt %d of %s %s failed (%s), retrying in %s", attempt, req.Method, r.redact.maskURL(req.URL), reason, formatDuration(delay)))
+		select {
+		case <-ctx.Done():
+			return resp, body, timing, fmt.Errorf("%s while waiting to retry after %s", r.interruption(ctx), reason)
+		case <-time.After(delay):
+		}
+		waited += delay
+	}
+}
+
+// keepJarCookies copies the cookies the client added from its jar to the sent
+// attempt onto the request, so its HAR entry and reproduce command carry them
+func keepJarCookies(req, attemptReq *http.Request, jar http.CookieJar) {
+	if jar == nil {
+		return
+	}
+	if cookies := attemptReq.Header.Values("Cookie"); len(cookies) > 0 {
+		req.Header["Cookie"] = cookies
+	}
+}
+
+// retryReason reports whether an attempt failed in a way the policy retries
+func (r *Runner) retryReason(resp *http.Response, err error) (string, bool) {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return "", false
+		}
+		// client errors are wrapped in a *url.Error, which is itself a net.Error
+		cause := err
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			cause = urlErr.Err
+		}
+		var netErr net.Error
+		if r.retryPolicy.RetryConnections && (errors.As(cause, &netErr) || errors.Is(cause, io.EOF) || errors.Is(cause, io.ErrUnexpectedEOF)) {
+			return err.Error(), true
+		}
+		return "", false
+	}
+	if r.retryPolicy.RetryStatuses[resp.StatusCode] {
+		return resp.Status, true
+	}
+	return "", false
+}
+
+// retryDelay honours the Retry-After header of the response, and otherwise
+// doubles the base delay on every attempt, with full jitter. Both are capped
+// at the maximum delay.
+func (r *Runner) retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if r.retryPolicy.MaxDelay > 0 && delay > r.retryPolicy.MaxDelay {
+				delay = r.retryPolicy.MaxDelay
+			}
+			return delay
+		}
+	}
+
+	backoff := float64(r.retryPolicy.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if r.retryPolicy.MaxDelay > 0 && backoff > float64(r.retryPolicy.MaxDelay) {
+		backoff = float64(r.retryPolicy.MaxDelay)
+	}
+	return time.Duration(r.fake.Float64() * backoff)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
@@ -0,0 +1,76 @@
+package apitest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryDelayCapsRetryAfter(t *testing.T) {
+	runner, err := NewRunner(RunnerOptions{
+		Log:   LogOptions{File: "none"},
+		Retry: RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	tests := []struct {
+		retryAfter string
+		want       time.Duration
+	}{
+		{"0", 0},
+		{"1", time.Second},
+		{"3600", time.Second},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Second},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{"Retry-After": {tt.retryAfter}}}
+		if got := runner.retryDelay(1, resp); got != tt.want {
+			t.Errorf("retryDelay(Retry-After: %s) = %s, want %s", tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+func TestSendWithRetryStopsBeforeTheDeadline(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	runner, err := NewRunner(RunnerOptions{
+		Log: LogOptions{File: "none"},
+		Retry: RetryPolicy{
+			MaxRetries:    3,
+			RetryStatuses: map[int]bool{http.StatusServiceUnavailable: true},
+			BaseDelay:     time.Millisecond,
+			MaxDelay:      time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	start := time.Now()
+	resp, _, timing, err := runner.sendWithRetry(ctx, runner.logger, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("sendWithRetry() waited %s for a retry the deadline does not leave time for", elapsed)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || timing.Attempts != 1 || attempts.Load() != 1 {
+		t.Errorf("got status %d after %d attempts, want the first 503", resp.StatusCode, timing.Attempts)
+	}
+}
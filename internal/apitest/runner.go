@@ -0,0 +1,274 @@
+package apitest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// RunnerOptions represents the settings of a Runner. The zero value sends
+// requests one at a time with the default transport, without timeouts,
+// retries, rate limits or log file.
+type RunnerOptions struct {
+	// Config holds the operation overrides, fixtures and TLS settings of a config file
+	Config *Config
+	// Seed makes the generated request data reproducible, 0 for a random seed
+	Seed uint64
+
+	Concurrency int
+	Timeout     time.Duration
+	RunTimeout  time.Duration
+	Retry       RetryPolicy
+	RateLimit   RateLimitOptions
+	TLS         TLSOptions
+	Network     NetworkOptions
+	// Transport sends the requests instead of a transport built from the TLS
+	// and network options, such as a HandlerTransport
+	Transport http.RoundTripper
+	CookieJar bool
+	// Hooks run around every request, after the hooks of the config file.
+	// They belong to the caller, which closes them.
+	Hooks []Hook
+	// Variables are the initial variables of scripts
+	Variables map[string]string
+
+	Log           LogOptions
+	RecordHAR     bool
+	Version       string
+	ShowSecrets   bool
+	CommandFormat string
+}
+
+// Runner represents a test session: the HTTP client, log, random data
+// generator, configuration and results of its runs. Runners share no state,
+// so several of them can run at the same time.
+type Runner struct {
+	client        *http.Client
+	logger        *Logger
+	fake          *gofakeit.Faker
+	config        *Config
+	concurrency   int
+	retryPolicy   RetryPolicy
+	runTimeout    time.Duration
+	limiter       *requestLimiter
+	redact        *redactor
+	commandFormat string
+	har           *harArchive
+	coverage      *coverageRecorder
+	hooks         []Hook
+	closers       []io.Closer
+	scripts       *scriptEngine
+
+	mu      sync.Mutex
+	results []TableRow
+}
+
+// TestCase represents one request of a run, sent and checked when Run is called
+type TestCase struct {
+	Name string
+	Run  func(ctx context.Context) TableRow
+}
+
+// NewRunner builds the client of a runner and opens its log
+func NewRunner(options RunnerOptions) (*Runner, error) {
+	cfg := options.Config
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	commandFormat, err := parseCommandFormat(options.CommandFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := options.Transport
+	if transport == nil {
+		tlsSettings := mergeTLS(options.TLS, cfg)
+		if tlsSettings.Insecure {
+			fmt.Fprintln(os.Stderr, "Warning: TLS certificate verification is disabled")
+		}
+		network, err := parseNetwork(options.Network)
+		if err != nil {
+			return nil, err
+		}
+		transport, err = newClientTransport(tlsSettings, network)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client := &http.Client{Transport: transport, Timeout: options.Timeout}
+	if options.CookieJar {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating cookie jar: %w", err)
+		}
+		client.Jar = jar
+	}
+
+	r := &Runner{
+		client:        client,
+		fake:          gofakeit.New(options.Seed),
+		config:        cfg,
+		concurrency:   options.Concurrency,
+		retryPolicy:   options.Retry,
+		runTimeout:    options.RunTimeout,
+		limiter:       newRequestLimiter(options.RateLimit),
+		redact:        &redactor{showSecrets: options.ShowSecrets, fields: append(append([]string{}, options.Log.Redact...), cfg.Redact...)},
+		commandFormat: commandFormat,
+		coverage:      newCoverageRecorder(),
+		scripts:       newScriptEngine(options.Variables),
+	}
+	if r.concurrency < 1 {
+		r.concurrency = 1
+	}
+	if options.RecordHAR {
+		r.har = newHARArchive(options.Version)
+	}
+	for _, hookConfig := range cfg.Hooks {
+		hook, err := newHook(hookConfig)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.hooks = append(r.hooks, hook)
+		// hooks of the config file belong to the runner, the others to the caller
+		if closer, ok := hook.(io.Closer); ok {
+			r.closers = append(r.closers, closer)
+		}
+	}
+	r.hooks = append(r.hooks, options.Hooks...)
+
+	r.logger, err = newLogger(options.Log, r.redact)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Close closes the log of the runner and the hooks of its config file that
+// implement io.Closer
+func (r *Runner) Close() error {
+	errs := []error{r.logger.Close()}
+	for _, closer := range r.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Run runs the test cases on up to Concurrency workers, which share the rate
+// limiter, and adds their rows to the results in order. When ctx is cancelled
+// no further test case is started, the rows of the interrupted ones are
+// dropped and an error reports how many test cases completed.
+func (r *Runner) Run(ctx context.Context, cases []TestCase) error {
+	runCtx, cancel := r.WithRunTimeout(ctx)
+	defer cancel()
+
+	tableRows := make([]TableRow, len(cases))
+	completed := make([]bool, len(cases))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < r.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				tableRows[i] = cases[i].Run(runCtx)
+				completed[i] = ctx.Err() == nil
+				if completed[i] {
+					r.notify(ctx, tableRows[i])
+				}
+			}
+		}()
+	}
+dispatch:
+	for i := range cases {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case next <- i:
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	count := 0
+	for i, row := range tableRows {
+		if completed[i] {
+			r.addResult(row)
+			count++
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("run interrupted after %d of %d test cases: %w", count, len(cases), err)
+	}
+	return nil
+}
+
+// RunCase runs a single test case, such as a subtest, and adds its row to the results
+func (r *Runner) RunCase(ctx context.Context, testCase TestCase) TableRow {
+	row := testCase.Run(ctx)
+	r.notify(ctx, row)
+	r.addResult(row)
+	return row
+}
+
+// notify passes a completed row to the OnResult hooks, even once the run timeout expired
+func (r *Runner) notify(ctx context.Context, row TableRow) {
+	ctx = context.WithoutCancel(ctx)
+	for _, hook := range r.hooks {
+		hook.OnResult(ctx, row)
+	}
+}
+
+func (r *Runner) addResult(row TableRow) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, row)
+}
+
+// Results returns the rows of the test cases run so far
+func (r *Runner) Results() []TableRow {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]TableRow(nil), r.results...)
+}
+
+// Coverage compares the spec with what the requests of the runner exercised
+func (r *Runner) Coverage(apiSpec *APISpec) *CoverageReport {
+	return r.coverage.report(apiSpec)
+}
+
+// WriteHAR writes the recorded requests and responses to a HAR 1.2 file
+func (r *Runner) WriteHAR(filePath string) error {
+	if r.har == nil {
+		return errors.New("HAR recording is not enabled")
+	}
+	return r.har.write(filePath)
+}
+
+// WithRunTimeout applies the run timeout of the runner to ctx
+func (r *Runner) WithRunTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.runTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.runTimeout)
+}
+
+// interruption explains why ctx stopped a request: the run timeout or a cancelled run
+func (r *Runner) interruption(ctx context.Context) string {
+	if r.runTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Sprintf("run timeout of %s exceeded", r.runTimeout)
+	}
+	return "run interrupted"
+}
@@ -0,0 +1,316 @@
+package apitest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/invopop/yaml"
+)
+
+var variablePattern = regexp.MustCompile(`\{\{\s*(\$?[a-zA-Z0-9_\-]+)\s*\}\}`)
+
+// Scenario represents an ordered list of requests run against the API, such
+// as the requests imported from a Postman collection or a HAR capture
+type Scenario struct {
+	Name      string            `json:"name,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Steps     []*ScenarioStep   `json:"steps"`
+}
+
+// ScenarioStep represents a single request of a scenario and the operation of
+// the specification it exercises
+type ScenarioStep struct {
+	Name      string          `json:"name,omitempty"`
+	Operation string          `json:"operation,omitempty"`
+	Request   ScenarioRequest `json:"request"`
+	Expect    *ScenarioExpect `json:"expect,omitempty"`
+	Scripts   *Scripts        `json:"scripts,omitempty"`
+}
+
+// ScenarioRequest represents the request sent by a scenario step
+type ScenarioRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// ScenarioExpect represents the response captured when the scenario was recorded
+type ScenarioExpect struct {
+	Status int                    `json:"status,omitempty"`
+	Body   map[string]interface{} `json:"body,omitempty"`
+}
+
+// LoadScenario reads a scenario from a YAML or JSON file
+func LoadScenario(filePath string) (*Scenario, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading scenario: %w", err)
+	}
+
+	scenario := &Scenario{}
+	if err := yaml.Unmarshal(data, scenario); err != nil {
+		return nil, fmt.Errorf("decoding scenario %s: %w", filePath, err)
+	}
+	return scenario, nil
+}
+
+// SaveScenario writes a scenario as JSON or YAML depending on the file extension
+func SaveScenario(scenario *Scenario, filePath string) error {
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		data, err = json.MarshalIndent(scenario, "", "  ")
+	} else {
+		data, err = yaml.Marshal(scenario)
+	}
+	if err != nil {
+		return fmt.Errorf("encoding scenario: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		return fmt.Errorf("writing scenario: %w", err)
+	}
+	return nil
+}
+
+// PlanScenario returns a test case for every step of the scenario. The steps
+// must be run in order.
+func (r *Runner) PlanScenario(apiSpec *APISpec, scenario *Scenario) []TestCase {
+	// scripts read and change the variables of the scenario
+	r.scripts.defaultVariables(scenario.Variables)
+
+	var cases []TestCase
+	for i, step := range scenario.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step %d", i+1)
+		}
+		cases = append(cases, TestCase{Name: name, Run: func(ctx context.Context) TableRow {
+			return r.runScenarioStep(ctx, apiSpec, scenario, step, i)
+		}})
+	}
+	return cases
+}
+
+func (r *Runner) runScenarioStep(ctx context.Context, apiSpec *APISpec, scenario *Scenario, step *ScenarioStep, index int) TableRow {
+	method := strings.ToUpper(step.Request.Method)
+	// variables set by the scripts of earlier steps override those of the scenario
+	variables := r.scripts.withVariables(scenario.Variables)
+	rawURL := renderVariables(r.fake, step.Request.URL, variables)
+
+	label := step.Name
+	if label == "" {
+		label = fmt.Sprintf("step %d", index+1)
+	}
+	displayEndpoint := fmt.Sprintf("%s [%s]", rawURL, label)
+
+	var body io.Reader
+	requestBody := renderVariables(r.fake, step.Request.Body, variables)
+	if requestBody != "" {
+		body = strings.NewReader(requestBody)
+	}
+
+	caseLog := r.logger.forCase(label)
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		caseLog.LogError(fmt.Errorf("failed to prepare request for %s %s: %w", method, rawURL, err))
+		return TableRow{
+			Endpoint:  displayEndpoint,
+			Method:    method,
+			Response:  "N/A",
+			Assertion: "FAIL: Request preparation error",
+		}
+	}
+	for name, value := range step.Request.Headers {
+		req.Header.Set(name, renderVariables(r.fake, value, variables))
+	}
+
+	var path string
+	var operation *Operation
+	if step.Operation != "" {
+		path, operation = findOperation(apiSpec, step.Operation)
+	}
+	if operation == nil {
+		path, operation = matchOperation(apiSpec, method, req.URL)
+	}
+	var opConfig *OperationConfig
+	operationLabel := ""
+	if operation != nil {
+		opConfig = r.config.findOperationConfig(path, operation)
+		operationLabel = operationName(path, operation)
+		if step.Operation != "" {
+			operationLabel = step.Operation
+		}
+	}
+
+	var expectedResponse *ExpectedResponse
+	if step.Expect != nil {
+		expectedResponse = &ExpectedResponse{StatusCode: step.Expect.Status, Body: step.Expect.Body}
+	}
+
+	ex := &Exchange{Operation: operationLabel, Request: req, RequestBody: []byte(requestBody), log: caseLog}
+	ex.scripts = r.config.requestScripts(operation, opConfig.scripts(), step.Scripts)
+	if err := r.beforeRequest(ctx, ex); err != nil {
+		caseLog.LogError(err)
+		return TableRow{
+			Endpoint:  displayEndpoint,
+			Method:    method,
+			Response:  "N/A",
+			Assertion: fmt.Sprintf("FAIL: %v", err),
+			Operation: operationLabel,
+		}
+	}
+	req, requestBody = ex.Request, string(ex.RequestBody)
+
+	caseLog.LogRequest(req, requestBody)
+
+	resp, responseBody, assertionResult, timing := r.requestAndValidate(ctx, caseLog, ex, apiSpec, operation, expectedResponse, rawURL, method)
+	assertionResult = checkLatency(assertionResult, timing, r.config.latencySLA(operation, opConfig))
+	if resp == nil {
+		caseLog.LogError(fmt.Errorf("no response received for %s %s", method, rawURL))
+		caseLog.LogResult(assertionResult)
+		return TableRow{
+			Endpoint:  displayEndpoint,
+			Method:    method,
+			Response:  responseSummary(resp, timing),
+			Assertion: assertionResult,
+			Command:   r.reproduceCommand(req, requestBody),
+			Operation: operationLabel,
+			Timing:    timing,
+		}
+	}
+
+	caseLog.LogResponse(resp, responseBody)
+	caseLog.LogTiming(timing)
+	if operation == nil && strings.HasPrefix(assertionResult, "WARNING") {
+		assertionResult = "WARNING: Request does not match a documented operation"
+	}
+	caseLog.LogResult(assertionResult)
+	return TableRow{
+		Endpoint:  displayEndpoint,
+		Method:    method,
+		Response:  responseSummary(resp, timing),
+		Assertion: assertionResult,
+		Command:   r.reproduceCommand(req, requestBody),
+		Operation: operationLabel,
+		Timing:    timing,
+	}
+}
+
+// findOperation returns the path and operation with the given operationId or "METHOD /path"
+func findOperation(apiSpec *APISpec, key string) (string, *Operation) {
+	for _, pathItem := range apiSpec.Paths {
+		for _, operation := range pathItem.Operations {
+			if operation.OperationID != "" && strings.EqualFold(operation.OperationID, key) {
+				return pathItem.Path, operation
+			}
+			if strings.EqualFold(strings.ToUpper(operation.Method)+" "+pathItem.Path, key) {
+				return pathItem.Path, operation
+			}
+		}
+	}
+	return "", nil
+}
+
+// matchOperation finds the documented operation serving a request URL. When
+// several path templates match, the one with the most literal segments wins.
+func matchOperation(apiSpec *APISpec, method string, requestURL *url.URL) (string, *Operation) {
+	requestPath := requestURL.Path
+	if base, err := url.Parse(apiSpec.BaseURL); err == nil {
+		basePath := strings.TrimSuffix(base.Path, "/")
+		// /v1 is the base path of /v1/pets, not of /v10/pets
+		if basePath != "" && (requestPath == basePath || strings.HasPrefix(requestPath, basePath+"/")) {
+			requestPath = strings.TrimPrefix(requestPath, basePath)
+		}
+	}
+
+	var paths []string
+	for path := range apiSpec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	sort.SliceStable(paths, func(i, j int) bool {
+		return strings.Count(paths[i], "{") < strings.Count(paths[j], "{")
+	})
+
+	for _, path := range paths {
+		if !pathTemplatePattern(path).MatchString(requestPath) {
+			continue
+		}
+		for _, operation := range apiSpec.Paths[path].Operations {
+			if strings.EqualFold(operation.Method, method) {
+				return path, operation
+			}
+		}
+	}
+	return "", nil
+}
+
+// templateParameter matches the {name} parameters of a path template
+var templateParameter = regexp.MustCompile(`\{[^}]+\}`)
+
+// pathTemplates caches the patterns of the path templates matched so far
+var pathTemplates sync.Map
+
+// pathTemplatePattern turns a path template such as /pets/{petId} into a regular expression
+func pathTemplatePattern(path string) *regexp.Regexp {
+	if cached, ok := pathTemplates.Load(path); ok {
+		return cached.(*regexp.Regexp)
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" {
+			continue
+		}
+		pattern.WriteString("/")
+		parts := templateParameter.Split(segment, -1)
+		for i, part := range parts {
+			if i > 0 {
+				pattern.WriteString("[^/]+")
+			}
+			pattern.WriteString(regexp.QuoteMeta(part))
+		}
+	}
+	pattern.WriteString("/?$")
+	compiled, _ := pathTemplates.LoadOrStore(path, regexp.MustCompile(pattern.String()))
+	return compiled.(*regexp.Regexp)
+}
+
+// renderVariables expands {{name}} scenario variables, the Postman dynamic
+// variables {{$guid}}, {{$timestamp}} and {{$randomInt}}, and the {{env.X}}
+// and {{faker.x}} templates
+func renderVariables(fake *gofakeit.Faker, s string, variables map[string]string) string {
+	s = variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := variablePattern.FindStringSubmatch(match)[1]
+		switch name {
+		case "$guid", "$randomUUID":
+			return fake.UUID()
+		case "$timestamp":
+			return strconv.FormatInt(time.Now().Unix(), 10)
+		case "$randomInt":
+			return strconv.Itoa(randInt(fake, 0, 1000))
+		}
+		if value, ok := variables[name]; ok {
+			return value
+		}
+		return match
+	})
+	rendered, _ := renderTemplate(fake, s).(string)
+	return rendered
+}
@@ -0,0 +1,82 @@
+package apitest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMatchOperation(t *testing.T) {
+	apiSpec := &APISpec{
+		BaseURL: "https://api.example.com/v1",
+		Paths: map[string]*PathItem{
+			"/pets":          {Path: "/pets", Operations: map[string]*Operation{"get": {Method: "get"}}},
+			"/pets/{petId}":  {Path: "/pets/{petId}", Operations: map[string]*Operation{"get": {Method: "get"}}},
+			"/pets/mine":     {Path: "/pets/mine", Operations: map[string]*Operation{"get": {Method: "get"}}},
+			"/v10/pets":      {Path: "/v10/pets", Operations: map[string]*Operation{"get": {Method: "get"}}},
+			"/files/{a}.{b}": {Path: "/files/{a}.{b}", Operations: map[string]*Operation{"post": {Method: "post"}}},
+		},
+	}
+
+	tests := []struct {
+		method, url, want string
+	}{
+		{"GET", "https://api.example.com/v1/pets", "/pets"},
+		{"GET", "https://api.example.com/v1/pets/", "/pets"},
+		{"GET", "https://api.example.com/v1/pets/42", "/pets/{petId}"},
+		{"GET", "https://api.example.com/v1/pets/mine", "/pets/mine"},
+		{"GET", "https://api.example.com/v10/pets", "/v10/pets"},
+		{"POST", "https://api.example.com/v1/files/report.pdf", "/files/{a}.{b}"},
+		{"POST", "https://api.example.com/v1/pets", ""},
+		{"GET", "https://api.example.com/v1/pets/42/toys", ""},
+	}
+	for _, tt := range tests {
+		requestURL, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := matchOperation(apiSpec, tt.method, requestURL); got != tt.want {
+			t.Errorf("matchOperation(%s %s) = %q, want %q", tt.method, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestScenarioCookieJar(t *testing.T) {
+	var cookies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookies = append(cookies, r.Header.Get("Cookie"))
+		if r.Method == http.MethodPost {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s-1", Path: "/"})
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	apiSpec := loadTestSpec(t, strings.Replace(ordersSpec, "http://localhost", server.URL, 1))
+
+	for _, jar := range []bool{true, false} {
+		cookies = nil
+		runner, err := NewRunner(RunnerOptions{CookieJar: jar, Log: LogOptions{File: "none"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		scenario := &Scenario{Variables: map[string]string{"baseUrl": server.URL}, Steps: []*ScenarioStep{
+			{Name: "login", Request: ScenarioRequest{Method: "POST", URL: "{{baseUrl}}/orders", Body: `{}`}},
+			{Name: "read", Request: ScenarioRequest{Method: "GET", URL: "{{baseUrl}}/orders/1"}},
+		}}
+		if err := runner.Run(context.Background(), runner.PlanScenario(apiSpec, scenario)); err != nil {
+			t.Fatal(err)
+		}
+		runner.Close()
+
+		want := ""
+		if jar {
+			want = "session=s-1"
+		}
+		if len(cookies) != 2 || cookies[0] != "" || cookies[1] != want {
+			t.Errorf("cookie jar %v: Cookie headers = %q, want %q on the second step", jar, cookies, want)
+		}
+	}
+}
@@ -0,0 +1,683 @@
+package apitest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// scriptTimeout stops scripts that never finish, such as an endless loop
+var scriptTimeout = 10 * time.Second
+
+// Scripts represents the JavaScript run before a request and after its
+// response, given inline or as files relative to the config file
+type Scripts struct {
+	PreRequest     string `mapstructure:"preRequest" json:"preRequest,omitempty"`
+	Test           string `mapstructure:"test" json:"test,omitempty"`
+	PreRequestFile string `mapstructure:"preRequestFile" json:"-"`
+	TestFile       string `mapstructure:"testFile" json:"-"`
+}
+
+// load reads the script files into the inline scripts
+func (s *Scripts) load(dir string) error {
+	if s == nil {
+		return nil
+	}
+	read := func(path string) (string, error) {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading script: %w", err)
+		}
+		return string(data), nil
+	}
+
+	if s.PreRequestFile != "" {
+		src, err := read(s.PreRequestFile)
+		if err != nil {
+			return err
+		}
+		s.PreRequest = joinScripts(s.PreRequest, src)
+	}
+	if s.TestFile != "" {
+		src, err := read(s.TestFile)
+		if err != nil {
+			return err
+		}
+		s.Test = joinScripts(s.Test, src)
+	}
+	return nil
+}
+
+func joinScripts(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "\n" + b
+}
+
+// scripts returns the scripts of the operation config, which may be nil
+func (c *OperationConfig) scripts() *Scripts {
+	if c == nil {
+		return nil
+	}
+	return c.Scripts
+}
+
+// parseScripts reads the x-valida-script extension of an operation
+func parseScripts(v interface{}) (*Scripts, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object with preRequest and test scripts, got %T", v)
+	}
+	scripts := &Scripts{}
+	for key, value := range m {
+		src, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("script %s is a %T, expected a string", key, value)
+		}
+		switch key {
+		case "preRequest":
+			scripts.PreRequest = src
+		case "test":
+			scripts.Test = src
+		default:
+			return nil, fmt.Errorf("unknown script %q, expected preRequest or test", key)
+		}
+	}
+	return scripts, nil
+}
+
+// requestScripts returns the scripts of a request in the order they run:
+// those of the config file, of the x-valida-script extension of the
+// operation, then its own, from the operation config and scenario step
+func (c *Config) requestScripts(operation *Operation, own ...*Scripts) []*Scripts {
+	var collected []*Scripts
+	var spec *Scripts
+	if operation != nil {
+		spec = operation.Scripts
+	}
+	for _, s := range append([]*Scripts{c.Scripts, spec}, own...) {
+		if s != nil && (s.PreRequest != "" || s.Test != "") {
+			collected = append(collected, s)
+		}
+	}
+	return collected
+}
+
+// scriptEngine holds the compiled scripts and the variables of a runner.
+// Every script runs in a runtime of its own, as runtimes are not safe for
+// concurrent use.
+type scriptEngine struct {
+	mu        sync.Mutex
+	programs  map[string]*goja.Program
+	variables map[string]string
+}
+
+func newScriptEngine(variables map[string]string) *scriptEngine {
+	e := &scriptEngine{programs: make(map[string]*goja.Program), variables: make(map[string]string)}
+	for name, value := range variables {
+		e.variables[name] = value
+	}
+	return e
+}
+
+func (e *scriptEngine) compile(name, src string) (*goja.Program, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if program, ok := e.programs[src]; ok {
+		return program, nil
+	}
+	program, err := goja.Compile(name, src, false)
+	if err != nil {
+		return nil, err
+	}
+	e.programs[src] = program
+	return program, nil
+}
+
+func (e *scriptEngine) variable(name string) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	value, ok := e.variables[name]
+	return value, ok
+}
+
+func (e *scriptEngine) setVariable(name, value string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.variables[name] = value
+}
+
+func (e *scriptEngine) unsetVariable(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.variables, name)
+}
+
+// defaultVariables sets the variables that scripts have not set yet
+func (e *scriptEngine) defaultVariables(variables map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for name, value := range variables {
+		if _, ok := e.variables[name]; !ok {
+			e.variables[name] = value
+		}
+	}
+}
+
+// withVariables returns the given variables overridden by those set by scripts
+func (e *scriptEngine) withVariables(variables map[string]string) map[string]string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	merged := make(map[string]string, len(variables)+len(e.variables))
+	for name, value := range variables {
+		merged[name] = value
+	}
+	for name, value := range e.variables {
+		merged[name] = value
+	}
+	return merged
+}
+
+// runPreRequestScripts runs the pre-request scripts of the exchange, which
+// may change its method, URL, headers and body
+func (r *Runner) runPreRequestScripts(ctx context.Context, ex *Exchange) error {
+	for _, s := range ex.scripts {
+		if s.PreRequest == "" {
+			continue
+		}
+		if _, err := r.runScript(ctx, ex, "pre-request", s.PreRequest); err != nil {
+			return fmt.Errorf("pre-request script: %w", err)
+		}
+	}
+	return nil
+}
+
+// runTestScripts runs the test scripts of the exchange, returning the failed
+// tests and assertions
+func (r *Runner) runTestScripts(ctx context.Context, ex *Exchange) error {
+	var failures []string
+	for _, s := range ex.scripts {
+		if s.Test == "" {
+			continue
+		}
+		failed, err := r.runScript(ctx, ex, "test", s.Test)
+		if err != nil {
+			return fmt.Errorf("test script: %w", err)
+		}
+		failures = append(failures, failed...)
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// runScript runs a script in a new runtime exposing the valida and pm
+// objects, and returns the failures of the tests it declared
+func (r *Runner) runScript(ctx context.Context, ex *Exchange, stage, src string) ([]string, error) {
+	program, err := r.scripts.compile(stage+".js", src)
+	if err != nil {
+		return nil, err
+	}
+
+	vm := goja.New()
+	scriptCtx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+	stop := context.AfterFunc(scriptCtx, func() {
+		// the run or the request may have stopped before the script timed out
+		if err := ctx.Err(); err != nil {
+			vm.Interrupt(fmt.Errorf("%s: %w", r.interruption(ctx), err))
+			return
+		}
+		vm.Interrupt(fmt.Errorf("script did not finish within %s", scriptTimeout))
+	})
+	defer stop()
+
+	s := &scriptRun{runner: r, vm: vm, ex: ex, stage: stage}
+	if err := s.setup(); err != nil {
+		return nil, err
+	}
+	if _, err := vm.RunProgram(program); err != nil {
+		return nil, scriptError(err)
+	}
+	if stage == "pre-request" {
+		if err := s.apply(); err != nil {
+			return nil, err
+		}
+	}
+	return s.failures, nil
+}
+
+// scriptError turns a JavaScript exception into its message, without the stack
+func scriptError(err error) error {
+	var exception *goja.Exception
+	if errors.As(err, &exception) {
+		// plain errors, such as failed assertions, read better without their "Error: " prefix
+		if obj, ok := exception.Value().(*goja.Object); ok && obj.Get("name") != nil && obj.Get("name").String() == "Error" {
+			return errors.New(obj.Get("message").String())
+		}
+		return errors.New(exception.Value().String())
+	}
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		if cause, ok := interrupted.Value().(error); ok {
+			return cause
+		}
+		return fmt.Errorf("%v", interrupted.Value())
+	}
+	return err
+}
+
+// scriptRun represents one run of a script and the objects it sees
+type scriptRun struct {
+	runner   *Runner
+	vm       *goja.Runtime
+	ex       *Exchange
+	stage    string
+	request  *goja.Object
+	failures []string
+}
+
+func (s *scriptRun) setup() error {
+	vm, ex := s.vm, s.ex
+	valida := vm.NewObject()
+	valida.Set("operation", ex.Operation)
+
+	s.request = vm.NewObject()
+	s.request.Set("method", ex.Request.Method)
+	s.request.Set("url", ex.Request.URL.String())
+	s.request.Set("body", string(ex.RequestBody))
+	s.request.Set("headers", s.headers(ex.Request.Header, true))
+	valida.Set("request", s.request)
+
+	if ex.Response != nil {
+		response := vm.NewObject()
+		response.Set("status", ex.Response.StatusCode)
+		response.Set("statusText", http.StatusText(ex.Response.StatusCode))
+		response.Set("headers", s.headers(ex.Response.Header, false))
+		response.Set("body", string(ex.ResponseBody))
+		response.Set("json", func() (goja.Value, error) {
+			parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+			return parse(goja.Undefined(), vm.ToValue(string(ex.ResponseBody)))
+		})
+		var elapsed float64
+		if ex.timing != nil {
+			elapsed = float64(ex.timing.Total.Microseconds()) / 1000
+		}
+		response.Set("time", elapsed)
+		valida.Set("response", response)
+	}
+
+	variables := vm.NewObject()
+	engine := s.runner.scripts
+	variables.Set("get", func(name string) goja.Value {
+		if value, ok := engine.variable(name); ok {
+			return vm.ToValue(value)
+		}
+		return goja.Undefined()
+	})
+	variables.Set("set", func(name string, value goja.Value) {
+		engine.setVariable(name, scriptString(value))
+	})
+	variables.Set("has", func(name string) bool {
+		_, ok := engine.variable(name)
+		return ok
+	})
+	variables.Set("unset", engine.unsetVariable)
+	valida.Set("variables", variables)
+
+	valida.Set("env", func(name string) goja.Value {
+		if value, ok := os.LookupEnv(name); ok {
+			return vm.ToValue(value)
+		}
+		return goja.Undefined()
+	})
+
+	valida.Set("test", func(call goja.FunctionCall) goja.Value {
+		name := call.Argument(0).String()
+		fn, ok := goja.AssertFunction(call.Argument(1))
+		if !ok {
+			panic(vm.NewTypeError("test %q needs a function", name))
+		}
+		_, err := fn(goja.Undefined())
+		if err == nil {
+			return goja.Undefined()
+		}
+		var exception *goja.Exception
+		if !errors.As(err, &exception) {
+			// interruptions stop the script rather than fail the test
+			panic(err)
+		}
+		s.failures = append(s.failures, fmt.Sprintf("test %q: %s", name, scriptError(err)))
+		return goja.Undefined()
+	})
+
+	log := func(call goja.FunctionCall) goja.Value {
+		var parts []string
+		for _, arg := range call.Arguments {
+			parts = append(parts, scriptString(arg))
+		}
+		ex.log.LogScript(s.stage, strings.Join(parts, " "))
+		return goja.Undefined()
+	}
+	valida.Set("log", log)
+	console := vm.NewObject()
+	console.Set("log", log)
+	vm.Set("console", console)
+
+	crypto := vm.NewObject()
+	crypto.Set("sha256", func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	})
+	crypto.Set("hmacSHA256", func(key, data string) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(data))
+		return hex.EncodeToString(mac.Sum(nil))
+	})
+	crypto.Set("base64", func(data string) string {
+		return base64.StdEncoding.EncodeToString([]byte(data))
+	})
+	crypto.Set("uuid", s.runner.fake.UUID)
+	valida.Set("crypto", crypto)
+
+	vm.Set("valida", valida)
+	if _, err := vm.RunProgram(scriptPrelude); err != nil {
+		return fmt.Errorf("setting up script runtime: %w", scriptError(err))
+	}
+	return nil
+}
+
+// headers exposes a header map to scripts, writable for requests
+func (s *scriptRun) headers(header http.Header, writable bool) *goja.Object {
+	h := s.vm.NewObject()
+	h.Set("get", func(name string) goja.Value {
+		values := header.Values(name)
+		if len(values) == 0 {
+			return goja.Undefined()
+		}
+		return s.vm.ToValue(strings.Join(values, ", "))
+	})
+	h.Set("has", func(name string) bool {
+		return len(header.Values(name)) > 0
+	})
+	h.Set("all", func() map[string]string {
+		all := make(map[string]string)
+		for name, values := range header {
+			all[name] = strings.Join(values, ", ")
+		}
+		return all
+	})
+	if writable {
+		h.Set("set", func(name string, value goja.Value) {
+			header.Set(name, scriptString(value))
+		})
+		h.Set("add", func(name string, value goja.Value) {
+			header.Add(name, scriptString(value))
+		})
+		h.Set("remove", func(name string) {
+			header.Del(name)
+		})
+	}
+	return h
+}
+
+// apply copies the method, URL and body left by a pre-request script to the exchange
+func (s *scriptRun) apply() error {
+	req := s.ex.Request
+	if method := scriptString(s.request.Get("method")); method != "" {
+		req.Method = strings.ToUpper(method)
+	}
+	if rawURL := scriptString(s.request.Get("url")); rawURL != req.URL.String() {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("script set an invalid URL: %w", err)
+		}
+		req.URL = u
+		req.Host = ""
+	}
+	s.ex.RequestBody = []byte(scriptString(s.request.Get("body")))
+	return nil
+}
+
+// scriptString converts a script value to a string, objects as JSON
+func scriptString(value goja.Value) string {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return ""
+	}
+	switch exported := value.Export().(type) {
+	case string:
+		return exported
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(exported)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return value.String()
+}
+
+// scriptPrelude defines valida.expect, chai-style assertions, and the pm
+// object of Postman scripts on top of the valida object
+var scriptPrelude = goja.MustCompile("prelude.js", `
+(function () {
+  function show(v) {
+    var s;
+    try { s = JSON.stringify(v); } catch (e) {}
+    if (s === undefined) s = String(v);
+    return s.length > 80 ? s.slice(0, 77) + "..." : s;
+  }
+
+  // statusCode reads the status of valida.response or the code of pm.response
+  function statusCode(response) {
+    return typeof response.code === "number" ? response.code : response.status;
+  }
+
+  function deepEqual(a, b) {
+    if (a === b) return true;
+    if (a !== a && b !== b) return true;
+    if (typeof a !== "object" || typeof b !== "object" || a === null || b === null) return false;
+    if (Array.isArray(a) !== Array.isArray(b)) return false;
+    var ka = Object.keys(a), kb = Object.keys(b);
+    if (ka.length !== kb.length) return false;
+    for (var i = 0; i < ka.length; i++) {
+      if (!Object.prototype.hasOwnProperty.call(b, ka[i]) || !deepEqual(a[ka[i]], b[ka[i]])) return false;
+    }
+    return true;
+  }
+
+  function typeOf(v) {
+    if (v === null) return "null";
+    if (Array.isArray(v)) return "array";
+    return typeof v;
+  }
+
+  function Assertion(value, negate) {
+    this.value = value;
+    this.negate = negate;
+  }
+
+  Assertion.prototype.check = function (ok, message) {
+    if (ok === this.negate) {
+      throw new Error("expected " + show(this.value) + (this.negate ? " not " : " ") + message);
+    }
+    return this;
+  };
+
+  ["to", "be", "been", "is", "that", "which", "and", "has", "have", "with", "at", "of", "same", "does", "deep"].forEach(function (word) {
+    Object.defineProperty(Assertion.prototype, word, { get: function () { return this; } });
+  });
+  Object.defineProperty(Assertion.prototype, "not", {
+    get: function () { return new Assertion(this.value, !this.negate); }
+  });
+
+  function getter(name, fn) {
+    Object.defineProperty(Assertion.prototype, name, { get: fn });
+  }
+  getter("ok", function () {
+    var v = this.value;
+    if (v && v.__response) return this.check(statusCode(v) >= 200 && statusCode(v) < 300, "to have a 2xx status");
+    return this.check(!!v, "to be truthy");
+  });
+  getter("true", function () { return this.check(this.value === true, "to be true"); });
+  getter("false", function () { return this.check(this.value === false, "to be false"); });
+  getter("null", function () { return this.check(this.value === null, "to be null"); });
+  getter("undefined", function () { return this.check(this.value === undefined, "to be undefined"); });
+  getter("exist", function () { return this.check(this.value !== null && this.value !== undefined, "to exist"); });
+  getter("empty", function () {
+    var v = this.value;
+    var empty = typeof v === "string" || Array.isArray(v) ? v.length === 0 : v !== null && typeof v === "object" && Object.keys(v).length === 0;
+    return this.check(empty, "to be empty");
+  });
+
+  function method(names, fn) {
+    names.forEach(function (name) { Assertion.prototype[name] = fn; });
+  }
+  method(["equal", "equals", "eq"], function (expected) {
+    return this.check(this.value === expected, "to equal " + show(expected));
+  });
+  method(["eql", "eqls"], function (expected) {
+    return this.check(deepEqual(this.value, expected), "to deeply equal " + show(expected));
+  });
+  method(["above", "gt", "greaterThan"], function (n) {
+    return this.check(this.value > n, "to be above " + show(n));
+  });
+  method(["below", "lt", "lessThan"], function (n) {
+    return this.check(this.value < n, "to be below " + show(n));
+  });
+  method(["least", "gte"], function (n) {
+    return this.check(this.value >= n, "to be at least " + show(n));
+  });
+  method(["most", "lte"], function (n) {
+    return this.check(this.value <= n, "to be at most " + show(n));
+  });
+  method(["include", "includes", "contain", "contains"], function (expected) {
+    var v = this.value, found = false;
+    if (typeof v === "string") {
+      found = v.indexOf(expected) !== -1;
+    } else if (Array.isArray(v)) {
+      found = v.some(function (item) { return deepEqual(item, expected); });
+    } else if (v !== null && typeof v === "object" && expected !== null && typeof expected === "object") {
+      found = Object.keys(expected).every(function (key) { return deepEqual(v[key], expected[key]); });
+    }
+    return this.check(found, "to include " + show(expected));
+  });
+  method(["match", "matches"], function (re) {
+    return this.check(re.test(String(this.value)), "to match " + String(re));
+  });
+  method(["property"], function (name, expected) {
+    var v = this.value;
+    var has = v !== null && v !== undefined && name in Object(v);
+    if (arguments.length > 1) {
+      return this.check(has && deepEqual(v[name], expected), "to have property " + show(name) + " of " + show(expected));
+    }
+    this.check(has, "to have property " + show(name));
+    return this.negate ? this : new Assertion(v[name], false);
+  });
+  method(["lengthOf", "length"], function (n) {
+    var v = this.value;
+    return this.check(v !== null && v !== undefined && v.length === n, "to have length " + n);
+  });
+  method(["oneOf"], function (list) {
+    var v = this.value;
+    return this.check(list.some(function (item) { return deepEqual(item, v); }), "to be one of " + show(list));
+  });
+  method(["a", "an"], function (type) {
+    return this.check(typeOf(this.value) === String(type).toLowerCase(), "to be a " + type);
+  });
+  method(["status"], function (code) {
+    var v = this.value;
+    if (typeof code === "string") {
+      return this.check(!!v && v.statusText === code, "to have status " + show(code));
+    }
+    return this.check(!!v && statusCode(v) === code, "to have status " + code);
+  });
+  method(["header"], function (name, expected) {
+    var headers = this.value && this.value.headers;
+    var actual = headers && headers.get(name);
+    if (arguments.length > 1) {
+      return this.check(actual === String(expected), "to have header " + name + ": " + expected);
+    }
+    return this.check(actual !== undefined, "to have header " + name);
+  });
+
+  valida.expect = function (value) { return new Assertion(value, false); };
+
+  var request = valida.request;
+  var pmHeaders = {
+    get: function (name) { return request.headers.get(name); },
+    has: function (name) { return request.headers.has(name); },
+    add: function (header) { request.headers.add(header.key, header.value); },
+    upsert: function (header) { request.headers.set(header.key, header.value); },
+    remove: function (name) { request.headers.remove(name); },
+    toObject: function () { return request.headers.all(); }
+  };
+  var pmRequest = { headers: pmHeaders, body: {} };
+  Object.defineProperty(pmRequest, "method", { get: function () { return request.method; }, set: function (v) { request.method = v; } });
+  Object.defineProperty(pmRequest, "url", { get: function () { return request.url; }, set: function (v) { request.url = String(v); } });
+  Object.defineProperty(pmRequest.body, "raw", { get: function () { return request.body; }, set: function (v) { request.body = v; } });
+  pmRequest.body.toString = function () { return request.body; };
+
+  var variables = valida.variables;
+  var pmVariables = {
+    get: variables.get,
+    set: variables.set,
+    has: variables.has,
+    unset: variables.unset,
+    replaceIn: function (s) {
+      return String(s).replace(/\{\{([^{}]+)\}\}/g, function (match, name) {
+        var value = variables.get(name.trim());
+        return value === undefined ? match : value;
+      });
+    }
+  };
+
+  var pm = {
+    environment: pmVariables,
+    variables: pmVariables,
+    collectionVariables: pmVariables,
+    globals: pmVariables,
+    request: pmRequest,
+    test: valida.test,
+    expect: valida.expect,
+    info: { requestName: valida.operation }
+  };
+
+  var response = valida.response;
+  if (response) {
+    Object.defineProperty(response, "__response", { value: true });
+    var pmResponse = {
+      code: response.status,
+      responseTime: response.time,
+      headers: response.headers,
+      json: response.json,
+      text: function () { return response.body; }
+    };
+    Object.defineProperty(pmResponse, "__response", { value: true });
+    pmResponse.status = response.statusText;
+    pmResponse.statusText = response.statusText;
+    Object.defineProperty(pmResponse, "to", { get: function () { return valida.expect(pmResponse); } });
+    pm.response = pmResponse;
+  }
+
+  globalThis.pm = pm;
+})();
+`, false)
@@ -0,0 +1,261 @@
+package apitest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sentRequest is a request as received by a recordingService
+type sentRequest struct {
+	method, uri, body string
+	header            http.Header
+}
+
+// recordingService answers every request with status and a JSON body, and
+// returns the requests it received
+func recordingService(t *testing.T, status int, body string) (*httptest.Server, func() []sentRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []sentRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, sentRequest{method: r.Method, uri: r.URL.RequestURI(), body: string(data), header: r.Header.Clone()})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []sentRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]sentRequest(nil), requests...)
+	}
+}
+
+// runTestScenario runs the steps against the orders spec served by server
+func runTestScenario(t *testing.T, cfg *Config, server *httptest.Server, steps ...*ScenarioStep) []TableRow {
+	t.Helper()
+	apiSpec := loadTestSpec(t, strings.Replace(ordersSpec, "http://localhost", server.URL, 1))
+	runner, err := NewRunner(RunnerOptions{Config: cfg, Log: LogOptions{File: "none"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	scenario := &Scenario{Variables: map[string]string{"baseUrl": server.URL}, Steps: steps}
+	if err := runner.Run(context.Background(), runner.PlanScenario(apiSpec, scenario)); err != nil {
+		t.Fatal(err)
+	}
+	return runner.Results()
+}
+
+func TestScenarioStepRunsOperationConfigScripts(t *testing.T) {
+	server, requests := recordingService(t, http.StatusCreated, `{}`)
+	cfg := &Config{
+		Scripts: &Scripts{PreRequest: `valida.request.headers.add("X-Order", "global")`},
+		Operations: map[string]*OperationConfig{
+			"createOrder": {Scripts: &Scripts{PreRequest: `valida.request.headers.add("X-Order", "operation")`}},
+		},
+	}
+
+	runTestScenario(t, cfg, server, &ScenarioStep{
+		Request: ScenarioRequest{Method: "POST", URL: "{{baseUrl}}/orders", Body: `{}`},
+		Scripts: &Scripts{PreRequest: `valida.request.headers.add("X-Order", "step")`},
+	})
+
+	sent := requests()
+	if len(sent) != 1 {
+		t.Fatalf("got %d requests, want 1", len(sent))
+	}
+	if got := strings.Join(sent[0].header.Values("X-Order"), ", "); got != "global, operation, step" {
+		t.Errorf("X-Order = %q, want the scripts of the config, operation and step in order", got)
+	}
+}
+
+// newScriptRunner returns a runner without log to run scripts with
+func newScriptRunner(t *testing.T, options RunnerOptions) *Runner {
+	t.Helper()
+	options.Log = LogOptions{File: "none"}
+	runner, err := NewRunner(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { runner.Close() })
+	return runner
+}
+
+func TestScriptTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { scriptTimeout = timeout }(scriptTimeout)
+	scriptTimeout = 50 * time.Millisecond
+
+	runner := newScriptRunner(t, RunnerOptions{})
+	_, err := runner.runScript(context.Background(), newTestExchange(t, ""), "test", `while (true) {}`)
+	if err == nil || err.Error() != "script did not finish within 50ms" {
+		t.Errorf("runScript() error = %v, want the script timeout", err)
+	}
+}
+
+func TestScriptStoppedByTheRun(t *testing.T) {
+	runner := newScriptRunner(t, RunnerOptions{RunTimeout: 50 * time.Millisecond})
+	ctx, cancel := runner.WithRunTimeout(context.Background())
+	defer cancel()
+
+	_, err := runner.runScript(ctx, newTestExchange(t, ""), "test", `while (true) {}`)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "run timeout of 50ms exceeded") {
+		t.Errorf("runScript() error = %v, want the run timeout", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = runner.runScript(ctx, newTestExchange(t, ""), "test", `while (true) {}`)
+	if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "run interrupted") {
+		t.Errorf("runScript() error = %v, want the cancelled run", err)
+	}
+}
+
+func TestPreRequestScriptChangesRequest(t *testing.T) {
+	runner := newScriptRunner(t, RunnerOptions{})
+	ex := newTestExchange(t, `{"name": "Rex"}`)
+	ex.Request.Header.Set("X-Remove", "1")
+	ex.scripts = []*Scripts{
+		{PreRequest: `
+var body = JSON.parse(valida.request.body);
+body.name = body.name.toUpperCase();
+valida.request.body = body;
+valida.request.headers.set("X-Signature", valida.crypto.hmacSHA256("key", valida.request.body));
+valida.request.headers.remove("X-Remove");
+valida.request.url = valida.request.url + "?dryRun=true";
+valida.request.method = "put";
+`},
+		{PreRequest: `pm.request.headers.upsert({key: "X-Name", value: JSON.parse(pm.request.body.raw).name})`},
+	}
+
+	if err := runner.runPreRequestScripts(context.Background(), ex); err != nil {
+		t.Fatal(err)
+	}
+	req := ex.Request
+	if req.Method != http.MethodPut || req.URL.String() != "http://api.valida.test/pets?dryRun=true" {
+		t.Errorf("request = %s %s, want PUT with the query added", req.Method, req.URL)
+	}
+	if string(ex.RequestBody) != `{"name":"REX"}` {
+		t.Errorf("body = %s, want the changed body", ex.RequestBody)
+	}
+	if req.Header.Get("X-Signature") == "" || req.Header.Get("X-Name") != "REX" || req.Header.Get("X-Remove") != "" {
+		t.Errorf("headers = %v, want X-Signature and X-Name set and X-Remove removed", req.Header)
+	}
+}
+
+func TestPreRequestScriptErrors(t *testing.T) {
+	tests := []struct {
+		script, want string
+	}{
+		{`throw new Error("no token")`, "pre-request script: no token"},
+		{`valida.request.url = "http://[::1"`, "pre-request script: script set an invalid URL"},
+		{`valida.request.body = `, "pre-request script: SyntaxError"},
+		{`valida.expect(1).to.equal(2)`, "pre-request script: expected 1 to equal 2"},
+	}
+	runner := newScriptRunner(t, RunnerOptions{})
+	for _, tt := range tests {
+		ex := newTestExchange(t, "")
+		ex.scripts = []*Scripts{{PreRequest: tt.script}}
+		if err := runner.runPreRequestScripts(context.Background(), ex); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.script, err, tt.want)
+		}
+	}
+}
+
+func TestTestScriptFailures(t *testing.T) {
+	tests := []struct {
+		script, want string
+	}{
+		{`valida.test("status", function () { valida.expect(valida.response).to.have.status(200); })`, ""},
+		{`valida.test("status", function () { valida.expect(valida.response.status).to.equal(201); })`, `test "status": expected 200 to equal 201`},
+		{`valida.test("name", function () { valida.expect(valida.response.json()).to.have.property("name", "Max"); });
+valida.test("tag", function () { valida.expect(valida.response.json()).to.have.property("tag"); });`,
+			`test "name": expected {"name":"Rex"} to have property "name" of "Max"; test "tag": expected {"name":"Rex"} to have property "tag"`},
+		{`pm.test("pm", function () { pm.response.to.have.status(404); })`, `test "pm": expected`},
+		{`valida.test("negated", function () { valida.expect([1, 2]).to.not.include(2); })`, `test "negated": expected [1,2] not to include 2`},
+		{`valida.test("thrown", function () { throw new TypeError("bad"); })`, `test "thrown": TypeError: bad`},
+		{`valida.expect(valida.response.body).to.be.empty`, `test script: expected "{\"name\":\"Rex\"}" to be empty`},
+	}
+	runner := newScriptRunner(t, RunnerOptions{})
+	for _, tt := range tests {
+		ex := newTestExchange(t, "")
+		ex.scripts = []*Scripts{{Test: tt.script}}
+		err := runner.runTestScripts(context.Background(), ex)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: error = %v, want none", tt.script, err)
+		case tt.want != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.want)):
+			t.Errorf("%s: error = %v, want %q", tt.script, err, tt.want)
+		}
+	}
+}
+
+func TestScriptVariablesAcrossSteps(t *testing.T) {
+	server, requests := recordingService(t, http.StatusCreated, `{"id": "o-42"}`)
+	rows := runTestScenario(t, nil, server,
+		&ScenarioStep{
+			Name:    "create",
+			Request: ScenarioRequest{Method: "POST", URL: "{{baseUrl}}/orders", Body: `{}`},
+			Scripts: &Scripts{Test: `pm.environment.set("orderId", pm.response.json().id)`},
+		},
+		&ScenarioStep{
+			Name:    "read",
+			Request: ScenarioRequest{Method: "GET", URL: "{{baseUrl}}/orders/{{orderId}}"},
+			Scripts: &Scripts{PreRequest: `pm.request.headers.add({key: "X-Order", value: pm.environment.get("orderId")})`},
+		},
+	)
+
+	sent := requests()
+	if len(rows) != 2 || len(sent) != 2 {
+		t.Fatalf("got %d rows and %d requests, want 2", len(rows), len(sent))
+	}
+	if sent[1].uri != "/orders/o-42" || sent[1].header.Get("X-Order") != "o-42" {
+		t.Errorf("second request = %s with X-Order %q, want the order id set by the first", sent[1].uri, sent[1].header.Get("X-Order"))
+	}
+}
+
+func TestParseScripts(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    *Scripts
+		wantErr string
+	}{
+		{map[string]interface{}{"preRequest": "a()", "test": "b()"}, &Scripts{PreRequest: "a()", Test: "b()"}, ""},
+		{map[string]interface{}{"test": "b()"}, &Scripts{Test: "b()"}, ""},
+		{"a()", nil, "expected an object"},
+		{map[string]interface{}{"test": 1.0}, nil, "script test is a float64"},
+		{map[string]interface{}{"after": "c()"}, nil, `unknown script "after"`},
+	}
+	for _, tt := range tests {
+		got, err := parseScripts(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseScripts(%v) error = %v, want %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || *got != *tt.want {
+			t.Errorf("parseScripts(%v) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+		}
+	}
+
+	spec := strings.Replace(proxySpec, "      operationId: listPets\n", `      operationId: listPets
+      x-valida-script:
+        test: valida.expect(valida.response.status).to.equal(200)
+`, 1)
+	operation := loadTestSpec(t, spec).Paths["/pets"].Operations["get"]
+	if operation.Scripts == nil || operation.Scripts.Test != "valida.expect(valida.response.status).to.equal(200)" {
+		t.Errorf("scripts of the operation = %+v", operation.Scripts)
+	}
+}
@@ -0,0 +1,825 @@
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Security probes, as named by the --probe flag and the security report
+const (
+	ProbeNoCredentials      = "no-credentials"
+	ProbeInvalidCredentials = "invalid-credentials"
+	ProbeOtherUser          = "other-user"
+)
+
+// Outcomes of a security probe
+const (
+	SecurityFinding      = "finding"
+	SecurityPassed       = "passed"
+	SecurityInconclusive = "inconclusive"
+	SecuritySkipped      = "skipped"
+	SecurityError        = "error"
+)
+
+// SecurityOptions represents the settings of a security run. The first user
+// owns the resources whose ids are requested, the second one tries to access
+// them.
+type SecurityOptions struct {
+	Users []SecurityUser `mapstructure:"users"`
+	// Probes selects the probes to run, all of them when empty
+	Probes []string `mapstructure:"probes"`
+	// IncludeUnsafe probes the operations with methods that may change or
+	// delete data, such as POST and DELETE, which are skipped otherwise
+	IncludeUnsafe bool `mapstructure:"includeUnsafe"`
+}
+
+// SecurityUser represents the credentials of a user, keyed by the name of the
+// security scheme of the spec, and the ids of the resources the user owns,
+// keyed by parameter name. Credentials may use {{env.NAME}} templates.
+type SecurityUser struct {
+	Name        string                 `mapstructure:"name"`
+	Credentials map[string]string      `mapstructure:"credentials"`
+	Resources   map[string]interface{} `mapstructure:"resources"`
+}
+
+// SecurityResult represents the outcome of one probe of an operation
+type SecurityResult struct {
+	Operation string   `json:"operation"`
+	Method    string   `json:"method"`
+	Path      string   `json:"path"`
+	URL       string   `json:"url,omitempty"`
+	Probe     string   `json:"probe"`
+	Schemes   []string `json:"schemes"`
+	Status    int      `json:"status,omitempty"`
+	Outcome   string   `json:"outcome"`
+	Message   string   `json:"message"`
+	Command   string   `json:"command,omitempty"`
+}
+
+// SecurityReport represents the results of a security run
+type SecurityReport struct {
+	Spec     string `json:"spec,omitempty"`
+	Probes   int    `json:"probes"`
+	Findings int    `json:"findings"`
+	// Unprotected lists the operations without security requirements, which
+	// are not probed
+	Unprotected []string          `json:"unprotected,omitempty"`
+	Results     []*SecurityResult `json:"results"`
+}
+
+// securityTarget represents a protected operation of the spec
+type securityTarget struct {
+	name         string
+	path         string
+	pathItem     *PathItem
+	operation    *Operation
+	opConfig     *OperationConfig
+	requirements openapi3.SecurityRequirements
+	schemes      map[string]*openapi3.SecurityScheme
+}
+
+// RunSecurity probes every operation protected by a security requirement of
+// the spec: without credentials, with invalid credentials, and with the
+// credentials of the second user on the resources of the first one. A 2xx
+// response to any probe is a finding.
+func (r *Runner) RunSecurity(ctx context.Context, apiSpec *APISpec, options SecurityOptions) (*SecurityReport, error) {
+	probes := map[string]bool{}
+	for _, probe := range options.Probes {
+		switch probe {
+		case ProbeNoCredentials, ProbeInvalidCredentials, ProbeOtherUser:
+			probes[probe] = true
+		default:
+			return nil, fmt.Errorf("unknown security probe %q, expected %s, %s or %s", probe, ProbeNoCredentials, ProbeInvalidCredentials, ProbeOtherUser)
+		}
+	}
+	if len(probes) == 0 {
+		probes = map[string]bool{ProbeNoCredentials: true, ProbeInvalidCredentials: true, ProbeOtherUser: true}
+	}
+
+	var owner, other *SecurityUser
+	if len(options.Users) > 0 {
+		owner = &options.Users[0]
+	}
+	if len(options.Users) > 1 {
+		other = &options.Users[1]
+	}
+
+	targets, unprotected, err := r.securityTargets(apiSpec)
+	if err != nil {
+		return nil, err
+	}
+	report := &SecurityReport{Unprotected: unprotected}
+
+	var results []*SecurityResult
+	var cases []TestCase
+	for _, target := range targets {
+		for _, probe := range []string{ProbeNoCredentials, ProbeInvalidCredentials, ProbeOtherUser} {
+			if !probes[probe] {
+				continue
+			}
+			result := &SecurityResult{
+				Operation: target.name,
+				Method:    strings.ToUpper(target.operation.Method),
+				Path:      target.path,
+				Probe:     probe,
+				Schemes:   requirementSchemes(target.requirements),
+			}
+			results = append(results, result)
+			cases = append(cases, TestCase{Name: fmt.Sprintf("%s [%s]", target.name, probe), Run: func(caseCtx context.Context) TableRow {
+				if !options.IncludeUnsafe && !isSafeMethod(result.Method) {
+					result.skip("unsafe method, include it with --include-unsafe")
+					return result.row()
+				}
+				r.runProbe(caseCtx, apiSpec, target, probe, owner, other, result)
+				if ctx.Err() != nil {
+					// interrupted, left out of the report as the row is left out of the results
+					result.Outcome = ""
+				}
+				return result.row()
+			}})
+		}
+	}
+
+	runErr := r.Run(ctx, cases)
+	for _, result := range results {
+		if result.Outcome == "" {
+			continue
+		}
+		report.Results = append(report.Results, result)
+		if result.Outcome == SecurityFinding {
+			report.Findings++
+		}
+	}
+	report.Probes = len(report.Results)
+	return report, runErr
+}
+
+// securityTargets returns the protected operations of the spec, and the names
+// of those that declare no security requirement
+func (r *Runner) securityTargets(apiSpec *APISpec) ([]*securityTarget, []string, error) {
+	var schemes openapi3.SecuritySchemes
+	if apiSpec.Spec.Components != nil {
+		schemes = apiSpec.Spec.Components.SecuritySchemes
+	}
+
+	var paths []string
+	for path := range apiSpec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var targets []*securityTarget
+	var unprotected []string
+	for _, path := range paths {
+		pathItem := apiSpec.Paths[path]
+		var methods []string
+		for method := range pathItem.Operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			operation := pathItem.Operations[method]
+			name := operationName(path, operation)
+
+			requirements := apiSpec.Spec.Security
+			if specPath := apiSpec.Spec.Paths.Value(path); specPath != nil {
+				if specOperation := specPath.GetOperation(strings.ToUpper(method)); specOperation != nil && specOperation.Security != nil {
+					requirements = *specOperation.Security
+				}
+			}
+			if !isProtected(requirements) {
+				unprotected = append(unprotected, name)
+				continue
+			}
+
+			target := &securityTarget{
+				name:         name,
+				path:         path,
+				pathItem:     pathItem,
+				operation:    operation,
+				opConfig:     r.config.findOperationConfig(path, operation),
+				requirements: requirements,
+				schemes:      make(map[string]*openapi3.SecurityScheme),
+			}
+			for _, requirement := range requirements {
+				for schemeName := range requirement {
+					ref := schemes[schemeName]
+					if ref == nil || ref.Value == nil {
+						return nil, nil, fmt.Errorf("%s requires the undefined security scheme %s", name, schemeName)
+					}
+					target.schemes[schemeName] = ref.Value
+				}
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets, unprotected, nil
+}
+
+// isProtected reports whether the security requirements demand credentials.
+// An empty requirement makes them optional.
+func isProtected(requirements openapi3.SecurityRequirements) bool {
+	if len(requirements) == 0 {
+		return false
+	}
+	for _, requirement := range requirements {
+		if len(requirement) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func requirementSchemes(requirements openapi3.SecurityRequirements) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, requirement := range requirements {
+		for name := range requirement {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// userRequirement returns the first requirement the user has all the
+// credentials for, or nil
+func userRequirement(requirements openapi3.SecurityRequirements, user *SecurityUser) openapi3.SecurityRequirement {
+	if user == nil {
+		return nil
+	}
+	for _, requirement := range requirements {
+		complete := true
+		for name := range requirement {
+			if _, ok := user.credential(name); !ok {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			return requirement
+		}
+	}
+	return nil
+}
+
+// runProbe sends the requests of a probe and records its outcome in result
+func (r *Runner) runProbe(ctx context.Context, apiSpec *APISpec, target *securityTarget, probe string, owner, other *SecurityUser, result *SecurityResult) {
+	caseLog := r.logger.forCase(target.name)
+
+	opConfig := target.opConfig
+	if probe == ProbeOtherUser {
+		if other == nil {
+			result.skip("needs the credentials of a second user")
+			return
+		}
+		if owner != nil {
+			opConfig = withResources(opConfig, owner.Resources)
+		}
+		var missing []string
+		for _, param := range target.operation.Parameters {
+			if param["in"] != "path" {
+				continue
+			}
+			name, _ := param["name"].(string)
+			if _, ok := r.lookupParameter(opConfig, "path", name); !ok {
+				missing = append(missing, name)
+			}
+		}
+		switch {
+		case !strings.Contains(target.path, "{"):
+			result.skip("the path has no resource id")
+			return
+		case len(missing) > 0:
+			result.skip(fmt.Sprintf("no resource id of the first user for %s", strings.Join(missing, ", ")))
+			return
+		case userRequirement(target.requirements, other) == nil:
+			result.skip(fmt.Sprintf("the second user has no credentials for %s", strings.Join(result.Schemes, " or ")))
+			return
+		}
+	}
+
+	base, requestBody := r.prepareRequest(apiSpec, target.pathItem, target.operation, opConfig)
+	if base == nil {
+		result.Outcome, result.Message = SecurityError, "request preparation error"
+		return
+	}
+	result.URL = r.redact.maskURL(base.URL)
+
+	// the first user must reach its own resource for the probe to mean anything
+	checkOwner := probe == ProbeOtherUser && userRequirement(target.requirements, owner) != nil
+	ownerReaches := func() bool {
+		resp, _, err := r.sendProbe(ctx, caseLog, target, base, requestBody, r.userCredentials(target, owner))
+		if err != nil {
+			result.Outcome, result.Message = SecurityError, err.Error()
+			return false
+		}
+		if !isSuccess(resp.StatusCode) {
+			result.Status = resp.StatusCode
+			result.Outcome = SecurityInconclusive
+			result.Message = fmt.Sprintf("the first user got %s on its own resource, check its resource ids", resp.Status)
+			return false
+		}
+		return true
+	}
+	// an unsafe request of the first user may change or delete its resource,
+	// so it is only sent after the second user was turned away
+	if checkOwner && isSafeMethod(base.Method) && !ownerReaches() {
+		return
+	}
+
+	var credentials func(req *http.Request)
+	switch probe {
+	case ProbeNoCredentials:
+		credentials = func(req *http.Request) { r.removeCredentials(req, target) }
+	case ProbeInvalidCredentials:
+		invalid := make(map[string]string)
+		for name := range target.requirements[0] {
+			invalid[name] = r.invalidCredential(target.schemes[name])
+		}
+		credentials = func(req *http.Request) {
+			r.removeCredentials(req, target)
+			for name, value := range invalid {
+				r.applyCredential(req, target.schemes[name], value)
+			}
+		}
+	case ProbeOtherUser:
+		credentials = r.userCredentials(target, other)
+	}
+
+	resp, req, err := r.sendProbe(ctx, caseLog, target, base, requestBody, credentials)
+	if req != nil {
+		result.URL = r.redact.maskURL(req.URL)
+		result.Command = r.reproduceCommand(req, requestBodyText(req))
+	}
+	if err != nil {
+		result.Outcome, result.Message = SecurityError, err.Error()
+		return
+	}
+	result.Status = resp.StatusCode
+	if !isSuccess(resp.StatusCode) {
+		if checkOwner && !isSafeMethod(base.Method) && !ownerReaches() {
+			return
+		}
+		result.Outcome, result.Message = SecurityPassed, fmt.Sprintf("rejected with %s", resp.Status)
+		caseLog.LogResult("PASS")
+		return
+	}
+
+	result.Outcome = SecurityFinding
+	switch probe {
+	case ProbeNoCredentials:
+		result.Message = fmt.Sprintf("accepted a request without credentials with %s", resp.Status)
+	case ProbeInvalidCredentials:
+		result.Message = fmt.Sprintf("accepted invalid credentials with %s", resp.Status)
+	case ProbeOtherUser:
+		result.Message = fmt.Sprintf("%s accessed a resource of %s with %s", userName(other, "the second user"), userName(owner, "the first user"), resp.Status)
+	}
+	caseLog.LogResult("FAIL: " + result.Message)
+}
+
+// userCredentials returns a function replacing the credentials of a request
+// with those of the user
+func (r *Runner) userCredentials(target *securityTarget, user *SecurityUser) func(req *http.Request) {
+	values := make(map[string]string)
+	for name := range userRequirement(target.requirements, user) {
+		value, _ := user.credential(name)
+		values[name], _ = renderTemplate(r.fake, value).(string)
+	}
+	return func(req *http.Request) {
+		r.removeCredentials(req, target)
+		for name, value := range values {
+			r.applyCredential(req, target.schemes[name], value)
+		}
+	}
+}
+
+// sendProbe sends a copy of the base request with the given credentials. They
+// are set again after the hooks and scripts ran, so that credentials added by
+// these do not change the probe.
+func (r *Runner) sendProbe(ctx context.Context, caseLog *Logger, target *securityTarget, base *http.Request, requestBody string, credentials func(req *http.Request)) (*http.Response, *http.Request, error) {
+	req := base.Clone(ctx)
+	req.Header = base.Header.Clone()
+	if requestBody != "" {
+		req.Body = io.NopCloser(strings.NewReader(requestBody))
+	}
+	credentials(req)
+
+	ex := &Exchange{Operation: target.name, Request: req, RequestBody: []byte(requestBody), log: caseLog}
+	ex.scripts = r.config.requestScripts(target.operation, target.opConfig.scripts())
+	if err := r.beforeRequest(ctx, ex); err != nil {
+		return nil, nil, err
+	}
+	req = ex.Request
+	credentials(req)
+
+	caseLog.LogRequest(req, string(ex.RequestBody))
+	resp, body, timing, err := r.sendWithRetry(ctx, caseLog, req)
+	if err != nil && resp == nil {
+		return nil, req, fmt.Errorf("error doing request: %w", err)
+	}
+	if err != nil {
+		return nil, req, fmt.Errorf("error reading body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if r.har != nil {
+		r.har.record(r.redact, req, resp, string(body), timing)
+	}
+	caseLog.LogResponse(resp, string(body))
+	caseLog.LogTiming(timing)
+	return resp, req, nil
+}
+
+// applyCredential sets the credential of a security scheme on the request
+func (r *Runner) applyCredential(req *http.Request, scheme *openapi3.SecurityScheme, value string) {
+	switch scheme.Type {
+	case "http":
+		switch strings.ToLower(scheme.Scheme) {
+		case "basic":
+			if strings.Contains(value, ":") {
+				value = base64.StdEncoding.EncodeToString([]byte(value))
+			}
+			req.Header.Set("Authorization", "Basic "+value)
+		case "bearer":
+			req.Header.Set("Authorization", "Bearer "+value)
+		default:
+			req.Header.Set("Authorization", scheme.Scheme+" "+value)
+		}
+	case "apiKey":
+		switch scheme.In {
+		case "header":
+			req.Header.Set(scheme.Name, value)
+		case "query":
+			setQueryParam(req.URL, scheme.Name, value)
+		case "cookie":
+			removeCookie(req, scheme.Name)
+			req.AddCookie(&http.Cookie{Name: scheme.Name, Value: value})
+		}
+	case "oauth2", "openIdConnect":
+		req.Header.Set("Authorization", "Bearer "+value)
+	}
+}
+
+// removeCredentials removes the credentials of every security scheme of the
+// operation from the request
+func (r *Runner) removeCredentials(req *http.Request, target *securityTarget) {
+	for _, scheme := range target.schemes {
+		switch scheme.Type {
+		case "http", "oauth2", "openIdConnect":
+			req.Header.Del("Authorization")
+		case "apiKey":
+			switch scheme.In {
+			case "header":
+				req.Header.Del(scheme.Name)
+			case "query":
+				removeQueryParam(req.URL, scheme.Name)
+			case "cookie":
+				removeCookie(req, scheme.Name)
+			}
+		}
+	}
+}
+
+// invalidCredential returns a well-formed but wrong credential for the scheme
+func (r *Runner) invalidCredential(scheme *openapi3.SecurityScheme) string {
+	if scheme.Type == "http" && strings.EqualFold(scheme.Scheme, "basic") {
+		return "invalid:" + r.fake.Password(true, true, true, false, false, 16)
+	}
+	return "invalid-" + r.fake.UUID()
+}
+
+// setQueryParam replaces the query parameter of a URL, or appends it, leaving
+// the order and encoding of the other parameters as they were serialized
+func setQueryParam(u *url.URL, name, value string) {
+	removeQueryParam(u, name)
+	param := url.QueryEscape(name) + "=" + url.QueryEscape(value)
+	if u.RawQuery == "" {
+		u.RawQuery = param
+	} else {
+		u.RawQuery += "&" + param
+	}
+}
+
+// removeQueryParam removes every value of the query parameter of a URL,
+// leaving the other parameters untouched
+func removeQueryParam(u *url.URL, name string) {
+	if u.RawQuery == "" {
+		return
+	}
+	var kept []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		if decoded, err := url.QueryUnescape(key); err == nil && decoded == name {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	u.RawQuery = strings.Join(kept, "&")
+}
+
+func removeCookie(req *http.Request, name string) {
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			req.AddCookie(cookie)
+		}
+	}
+}
+
+// withResources returns a copy of the operation config using the resource
+// ids as path and query parameters
+func withResources(opConfig *OperationConfig, resources map[string]interface{}) *OperationConfig {
+	if len(resources) == 0 {
+		return opConfig
+	}
+	merged := &OperationConfig{}
+	if opConfig != nil {
+		*merged = *opConfig
+	}
+	merged.Parameters = make(map[string]map[string]interface{})
+	if opConfig != nil {
+		for in, params := range opConfig.Parameters {
+			merged.Parameters[in] = make(map[string]interface{})
+			for name, value := range params {
+				merged.Parameters[in][name] = value
+			}
+		}
+	}
+	for _, in := range []string{"path", "query"} {
+		if merged.Parameters[in] == nil {
+			merged.Parameters[in] = make(map[string]interface{})
+		}
+		for name, value := range resources {
+			merged.Parameters[in][name] = value
+		}
+	}
+	return merged
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func isSuccess(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// credential returns the credential of the user for a security scheme. The
+// names are matched regardless of case, as the config file lowercases them.
+func (user *SecurityUser) credential(scheme string) (string, bool) {
+	if value, ok := user.Credentials[scheme]; ok {
+		return value, true
+	}
+	for name, value := range user.Credentials {
+		if strings.EqualFold(name, scheme) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func userName(user *SecurityUser, fallback string) string {
+	if user == nil || user.Name == "" {
+		return fallback
+	}
+	return user.Name
+}
+
+func (result *SecurityResult) skip(reason string) {
+	result.Outcome, result.Message = SecuritySkipped, reason
+}
+
+// row returns the result as a row of the results table
+func (result *SecurityResult) row() TableRow {
+	endpoint := result.URL
+	if endpoint == "" {
+		endpoint = result.Path
+	}
+	row := TableRow{
+		Endpoint:  fmt.Sprintf("%s [%s]", endpoint, result.Probe),
+		Method:    result.Method,
+		Response:  "N/A",
+		Command:   result.Command,
+		Operation: result.Operation,
+	}
+	if result.Status != 0 {
+		row.Response = fmt.Sprintf("%d %s", result.Status, http.StatusText(result.Status))
+	}
+	switch result.Outcome {
+	case SecurityPassed:
+		row.Assertion = "PASS"
+	case SecurityFinding, SecurityError:
+		row.Assertion = "FAIL: " + result.Message
+	default:
+		row.Assertion = fmt.Sprintf("WARNING: %s, %s", result.Outcome, result.Message)
+	}
+	return row
+}
+
+// DisplaySecurityReport prints the results of the probes followed by a summary
+func DisplaySecurityReport(report *SecurityReport) {
+	var rows []TableRow
+	for _, result := range report.Results {
+		rows = append(rows, result.row())
+	}
+	DisplayTable(rows)
+
+	fmt.Println()
+	fmt.Println(totalStyle.Render("Security"))
+	counts := make(map[string]int)
+	for _, result := range report.Results {
+		counts[result.Outcome]++
+	}
+	fmt.Printf("%d probes: %d findings, %d passed, %d inconclusive, %d skipped, %d errors\n", report.Probes,
+		counts[SecurityFinding], counts[SecurityPassed], counts[SecurityInconclusive], counts[SecuritySkipped], counts[SecurityError])
+	if len(report.Unprotected) > 0 {
+		fmt.Printf("Operations without security requirements, not probed: %s\n", strings.Join(report.Unprotected, ", "))
+	}
+}
+
+// WriteSecurityReport writes the security report as JSON
+func WriteSecurityReport(report *SecurityReport, filePath string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding security report: %w", err)
+	}
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		return fmt.Errorf("writing security report: %w", err)
+	}
+	return nil
+}
+
+// securityRules describes the finding of each probe in SARIF reports
+var securityRules = map[string]sarifRule{
+	ProbeNoCredentials: {
+		ID:               "missing-authentication",
+		Name:             "MissingAuthentication",
+		ShortDescription: sarifMessage{Text: "Protected operation accepts requests without credentials"},
+		FullDescription:  sarifMessage{Text: "An operation with a security requirement returned a 2xx response to a request without credentials."},
+		Properties:       sarifRuleProperties{Tags: []string{"security", "external/cwe/cwe-306"}, SecuritySeverity: "9.1"},
+	},
+	ProbeInvalidCredentials: {
+		ID:               "invalid-credentials-accepted",
+		Name:             "InvalidCredentialsAccepted",
+		ShortDescription: sarifMessage{Text: "Protected operation accepts invalid credentials"},
+		FullDescription:  sarifMessage{Text: "An operation with a security requirement returned a 2xx response to a request with invalid credentials."},
+		Properties:       sarifRuleProperties{Tags: []string{"security", "external/cwe/cwe-287"}, SecuritySeverity: "9.1"},
+	},
+	ProbeOtherUser: {
+		ID:               "broken-object-level-authorization",
+		Name:             "BrokenObjectLevelAuthorization",
+		ShortDescription: sarifMessage{Text: "A user can access the resources of another user (BOLA/IDOR)"},
+		FullDescription:  sarifMessage{Text: "An operation returned a 2xx response to a user requesting a resource id of another user."},
+		Properties:       sarifRuleProperties{Tags: []string{"security", "external/cwe/cwe-639"}, SecuritySeverity: "8.1"},
+	},
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver struct {
+		Name           string      `json:"name"`
+		Version        string      `json:"version,omitempty"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	} `json:"driver"`
+}
+
+type sarifRule struct {
+	ID               string              `json:"id"`
+	Name             string              `json:"name"`
+	ShortDescription sarifMessage        `json:"shortDescription"`
+	FullDescription  sarifMessage        `json:"fullDescription"`
+	Properties       sarifRuleProperties `json:"properties"`
+}
+
+type sarifRuleProperties struct {
+	Tags             []string `json:"tags"`
+	SecuritySeverity string   `json:"security-severity"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation struct {
+		URI string `json:"uri"`
+	} `json:"artifactLocation"`
+	Region struct {
+		StartLine int `json:"startLine"`
+	} `json:"region"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// WriteSecuritySARIF writes the findings of the security report as SARIF
+// 2.1.0, located at the path of their operation in the spec file
+func WriteSecuritySARIF(report *SecurityReport, filePath, version string) error {
+	var specLines []string
+	if report.Spec != "" {
+		if data, err := os.ReadFile(report.Spec); err == nil {
+			specLines = strings.Split(string(data), "\n")
+		}
+	}
+
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "valida"
+	run.Tool.Driver.Version = version
+	run.Tool.Driver.InformationURI = "https://github.com/elangbayu/valida"
+	for _, probe := range []string{ProbeNoCredentials, ProbeInvalidCredentials, ProbeOtherUser} {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, securityRules[probe])
+	}
+
+	for _, result := range report.Results {
+		if result.Outcome != SecurityFinding {
+			continue
+		}
+		location := sarifLocation{LogicalLocations: []sarifLogicalLocation{
+			{Name: result.Operation, FullyQualifiedName: result.Method + " " + result.Path, Kind: "function"},
+		}}
+		if specLines != nil {
+			location.PhysicalLocation = &sarifPhysicalLocation{}
+			location.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(report.Spec)
+			location.PhysicalLocation.Region.StartLine = specLine(specLines, result.Path)
+		}
+
+		run.Results = append(run.Results, sarifResult{
+			RuleID:              securityRules[result.Probe].ID,
+			Level:               "error",
+			Message:             sarifMessage{Text: fmt.Sprintf("%s %s %s", result.Method, result.Path, result.Message)},
+			Locations:           []sarifLocation{location},
+			PartialFingerprints: map[string]string{"operation/v1": result.Method + " " + result.Path + " " + result.Probe},
+		})
+	}
+
+	data, err := json.MarshalIndent(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding SARIF report: %w", err)
+	}
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		return fmt.Errorf("writing SARIF report: %w", err)
+	}
+	return nil
+}
+
+// specLine returns the line of the spec declaring the path, or 1
+func specLine(lines []string, path string) int {
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		for _, key := range []string{path, strconv.Quote(path), "'" + path + "'"} {
+			if strings.HasPrefix(trimmed, key+":") {
+				return i + 1
+			}
+		}
+	}
+	return 1
+}
@@ -0,0 +1,197 @@
+package apitest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const securitySpec = `openapi: 3.0.3
+info:
+  title: Orders
+  version: "1.0"
+servers:
+  - url: http://localhost
+components:
+  securitySchemes:
+    apiKey:
+      type: apiKey
+      in: query
+      name: api_key
+security:
+  - apiKey: []
+paths:
+  /orders/{orderId}:
+    parameters:
+      - name: orderId
+        in: path
+        required: true
+        schema:
+          type: string
+    get:
+      operationId: getOrder
+      responses:
+        "200":
+          description: An order
+    delete:
+      operationId: deleteOrder
+      responses:
+        "204":
+          description: Deleted
+`
+
+// orderService lets the owner of order 1001 read and delete it. A vulnerable
+// service also lets the second user delete it.
+func orderService(t *testing.T, vulnerable bool) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("api_key")
+		mu.Lock()
+		requests = append(requests, r.Method+" "+key)
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path != "/orders/1001":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodDelete && (key == "alice-key" || key == "bob-key" && vulnerable):
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && key == "alice-key":
+			w.WriteHeader(http.StatusOK)
+		case key == "bob-key":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+func runSecurity(t *testing.T, includeUnsafe, vulnerable bool) (*SecurityReport, []string) {
+	t.Helper()
+	server, requests := orderService(t, vulnerable)
+	apiSpec := loadTestSpec(t, strings.Replace(securitySpec, "http://localhost", server.URL, 1))
+	runner, err := NewRunner(RunnerOptions{Log: LogOptions{File: "none"}, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	report, err := runner.RunSecurity(context.Background(), apiSpec, SecurityOptions{
+		Users: []SecurityUser{
+			{Name: "alice", Credentials: map[string]string{"apiKey": "alice-key"}, Resources: map[string]interface{}{"orderId": "1001"}},
+			{Name: "bob", Credentials: map[string]string{"apiKey": "bob-key"}},
+		},
+		IncludeUnsafe: includeUnsafe,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report, requests()
+}
+
+func outcomes(report *SecurityReport) map[string]string {
+	got := make(map[string]string)
+	for _, result := range report.Results {
+		got[result.Operation+" "+result.Probe] = result.Outcome
+	}
+	return got
+}
+
+func TestRunSecuritySkipsUnsafeMethods(t *testing.T) {
+	report, requests := runSecurity(t, false, true)
+
+	want := map[string]string{
+		"deleteOrder no-credentials":      SecuritySkipped,
+		"deleteOrder invalid-credentials": SecuritySkipped,
+		"deleteOrder other-user":          SecuritySkipped,
+		"getOrder no-credentials":         SecurityPassed,
+		"getOrder invalid-credentials":    SecurityPassed,
+		"getOrder other-user":             SecurityPassed,
+	}
+	got := outcomes(report)
+	for probe, outcome := range want {
+		if got[probe] != outcome {
+			t.Errorf("%s = %q, want %q", probe, got[probe], outcome)
+		}
+	}
+	for _, request := range requests {
+		if strings.HasPrefix(request, http.MethodDelete) {
+			t.Errorf("sent %s without --include-unsafe", request)
+		}
+	}
+	for _, result := range report.Results {
+		if strings.Contains(result.URL, "-key") {
+			t.Errorf("%s %s: URL %s shows a credential", result.Operation, result.Probe, result.URL)
+		}
+	}
+}
+
+func TestRunSecurityUnsafeMethods(t *testing.T) {
+	report, requests := runSecurity(t, true, true)
+	if got := outcomes(report)["deleteOrder other-user"]; got != SecurityFinding {
+		t.Errorf("deleteOrder other-user = %q, want a finding", got)
+	}
+	// the probe was not turned away, so the first user has nothing to confirm
+	for _, request := range requests {
+		if request == "DELETE alice-key" {
+			t.Errorf("the first user deleted its resource: %v", requests)
+		}
+	}
+
+	report, requests = runSecurity(t, true, false)
+	if got := outcomes(report)["deleteOrder other-user"]; got != SecurityPassed {
+		t.Errorf("deleteOrder other-user = %q, want passed", got)
+	}
+	// the first user deletes its resource only after the probe was turned away
+	probe, owner := -1, -1
+	for i, request := range requests {
+		switch request {
+		case "DELETE bob-key":
+			probe = i
+		case "DELETE alice-key":
+			owner = i
+		}
+	}
+	if probe < 0 || owner < probe {
+		t.Errorf("requests = %v, want the DELETE of the first user after the probe", requests)
+	}
+}
+
+func TestApplyCredentialKeepsQuery(t *testing.T) {
+	scheme := &openapi3.SecurityScheme{Type: "apiKey", In: "query", Name: "api_key"}
+	tests := []struct {
+		query, want string
+	}{
+		{"filter[status]=sold&tags=a|b&api_key=old", "filter[status]=sold&tags=a|b&api_key=new%2Fkey"},
+		{"tags=a%20b&api_key=old&api_key=older&limit=5", "tags=a%20b&limit=5&api_key=new%2Fkey"},
+		{"", "api_key=new%2Fkey"},
+	}
+	runner := &Runner{}
+	for _, tt := range tests {
+		u, _ := url.Parse("http://api.valida.test/pets?" + tt.query)
+		req := &http.Request{URL: u, Header: http.Header{}}
+		runner.applyCredential(req, scheme, "new/key")
+		if req.URL.RawQuery != tt.want {
+			t.Errorf("applyCredential(%q) = %q, want %q", tt.query, req.URL.RawQuery, tt.want)
+		}
+	}
+
+	u, _ := url.Parse("http://api.valida.test/pets?deep[a]=1&api_key=old&x=a+b")
+	removeQueryParam(u, "api_key")
+	if want := "deep[a]=1&x=a+b"; u.RawQuery != want {
+		t.Errorf("removeQueryParam() = %q, want %q", u.RawQuery, want)
+	}
+}
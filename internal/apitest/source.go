@@ -0,0 +1,256 @@
+package apitest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/invopop/yaml"
+)
+
+// fetchTimeout bounds fetching a spec when SpecOptions sets no timeout
+const fetchTimeout = 30 * time.Second
+
+// SpecOptions represents how specs and the documents of their external $refs
+// are fetched over HTTP. The zero value fetches them with the default TLS and
+// proxy settings, a 30 second timeout and no cache.
+type SpecOptions struct {
+	// CacheDir keeps fetched specs and revalidates them with their ETag, empty for no cache
+	CacheDir string
+	// Config holds the TLS settings of a config file
+	Config  *Config
+	Timeout time.Duration
+	TLS     TLSOptions
+	Network NetworkOptions
+	// Transport fetches the specs instead of a transport built from the TLS
+	// and network options
+	Transport http.RoundTripper
+}
+
+// DefaultSpecCacheDir returns the directory caching specs in the user cache directory
+func DefaultSpecCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("finding cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "valida", "specs"), nil
+}
+
+// specFetcher fetches specs over HTTP, through the spec cache when it has one
+type specFetcher struct {
+	client   *http.Client
+	cacheDir string
+}
+
+func newSpecFetcher(options SpecOptions) (*specFetcher, error) {
+	cfg := options.Config
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	transport := options.Transport
+	if transport == nil {
+		network, err := parseNetwork(options.Network)
+		if err != nil {
+			return nil, err
+		}
+		transport, err = newClientTransport(mergeTLS(options.TLS, cfg), network)
+		if err != nil {
+			return nil, err
+		}
+	}
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = fetchTimeout
+	}
+
+	if options.CacheDir != "" {
+		if err := os.MkdirAll(options.CacheDir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating cache directory: %w", err)
+		}
+	}
+	return &specFetcher{client: &http.Client{Transport: transport, Timeout: timeout}, cacheDir: options.CacheDir}, nil
+}
+
+// readSpecSource reads a spec from a file path, an http(s) URL or stdin ("-")
+// and returns its content with the location used to resolve relative $refs
+func (f *specFetcher) readSpecSource(source string) ([]byte, *url.URL, error) {
+	if source == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading stdin: %w", err)
+		}
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, nil, err
+		}
+		return data, &url.URL{Path: filepath.ToSlash(filepath.Join(cwd, "stdin"))}, nil
+	}
+
+	if isHTTPURL(source) {
+		location, err := url.Parse(source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing spec URL: %w", err)
+		}
+		data, err := f.fetch(location)
+		return data, location, err
+	}
+
+	absPath, err := filepath.Abs(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, &url.URL{Path: filepath.ToSlash(absPath)}, nil
+}
+
+func isHTTPURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// readFromURI reads the documents referenced by external $refs, fetching
+// remote ones through the spec cache
+func (f *specFetcher) readFromURI(loader *openapi3.Loader, location *url.URL) ([]byte, error) {
+	if location.Scheme == "http" || location.Scheme == "https" {
+		withoutFragment := *location
+		withoutFragment.Fragment = ""
+		return f.fetch(&withoutFragment)
+	}
+	return openapi3.ReadFromFile(loader, location)
+}
+
+// fetch downloads a spec, revalidating a cached copy with If-None-Match
+// when the cache is enabled. The cached copy is used when the server cannot be reached.
+func (f *specFetcher) fetch(location *url.URL) ([]byte, error) {
+	var bodyPath, etagPath string
+	var cached []byte
+	if f.cacheDir != "" {
+		sum := sha256.Sum256([]byte(location.String()))
+		key := hex.EncodeToString(sum[:])
+		bodyPath = filepath.Join(f.cacheDir, key+".spec")
+		etagPath = filepath.Join(f.cacheDir, key+".etag")
+		cached, _ = os.ReadFile(bodyPath)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, location.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, application/yaml, */*")
+	if cached != nil {
+		if etag, err := os.ReadFile(etagPath); err == nil && len(etag) > 0 {
+			req.Header.Set("If-None-Match", string(etag))
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if cached != nil {
+			fmt.Printf("Warning: fetching %s failed, using cached copy: %v\n", location, err)
+			return cached, nil
+		}
+		return nil, fmt.Errorf("fetching spec %s: %w", location, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("fetching spec %s: %s", location, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading spec %s: %w", location, err)
+	}
+
+	if f.cacheDir != "" {
+		if err := os.WriteFile(bodyPath, data, 0o644); err != nil {
+			return nil, fmt.Errorf("caching spec: %w", err)
+		}
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			err = os.WriteFile(etagPath, []byte(etag), 0o644)
+		} else {
+			err = os.Remove(etagPath)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("caching spec: %w", err)
+		}
+	}
+
+	return data, nil
+}
+
+// resolveExternalRefs replaces $refs to other documents with their content,
+// resolving them against the location of the document that contains them
+func (f *specFetcher) resolveExternalRefs(node interface{}, location *url.URL, seen []string) (interface{}, error) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok && !strings.HasPrefix(ref, "#") {
+			refURL, err := url.Parse(ref)
+			if err != nil {
+				return nil, fmt.Errorf("invalid $ref %q: %w", ref, err)
+			}
+			target := location.ResolveReference(refURL)
+			for _, s := range seen {
+				if s == target.String() {
+					return v, nil
+				}
+			}
+
+			fragment := target.Fragment
+			target.Fragment = ""
+			data, err := f.readFromURI(nil, target)
+			if err != nil {
+				return nil, fmt.Errorf("resolving $ref %q: %w", ref, err)
+			}
+			var root map[string]interface{}
+			if err := yaml.Unmarshal(data, &root); err != nil {
+				return nil, fmt.Errorf("decoding $ref %q: %w", ref, err)
+			}
+
+			var resolved interface{} = root
+			if fragment != "" {
+				resolved = resolveSchema(root, map[string]interface{}{"$ref": "#" + fragment})
+			}
+			resolved = inlineRefs(root, resolved, nil)
+			return f.resolveExternalRefs(resolved, target, append(seen, location.ResolveReference(refURL).String()))
+		}
+
+		resolved := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			child, err := f.resolveExternalRefs(item, location, seen)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = child
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			child, err := f.resolveExternalRefs(item, location, seen)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = child
+		}
+		return resolved, nil
+	default:
+		return node, nil
+	}
+}
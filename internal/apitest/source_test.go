@@ -0,0 +1,144 @@
+package apitest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const remoteSpec = `openapi: 3.0.3
+info:
+  title: Pets
+  version: "1.0"
+servers:
+  - url: /api
+paths:
+  /pets/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        "200":
+          description: A pet
+          content:
+            application/json:
+              schema:
+                $ref: "schemas/pet.yaml#/Pet"
+`
+
+const remotePetSchema = `Pet:
+  type: object
+  required: [name]
+  properties:
+    name:
+      type: string
+`
+
+// specServer serves the spec without a file extension, so its format is
+// sniffed, with an ETag, and counts the requests answered from the cache
+func specServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var notModified atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openapi", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(remoteSpec))
+	})
+	mux.HandleFunc("/schemas/pet.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(remotePetSchema))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &notModified
+}
+
+func TestLoadAPISpecFromURL(t *testing.T) {
+	server, _ := specServer(t)
+
+	apiSpec, err := LoadAPISpec(server.URL+"/openapi", SpecOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := server.URL + "/api"; apiSpec.BaseURL != want {
+		t.Errorf("BaseURL = %q, want %q", apiSpec.BaseURL, want)
+	}
+
+	response := apiSpec.Spec.Paths.Value("/pets/{id}").Get.Responses.Status(200)
+	schema := response.Value.Content.Get("application/json").Schema
+	if schema == nil || schema.Value == nil || len(schema.Value.Required) != 1 || schema.Value.Required[0] != "name" {
+		t.Errorf("the relative external $ref was not resolved against the spec URL: %+v", schema)
+	}
+}
+
+func TestLoadAPISpecCache(t *testing.T) {
+	server, notModified := specServer(t)
+	options := SpecOptions{CacheDir: t.TempDir()}
+
+	for i := 0; i < 2; i++ {
+		if _, err := LoadAPISpec(server.URL+"/openapi", options); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := notModified.Load(); got != 1 {
+		t.Errorf("the cached spec was revalidated %d times, want 1", got)
+	}
+
+	// the cached copies are used when the server cannot be reached
+	server.Close()
+	if _, err := LoadAPISpec(server.URL+"/openapi", options); err != nil {
+		t.Errorf("LoadAPISpec() with the server down: %v", err)
+	}
+}
+
+func TestLoadAPISpecTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, err := LoadAPISpec(server.URL+"/openapi.json", SpecOptions{Timeout: 50 * time.Millisecond})
+	if err == nil {
+		t.Fatal("LoadAPISpec() succeeded against a server that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("LoadAPISpec() returned after %s, want the 50ms timeout", elapsed)
+	}
+}
+
+func TestGetBaseURL(t *testing.T) {
+	tests := []struct {
+		server, location, want string
+	}{
+		{"/api", "https://example.com/docs/openapi.json", "https://example.com/api"},
+		{"v2", "https://example.com/docs/openapi.json", "https://example.com/docs/v2"},
+		{"https://api.example.com/v1", "https://example.com/openapi.json", "https://api.example.com/v1"},
+		{"/api", "/home/me/openapi.yaml", "/api"},
+	}
+	for _, tt := range tests {
+		spec := &openapi3.T{Servers: openapi3.Servers{{URL: tt.server}}}
+		location, err := url.Parse(tt.location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := getBaseURL(spec, location); err != nil || got != tt.want {
+			t.Errorf("getBaseURL(%q, %q) = %q, %v, want %q", tt.server, tt.location, got, err, tt.want)
+		}
+	}
+}
@@ -1,23 +1,84 @@
 package apitest
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/invopop/yaml"
 )
 
-func loadAndValidateSpec(filePath string) (*openapi3.T, error) {
+func loadAndValidateSpec(fetcher *specFetcher, data []byte, location *url.URL) (*openapi3.T, map[string]interface{}, []string, error) {
 	loader := openapi3.NewLoader()
-	spec, err := loader.LoadFromFile(filePath)
+	loader.IsExternalRefsAllowed = true
+	loader.ReadFromURIFunc = fetcher.readFromURI
+
+	var spec *openapi3.T
+	var document map[string]interface{}
+	var warnings []string
+	var err error
+	if isSwagger2(data) {
+		spec, warnings, err = convertSwagger2(data, loader, location)
+	} else {
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, nil, nil, fmt.Errorf("loading OpenAPI spec: %w", err)
+		}
+		if isOpenAPI31(document) {
+			var downgraded map[string]interface{}
+			downgraded, warnings = downgradeOpenAPI31(document)
+			spec, err = loadDowngradedSpec(loader, downgraded, location)
+			if err == nil {
+				var resolved interface{}
+				resolved, err = fetcher.resolveExternalRefs(document, location, nil)
+				document, _ = resolved.(map[string]interface{})
+			}
+		} else {
+			document = nil
+			spec, err = loader.LoadFromDataWithPath(data, location)
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("loading OpenAPI spec: %w", err)
+		return nil, nil, warnings, fmt.Errorf("loading OpenAPI spec: %w", err)
 	}
 
 	if err := spec.Validate(loader.Context); err != nil {
-		return nil, fmt.Errorf("validating OpenAPI spec: %w", err)
+		return nil, nil, warnings, fmt.Errorf("validating OpenAPI spec: %w", err)
 	}
 
-	return spec, nil
+	if document == nil {
+		spec.InternalizeRefs(loader.Context, nil)
+		document, err = specDocument(spec)
+		if err != nil {
+			return nil, nil, warnings, fmt.Errorf("decoding OpenAPI spec: %w", err)
+		}
+	}
+
+	return spec, document, warnings, nil
+}
+
+// loadDowngradedSpec loads the OpenAPI 3.0 copy of a 3.1 document
+func loadDowngradedSpec(loader *openapi3.Loader, downgraded map[string]interface{}, location *url.URL) (*openapi3.T, error) {
+	data, err := json.Marshal(downgraded)
+	if err != nil {
+		return nil, err
+	}
+	return loader.LoadFromDataWithPath(data, location)
+}
+
+// specDocument returns the specification as a generic document, used to resolve $ref pointers
+func specDocument(spec *openapi3.T) (map[string]interface{}, error) {
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	document := make(map[string]interface{})
+	if err := json.Unmarshal(b, &document); err != nil {
+		return nil, err
+	}
+	return document, nil
 }
 
 func printSpecInfo(spec *openapi3.T) {
@@ -25,9 +86,25 @@ func printSpecInfo(spec *openapi3.T) {
 	fmt.Printf("Version: %s\n", spec.Info.Version)
 }
 
-func getBaseURL(spec *openapi3.T) (string, error) {
+func printWarnings(warnings []string) {
+	for _, warning := range warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+}
+
+// getBaseURL returns the URL of the first server, resolving a relative one
+// against the URL the spec was fetched from
+func getBaseURL(spec *openapi3.T, location *url.URL) (string, error) {
 	if len(spec.Servers) == 0 {
 		return "", fmt.Errorf("no servers found in the specification")
 	}
-	return spec.Servers[0].URL, nil
+	baseURL := spec.Servers[0].URL
+	if location.Scheme != "http" && location.Scheme != "https" {
+		return baseURL, nil
+	}
+	server, err := url.Parse(baseURL)
+	if err != nil || server.IsAbs() {
+		return baseURL, nil
+	}
+	return strings.TrimSuffix(location.ResolveReference(server).String(), "/"), nil
 }
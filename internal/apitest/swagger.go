@@ -0,0 +1,160 @@
+package apitest
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/invopop/yaml"
+)
+
+// isSwagger2 reports whether a JSON or YAML document declares swagger: "2.0"
+func isSwagger2(data []byte) bool {
+	var header struct {
+		Swagger string `json:"swagger"`
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return false
+	}
+	return strings.HasPrefix(header.Swagger, "2.")
+}
+
+// convertSwagger2 converts a Swagger 2.0 document to OpenAPI 3 and returns the
+// converted specification together with warnings about what did not convert cleanly
+func convertSwagger2(data []byte, loader *openapi3.Loader, location *url.URL) (*openapi3.T, []string, error) {
+	var doc2 openapi2.T
+	if err := yaml.Unmarshal(data, &doc2); err != nil {
+		return nil, nil, fmt.Errorf("decoding Swagger 2.0 spec: %w", err)
+	}
+
+	warnings := swagger2Warnings(&doc2)
+
+	spec, err := openapi2conv.ToV3WithLoader(&doc2, loader, location)
+	if err != nil {
+		return nil, warnings, fmt.Errorf("converting Swagger 2.0 spec: %w", err)
+	}
+
+	warnings = append(warnings, applyCollectionFormats(&doc2, spec)...)
+	return spec, warnings, nil
+}
+
+// swagger2Warnings lists the parts of a Swagger 2.0 document that need
+// attention after conversion
+func swagger2Warnings(doc2 *openapi2.T) []string {
+	var warnings []string
+
+	if doc2.Host == "" {
+		warnings = append(warnings, "no host declared, the converted spec has no server to test against")
+	} else if len(doc2.Schemes) == 0 {
+		warnings = append(warnings, fmt.Sprintf("no schemes declared, assuming https://%s", doc2.Host))
+	} else if len(doc2.Schemes) > 1 {
+		warnings = append(warnings, fmt.Sprintf("multiple schemes declared, testing against %s", doc2.Schemes[0]))
+	}
+
+	var paths []string
+	for path := range doc2.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		for method, operation := range doc2.Paths[path].Operations() {
+			name := fmt.Sprintf("%s %s", method, path)
+
+			var hasBody, hasForm bool
+			for _, param := range operation.Parameters {
+				switch param.In {
+				case "body":
+					hasBody = true
+				case "formData":
+					hasForm = true
+					if param.Type.Is("file") {
+						warnings = append(warnings, fmt.Sprintf("%s: file parameter %s converted to a binary string", name, param.Name))
+					}
+				}
+			}
+			if hasBody && hasForm {
+				warnings = append(warnings, fmt.Sprintf("%s: mixes body and formData parameters, only one request body is kept", name))
+			}
+		}
+	}
+
+	for name, scheme := range doc2.SecurityDefinitions {
+		if scheme.Type == "oauth2" && scheme.Flow == "" {
+			warnings = append(warnings, fmt.Sprintf("security definition %s has no oauth2 flow", name))
+		}
+	}
+
+	return warnings
+}
+
+// applyCollectionFormats maps Swagger 2.0 collectionFormat values onto the
+// OpenAPI 3 style and explode settings, which the converter leaves out
+func applyCollectionFormats(doc2 *openapi2.T, spec *openapi3.T) []string {
+	var warnings []string
+
+	for path, pathItem2 := range doc2.Paths {
+		pathItem3 := spec.Paths.Value(path)
+		if pathItem3 == nil {
+			continue
+		}
+		for method, operation2 := range pathItem2.Operations() {
+			operation3 := pathItem3.GetOperation(method)
+			if operation3 == nil {
+				continue
+			}
+
+			params := append(append(openapi2.Parameters{}, pathItem2.Parameters...), operation2.Parameters...)
+			for _, param2 := range params {
+				if param2.Ref != "" {
+					param2 = doc2.Parameters[strings.TrimPrefix(param2.Ref, "#/parameters/")]
+				}
+				if param2 == nil || param2.In == "body" || param2.In == "formData" {
+					continue
+				}
+
+				// Swagger 2.0 arrays default to csv, which is not the OpenAPI 3 default for query parameters
+				collectionFormat := param2.CollectionFormat
+				if collectionFormat == "" {
+					if !param2.Type.Is("array") {
+						continue
+					}
+					collectionFormat = "csv"
+				}
+
+				param3 := operation3.Parameters.GetByInAndName(param2.In, param2.Name)
+				if param3 == nil {
+					param3 = pathItem3.Parameters.GetByInAndName(param2.In, param2.Name)
+				}
+				if param3 == nil {
+					continue
+				}
+
+				explode := false
+				switch collectionFormat {
+				case "csv":
+					if param2.In == "query" {
+						param3.Style = openapi3.SerializationForm
+					}
+				case "ssv":
+					param3.Style = openapi3.SerializationSpaceDelimited
+				case "pipes":
+					param3.Style = openapi3.SerializationPipeDelimited
+				case "multi":
+					param3.Style = openapi3.SerializationForm
+					explode = true
+				default:
+					warnings = append(warnings, fmt.Sprintf("%s %s: collectionFormat %s of %s has no OpenAPI 3 equivalent", strings.ToUpper(method), path, collectionFormat, param2.Name))
+					continue
+				}
+				param3.Explode = &explode
+			}
+		}
+	}
+
+	return warnings
+}
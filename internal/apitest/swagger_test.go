@@ -0,0 +1,93 @@
+package apitest
+
+import (
+	"strings"
+	"testing"
+)
+
+const swaggerSpec = `swagger: "2.0"
+info:
+  title: Pets
+  version: "1.0"
+host: localhost
+basePath: /v1
+schemes: [http, https]
+consumes:
+  - application/x-www-form-urlencoded
+securityDefinitions:
+  api_key:
+    type: apiKey
+    in: header
+    name: X-API-Key
+  basic:
+    type: basic
+security:
+  - api_key: []
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      parameters:
+        - name: tags
+          in: query
+          type: array
+          items:
+            type: string
+      responses:
+        "200":
+          description: Pets
+    post:
+      operationId: createPet
+      security:
+        - basic: []
+      parameters:
+        - name: name
+          in: formData
+          type: string
+          required: true
+        - name: photo
+          in: formData
+          type: file
+      responses:
+        "201":
+          description: Created
+`
+
+func TestLoadSwagger2Spec(t *testing.T) {
+	apiSpec := loadTestSpec(t, swaggerSpec)
+
+	if apiSpec.BaseURL != "http://localhost/v1" {
+		t.Errorf("BaseURL = %q, want the host, first scheme and basePath", apiSpec.BaseURL)
+	}
+	for _, want := range []string{"multiple schemes declared, testing against http", "POST /pets: file parameter photo converted to a binary string"} {
+		if !strings.Contains(strings.Join(apiSpec.Warnings, "\n"), want) {
+			t.Errorf("warnings = %v, want %q", apiSpec.Warnings, want)
+		}
+	}
+
+	createPet := apiSpec.Paths["/pets"].Operations["post"]
+	mediaType, schema := requestBodySchema(createPet.RequestBody)
+	if mediaType != "application/x-www-form-urlencoded" {
+		t.Errorf("request body media type = %q, want the consumed form type", mediaType)
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	if properties["name"] == nil || properties["photo"] == nil {
+		t.Errorf("request body schema = %v, want the formData parameters", schema)
+	}
+	if required, _ := schema["required"].([]interface{}); len(required) != 1 || required[0] != "name" {
+		t.Errorf("required = %v, want name", schema["required"])
+	}
+
+	schemes := apiSpec.Spec.Components.SecuritySchemes
+	if apiKey := schemes["api_key"]; apiKey == nil || apiKey.Value.Type != "apiKey" || apiKey.Value.In != "header" || apiKey.Value.Name != "X-API-Key" {
+		t.Errorf("api_key scheme = %+v, want the header API key", apiKey)
+	}
+	if basic := schemes["basic"]; basic == nil || basic.Value.Type != "http" || basic.Value.Scheme != "basic" {
+		t.Errorf("basic scheme = %+v, want HTTP basic", basic)
+	}
+
+	tags := apiSpec.Spec.Paths.Value("/pets").Get.Parameters.GetByInAndName("query", "tags")
+	if tags == nil || tags.Style != "form" || tags.Explode == nil || *tags.Explode {
+		t.Errorf("tags parameter = %+v, want the csv collection format as an unexploded form", tags)
+	}
+}
@@ -8,30 +8,55 @@ import (
 
 // APISpec represents the parsed API specification
 type APISpec struct {
-	Spec    *openapi3.T
-	BaseURL string
-	Paths   map[string]*PathItem
+	Spec     *openapi3.T
+	Document map[string]interface{}
+	Warnings []string
+	BaseURL  string
+	Paths    map[string]*PathItem
 }
 
-// TestAPISpec is the main function to test the API specification
-func TestAPISpec(filePath string) (*APISpec, error) {
-	spec, err := loadAndValidateSpec(filePath)
+// TestAPISpec is the main function to test the API specification. The source
+// is a file path, an http(s) URL or "-" for stdin.
+func TestAPISpec(source string, options SpecOptions) (*APISpec, error) {
+	return loadAPISpec(source, options, true)
+}
+
+// LoadAPISpec loads the API specification like TestAPISpec, without printing
+// its warnings and info
+func LoadAPISpec(source string, options SpecOptions) (*APISpec, error) {
+	return loadAPISpec(source, options, false)
+}
+
+func loadAPISpec(source string, options SpecOptions, verbose bool) (*APISpec, error) {
+	fetcher, err := newSpecFetcher(options)
 	if err != nil {
-		return nil, fmt.Errorf("error validating OpenAPI spec: %w", err)
+		return nil, err
+	}
+	data, location, err := fetcher.readSpecSource(source)
+	if err != nil {
+		return nil, fmt.Errorf("error validating OpenAPI spec: loading OpenAPI spec: %w", err)
 	}
 
-	if err := loadConfig(filePath); err != nil {
-		return nil, fmt.Errorf("error reading OpenAPI spec: %w", err)
+	spec, document, warnings, err := loadAndValidateSpec(fetcher, data, location)
+	if verbose {
+		printWarnings(warnings)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error validating OpenAPI spec: %w", err)
 	}
 
 	apiSpec := &APISpec{
-		Spec:  spec,
-		Paths: make(map[string]*PathItem),
+		Spec:     spec,
+		Document: document,
+		Warnings: warnings,
+		Paths:    make(map[string]*PathItem),
 	}
 
-	printSpecInfo(apiSpec.Spec)
+	if verbose {
+		printSpecInfo(apiSpec.Spec)
+	}
 
-	baseURL, err := getBaseURL(apiSpec.Spec)
+	baseURL, err := getBaseURL(apiSpec.Spec, location)
 	if err != nil {
 		return nil, fmt.Errorf("baseURL not found: %w", err)
 	}
@@ -0,0 +1,45 @@
+// Command wasmhook is a WASI hook used by the tests: it signs requests with
+// the length of their body and fails responses without a name
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type message struct {
+	Stage    string                     `json:"stage"`
+	Request  map[string]json.RawMessage `json:"request,omitempty"`
+	Response *struct {
+		Body string `json:"body"`
+	} `json:"response,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func main() {
+	var in message
+	if err := json.NewDecoder(os.Stdin).Decode(&in); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	switch in.Stage {
+	case "beforeRequest":
+		var body string
+		json.Unmarshal(in.Request["body"], &body)
+		var headers map[string][]string
+		json.Unmarshal(in.Request["headers"], &headers)
+		if headers == nil {
+			headers = make(map[string][]string)
+		}
+		headers["X-Signature"] = []string{fmt.Sprintf("len=%d", len(body))}
+		in.Request["headers"], _ = json.Marshal(headers)
+		json.NewEncoder(os.Stdout).Encode(message{Request: in.Request})
+	case "assert":
+		if in.Response == nil || !strings.Contains(in.Response.Body, `"name"`) {
+			json.NewEncoder(os.Stdout).Encode(message{Error: "the response has no name"})
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package apitest
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestTiming represents how long each phase of a request took. Phases that
+// did not happen, such as DNS on a reused connection, are zero.
+type RequestTiming struct {
+	Start   time.Time
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	Send    time.Duration
+	TTFB    time.Duration
+	Total   time.Duration
+
+	// Attempts counts the attempts when the request was retried, the phases
+	// above are those of the last attempt
+	Attempts  int
+	RetryWait time.Duration
+
+	// Throttle is the time spent waiting for the rate limiter, which is not
+	// part of the latency
+	Throttle time.Duration
+
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+}
+
+// traceRequest attaches an httptrace.ClientTrace to the request that fills
+// the returned timing while the request is sent
+func traceRequest(req *http.Request) (*http.Request, *RequestTiming) {
+	timing := &RequestTiming{}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { timing.dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			timing.DNS = time.Since(timing.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			if timing.connectStart.IsZero() {
+				timing.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(string, string, error) {
+			timing.Connect = time.Since(timing.connectStart)
+		},
+		TLSHandshakeStart: func() { timing.tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			timing.TLS = time.Since(timing.tlsStart)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			timing.wroteRequest = time.Now()
+			timing.Send = timing.wroteRequest.Sub(timing.Start)
+		},
+		GotFirstResponseByte: func() {
+			timing.TTFB = time.Since(timing.Start)
+		},
+	}
+	timing.Start = time.Now()
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), timing
+}
+
+// finish records the total duration once the response body has been read
+func (t *RequestTiming) finish() {
+	t.Total = time.Since(t.Start)
+}
+
+// wait returns the time between sending the request and the first response byte
+func (t *RequestTiming) wait() time.Duration {
+	if t.wroteRequest.IsZero() || t.TTFB == 0 {
+		return t.TTFB
+	}
+	return t.Start.Add(t.TTFB).Sub(t.wroteRequest)
+}
+
+func (t *RequestTiming) String() string {
+	s := fmt.Sprintf("DNS %s, Connect %s, TLS %s, TTFB %s, Total %s",
+		formatDuration(t.DNS), formatDuration(t.Connect), formatDuration(t.TLS), formatDuration(t.TTFB), formatDuration(t.Total))
+	if t.Attempts > 1 {
+		s += fmt.Sprintf(" (attempt %d, %s waiting between retries)", t.Attempts, formatDuration(t.RetryWait))
+	}
+	if t.Throttle > 0 {
+		s += fmt.Sprintf(", throttled %s", formatDuration(t.Throttle))
+	}
+	return s
+}
+
+// parseLatency reads an SLA threshold given as a duration such as 500ms or 1s,
+// or as a plain number of milliseconds
+func parseLatency(v interface{}) (time.Duration, error) {
+	if ms, ok := numberValue(v); ok {
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+	s := strings.TrimSpace(fmt.Sprint(v))
+	if ms, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid latency %q: %w", s, err)
+	}
+	return d, nil
+}
+
+// latencySLA returns the SLA of an operation: the config override, then the
+// x-valida-max-latency extension, then the global config value
+func (c *Config) latencySLA(operation *Operation, opConfig *OperationConfig) time.Duration {
+	if opConfig != nil && opConfig.MaxLatency != "" {
+		if d, err := parseLatency(opConfig.MaxLatency); err == nil {
+			return d
+		}
+	}
+	if operation != nil && operation.MaxLatency > 0 {
+		return operation.MaxLatency
+	}
+	if c.MaxLatency != "" {
+		if d, err := parseLatency(c.MaxLatency); err == nil {
+			return d
+		}
+	}
+	return 0
+}
+
+// checkLatency turns a passing assertion into a failure when the request was slower than its SLA
+func checkLatency(assertion string, timing *RequestTiming, limit time.Duration) string {
+	if limit <= 0 || timing == nil || timing.Total <= limit || strings.HasPrefix(assertion, "FAIL") {
+		return assertion
+	}
+	return fmt.Sprintf("FAIL: latency %s exceeds SLA of %s", formatDuration(timing.Total), formatDuration(limit))
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "0ms"
+	case d < time.Millisecond:
+		return fmt.Sprintf("%dµs", d.Microseconds())
+	case d < time.Second:
+		return fmt.Sprintf("%.1fms", float64(d.Microseconds())/1000)
+	default:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// displayLatencySummary prints latency percentiles for every operation that
+// was requested more than once
+func displayLatencySummary(rows []TableRow) {
+	samples := make(map[string][]time.Duration)
+	for _, row := range rows {
+		if row.Timing == nil || row.Timing.Total == 0 {
+			continue
+		}
+		key := row.Operation
+		if key == "" {
+			key = row.Method + " " + row.Endpoint
+		}
+		samples[key] = append(samples[key], row.Timing.Total)
+	}
+
+	var keys []string
+	for key, durations := range samples {
+		if len(durations) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+
+	fmt.Println()
+	fmt.Println(totalStyle.Render("Latency"))
+	fmt.Printf("%-40s %6s %10s %10s %10s %10s %10s %10s\n", "Operation", "Count", "Min", "p50", "p90", "p95", "p99", "Max")
+	for _, key := range keys {
+		durations := samples[key]
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		fmt.Printf("%-40s %6d %10s %10s %10s %10s %10s %10s\n", truncate(key, 40), len(durations),
+			formatDuration(durations[0]),
+			formatDuration(percentile(durations, 50)),
+			formatDuration(percentile(durations, 90)),
+			formatDuration(percentile(durations, 95)),
+			formatDuration(percentile(durations, 99)),
+			formatDuration(durations[len(durations)-1]))
+	}
+}
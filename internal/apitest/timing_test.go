@@ -0,0 +1,137 @@
+package apitest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var durations []time.Duration
+	for i := 1; i <= 10; i++ {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 5 * time.Millisecond},
+		{90, 9 * time.Millisecond},
+		{95, 10 * time.Millisecond},
+		{99, 10 * time.Millisecond},
+		{100, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(durations, tt.p); got != tt.want {
+			t.Errorf("percentile(p%g) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of no durations = %s, want 0", got)
+	}
+}
+
+func TestLatencySLA(t *testing.T) {
+	tests := []struct {
+		name      string
+		global    string
+		extension time.Duration
+		opConfig  *OperationConfig
+		want      time.Duration
+	}{
+		{"none", "", 0, nil, 0},
+		{"global", "500ms", 0, nil, 500 * time.Millisecond},
+		{"milliseconds", "250", 0, nil, 250 * time.Millisecond},
+		{"extension over global", "500ms", 200 * time.Millisecond, nil, 200 * time.Millisecond},
+		{"config over extension", "500ms", 200 * time.Millisecond, &OperationConfig{MaxLatency: "1s"}, time.Second},
+		{"invalid config", "500ms", 0, &OperationConfig{MaxLatency: "soon"}, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		cfg := &Config{MaxLatency: tt.global}
+		if got := cfg.latencySLA(&Operation{MaxLatency: tt.extension}, tt.opConfig); got != tt.want {
+			t.Errorf("%s: latencySLA() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckLatency(t *testing.T) {
+	timing := &RequestTiming{Total: 30 * time.Millisecond}
+	tests := []struct {
+		assertion string
+		limit     time.Duration
+		want      string
+	}{
+		{"PASS", 0, "PASS"},
+		{"PASS", 50 * time.Millisecond, "PASS"},
+		{"PASS", 20 * time.Millisecond, "FAIL: latency 30.0ms exceeds SLA of 20.0ms"},
+		{"WARNING: No expected response to validate against", 20 * time.Millisecond, "FAIL: latency 30.0ms exceeds SLA of 20.0ms"},
+		{"FAIL: status", 20 * time.Millisecond, "FAIL: status"},
+	}
+	for _, tt := range tests {
+		if got := checkLatency(tt.assertion, timing, tt.limit); got != tt.want {
+			t.Errorf("checkLatency(%q, %s) = %q, want %q", tt.assertion, tt.limit, got, tt.want)
+		}
+	}
+}
+
+// slowService answers every request with 201 after a delay
+func slowService(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOperationSLAForDataRows(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"valida.yaml": `operations:
+  createOrder:
+    maxLatency: 1ms
+    data: orders.csv
+`,
+		"orders.csv": "case_name,customerId\nfirst,c-1\nsecond,c-2\n",
+	})
+
+	rows := runTestConfig(t, ordersSpec, slowService(t, 20*time.Millisecond), filepath.Join(dir, "valida.yaml"))
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	for _, row := range rows {
+		if !strings.HasPrefix(row.Assertion, "FAIL: latency") {
+			t.Errorf("%s: assertion = %q, want a latency failure", row.Endpoint, row.Assertion)
+		}
+	}
+}
+
+func TestOperationSLAForScenarioSteps(t *testing.T) {
+	server := slowService(t, 20*time.Millisecond)
+	apiSpec := loadTestSpec(t, strings.Replace(ordersSpec, "http://localhost", server.URL, 1))
+	cfg := &Config{Operations: map[string]*OperationConfig{"createOrder": {MaxLatency: "1ms"}}}
+	runner, err := NewRunner(RunnerOptions{Config: cfg, Log: LogOptions{File: "none"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	scenario := &Scenario{Steps: []*ScenarioStep{
+		{Name: "by operation", Operation: "createOrder", Request: ScenarioRequest{Method: "POST", URL: server.URL + "/orders", Body: `{"customerId": "c-1"}`}},
+		{Name: "by path", Request: ScenarioRequest{Method: "POST", URL: server.URL + "/orders", Body: `{"customerId": "c-1"}`}},
+	}}
+	if err := runner.Run(context.Background(), runner.PlanScenario(apiSpec, scenario)); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range runner.Results() {
+		if !strings.HasPrefix(row.Assertion, "FAIL: latency") {
+			t.Errorf("%s: assertion = %q, want a latency failure", row.Endpoint, row.Assertion)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package apitest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TLSOptions represents the TLS settings of the client. Servers overrides
+// them for the hosts it lists, keyed by host or host:port, and inherits the
+// settings it leaves empty.
+type TLSOptions struct {
+	CACerts    []string               `mapstructure:"ca"`
+	Cert       string                 `mapstructure:"cert"`
+	Key        string                 `mapstructure:"key"`
+	ServerName string                 `mapstructure:"serverName"`
+	MinVersion string                 `mapstructure:"minVersion"`
+	Insecure   bool                   `mapstructure:"insecure"`
+	Servers    map[string]*TLSOptions `mapstructure:"servers"`
+}
+
+// tlsTransport sends each request through the transport of its host, or the
+// default one for hosts without their own TLS settings
+type tlsTransport struct {
+	base  *http.Transport
+	hosts map[string]*http.Transport
+}
+
+func (t *tlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, ok := t.hosts[req.URL.Host]; ok {
+		return transport.RoundTrip(req)
+	}
+	if transport, ok := t.hosts[req.URL.Hostname()]; ok {
+		return transport.RoundTrip(req)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// withPool returns a copy of the transports keeping up to n idle connections per host
+func (t *tlsTransport) withPool(n int) *tlsTransport {
+	pooled := &tlsTransport{base: pooledTransport(t.base, n), hosts: make(map[string]*http.Transport)}
+	for host, transport := range t.hosts {
+		pooled.hosts[host] = pooledTransport(transport, n)
+	}
+	return pooled
+}
+
+func pooledTransport(transport *http.Transport, n int) *http.Transport {
+	pooled := transport.Clone()
+	pooled.MaxIdleConns = n
+	pooled.MaxIdleConnsPerHost = n
+	return pooled
+}
+
+// mergeTLS returns the TLS settings of a runner: the options, with the
+// settings they leave empty taken from the tls section of the config file
+func mergeTLS(options TLSOptions, cfg *Config) *TLSOptions {
+	merged := inheritTLS(&options, &cfg.TLS)
+	merged.Servers = cfg.TLS.Servers
+	if len(options.Servers) > 0 {
+		merged.Servers = options.Servers
+	}
+	return merged
+}
+
+// inheritTLS fills the settings left empty in options with those of parent
+func inheritTLS(options, parent *TLSOptions) *TLSOptions {
+	merged := *options
+	merged.Servers = nil
+	if len(merged.CACerts) == 0 {
+		merged.CACerts = parent.CACerts
+	}
+	if merged.Cert == "" && merged.Key == "" {
+		merged.Cert, merged.Key = parent.Cert, parent.Key
+	}
+	if merged.ServerName == "" {
+		merged.ServerName = parent.ServerName
+	}
+	if merged.MinVersion == "" {
+		merged.MinVersion = parent.MinVersion
+	}
+	merged.Insecure = merged.Insecure || parent.Insecure
+	return &merged
+}
+
+func isZeroTLS(options *TLSOptions) bool {
+	return len(options.CACerts) == 0 && options.Cert == "" && options.Key == "" && options.ServerName == "" && options.MinVersion == "" && !options.Insecure
+}
+
+func tlsClientConfig(options *TLSOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.Insecure,
+	}
+
+	if options.MinVersion != "" {
+		version, err := parseTLSVersion(options.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(options.CACerts) > 0 {
+		// private CAs are trusted in addition to the system ones
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, caFile := range options.CACerts {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading CA bundle: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no PEM certificates found in CA bundle %s", caFile)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if options.Cert != "" {
+		keyFile := options.Key
+		if keyFile == "" {
+			// the key may be in the same PEM file as the certificate
+			keyFile = options.Cert
+		}
+		cert, err := tls.LoadX509KeyPair(options.Cert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	} else if options.Key != "" {
+		return nil, fmt.Errorf("client key %s given without a certificate", options.Key)
+	}
+
+	return tlsConfig, nil
+}
+
+// parseTLSVersion reads a TLS version such as 1.2 or TLS1.3
+func parseTLSVersion(s string) (uint16, error) {
+	version := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "tls")
+	switch strings.TrimPrefix(version, "v") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", s)
+}
+
+// resolveTLSPaths makes the certificate files of the config file relative to its directory
+func resolveTLSPaths(options *TLSOptions, dir string) {
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	for i, caFile := range options.CACerts {
+		options.CACerts[i] = resolve(caFile)
+	}
+	options.Cert = resolve(options.Cert)
+	options.Key = resolve(options.Key)
+	for _, server := range options.Servers {
+		if server != nil {
+			resolveTLSPaths(server, dir)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package apitest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues the certificates of the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Valida Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	ca.write(t, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	return ca
+}
+
+// issue signs a certificate for the name, used by servers or clients
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	ca.write(t, name+".pem", certPEM)
+	ca.write(t, name+"-key.pem", keyPEM)
+	ca.write(t, name+"-bundle.pem", append(certPEM, keyPEM...))
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func (ca *testCA) write(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(ca.path(name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (ca *testCA) path(name string) string {
+	return filepath.Join(ca.dir, name)
+}
+
+// mtlsServer starts a server for api.valida.test that requires a client
+// certificate of the CA and answers with the SNI and the client name
+func mtlsServer(t *testing.T, ca *testCA) *httptest.Server {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := ""
+		if len(r.TLS.PeerCertificates) > 0 {
+			client = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		io.WriteString(w, r.TLS.ServerName+" "+client)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "api.valida.test", x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTLSOptions(t *testing.T) {
+	ca := newTestCA(t)
+	server := mtlsServer(t, ca)
+	ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	serverURL, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name    string
+		options TLSOptions
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "untrusted CA",
+			options: TLSOptions{ServerName: "api.valida.test", Cert: ca.path("client.pem"), Key: ca.path("client-key.pem")},
+			wantErr: "certificate",
+		},
+		{
+			name:    "CA bundle, client certificate and SNI",
+			options: TLSOptions{CACerts: []string{ca.path("ca.pem")}, ServerName: "api.valida.test", Cert: ca.path("client.pem"), Key: ca.path("client-key.pem")},
+			want:    "api.valida.test client",
+		},
+		{
+			name:    "certificate and key in one file",
+			options: TLSOptions{CACerts: []string{ca.path("ca.pem")}, ServerName: "api.valida.test", Cert: ca.path("client-bundle.pem")},
+			want:    "api.valida.test client",
+		},
+		{
+			name:    "server name not in the certificate",
+			options: TLSOptions{CACerts: []string{ca.path("ca.pem")}, Cert: ca.path("client.pem"), Key: ca.path("client-key.pem")},
+			wantErr: "certificate",
+		},
+		{
+			name:    "no client certificate",
+			options: TLSOptions{CACerts: []string{ca.path("ca.pem")}, ServerName: "api.valida.test"},
+			wantErr: "certificate",
+		},
+		{
+			name:    "insecure",
+			options: TLSOptions{Insecure: true, Cert: ca.path("client.pem"), Key: ca.path("client-key.pem")},
+			want:    " client",
+		},
+		{
+			name: "settings of the server",
+			options: TLSOptions{Servers: map[string]*TLSOptions{
+				serverURL.Host: {CACerts: []string{ca.path("ca.pem")}, ServerName: "api.valida.test", Cert: ca.path("client.pem"), Key: ca.path("client-key.pem")},
+			}},
+			want: "api.valida.test client",
+		},
+		{
+			name:    "minimum version",
+			options: TLSOptions{Insecure: true, MinVersion: "1.3", Cert: ca.path("client.pem"), Key: ca.path("client-key.pem")},
+			want:    " client",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(RunnerOptions{Log: LogOptions{File: "none"}, TLS: tt.options})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer runner.Close()
+
+			resp, err := runner.client.Get(server.URL)
+			if tt.wantErr != "" {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("the request succeeded, want an error mentioning %q", tt.wantErr)
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.want {
+				t.Errorf("server saw %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestTLSOptionsErrors(t *testing.T) {
+	ca := newTestCA(t)
+	ca.write(t, "empty.pem", []byte("not a certificate"))
+
+	tests := []struct {
+		name    string
+		options TLSOptions
+		wantErr string
+	}{
+		{"missing CA bundle", TLSOptions{CACerts: []string{ca.path("missing.pem")}}, "reading CA bundle"},
+		{"CA bundle without certificates", TLSOptions{CACerts: []string{ca.path("empty.pem")}}, "no PEM certificates"},
+		{"key without certificate", TLSOptions{Key: ca.path("ca.pem")}, "without a certificate"},
+		{"invalid version", TLSOptions{MinVersion: "1.4"}, "invalid TLS version"},
+	}
+	for _, tt := range tests {
+		_, err := NewRunner(RunnerOptions{Log: LogOptions{File: "none"}, TLS: tt.options})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: NewRunner() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
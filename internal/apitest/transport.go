@@ -0,0 +1,167 @@
+package apitest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NetworkOptions represents how the client reaches the servers: through an
+// HTTP or SOCKS5 proxy, over a Unix domain socket, or at addresses overriding DNS
+type NetworkOptions struct {
+	Proxy      string
+	UnixSocket string
+	Resolve    []string
+}
+
+// networkSettings represents the parsed network options of a runner
+type networkSettings struct {
+	proxy      *url.URL
+	unixSocket string
+	resolve    map[string]string
+}
+
+func parseNetwork(options NetworkOptions) (*networkSettings, error) {
+	network := &networkSettings{unixSocket: options.UnixSocket, resolve: make(map[string]string)}
+	if options.Proxy != "" {
+		proxy, err := parseProxy(options.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		network.proxy = proxy
+	}
+
+	if network.proxy != nil && len(options.Resolve) > 0 {
+		// requests to a proxy are dialled to the proxy, which resolves the host itself
+		return nil, fmt.Errorf("resolve entries cannot be combined with a proxy")
+	}
+	for _, entry := range options.Resolve {
+		hostPort, address, err := parseResolve(entry)
+		if err != nil {
+			return nil, err
+		}
+		network.resolve[hostPort] = address
+	}
+	return network, nil
+}
+
+// parseProxy reads a proxy URL, defaulting to an HTTP proxy when no scheme is given
+func parseProxy(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	proxy, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", s, err)
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https, socks5 or socks5h", proxy.Scheme)
+	}
+	if proxy.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", s)
+	}
+	return proxy, nil
+}
+
+// parseResolve reads a host:port:address override, where an IPv6 address may
+// be given in brackets
+func parseResolve(entry string) (string, string, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", fmt.Errorf("invalid resolve entry %q, expected host:port:address", entry)
+	}
+	address := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+	if net.ParseIP(address) == nil {
+		return "", "", fmt.Errorf("invalid resolve entry %q: %s is not an IP address", entry, address)
+	}
+	return net.JoinHostPort(parts[0], parts[1]), net.JoinHostPort(address, parts[1]), nil
+}
+
+// environmentProxy returns the proxy of a request from HTTP_PROXY, HTTPS_PROXY
+// and NO_PROXY, which net/http reads once per process
+var environmentProxy = http.ProxyFromEnvironment
+
+// canonicalHostPort returns the host:port of a URL, with the default port of its scheme
+func canonicalHostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// newClientTransport builds the transport of a client from the TLS and
+// network settings, returning nil for the default transport when there are none
+func newClientTransport(tlsSettings *TLSOptions, network *networkSettings) (http.RoundTripper, error) {
+	if isZeroTLS(tlsSettings) && len(tlsSettings.Servers) == 0 && network.proxy == nil && network.unixSocket == "" && len(network.resolve) == 0 {
+		return nil, nil
+	}
+
+	base, err := newTransport(tlsSettings, network)
+	if err != nil {
+		return nil, err
+	}
+	if len(tlsSettings.Servers) == 0 {
+		return base, nil
+	}
+
+	transport := &tlsTransport{base: base, hosts: make(map[string]*http.Transport)}
+	for host, server := range tlsSettings.Servers {
+		if server == nil {
+			continue
+		}
+		hostTransport, err := newTransport(inheritTLS(server, tlsSettings), network)
+		if err != nil {
+			return nil, fmt.Errorf("TLS settings of %s: %w", host, err)
+		}
+		transport.hosts[host] = hostTransport
+	}
+	return transport, nil
+}
+
+func newTransport(tlsOptions *TLSOptions, network *networkSettings) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig, err := tlsClientConfig(tlsOptions)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if network.proxy != nil {
+		transport.Proxy = http.ProxyURL(network.proxy)
+	} else if len(network.resolve) > 0 {
+		// the hosts given an address are dialled directly, bypassing an
+		// HTTP_PROXY of the environment that would resolve them itself
+		resolve := network.resolve
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if _, ok := resolve[canonicalHostPort(req.URL)]; ok {
+				return nil, nil
+			}
+			return environmentProxy(req)
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	unixSocket, resolve := network.unixSocket, network.resolve
+	transport.DialContext = func(ctx context.Context, proto, addr string) (net.Conn, error) {
+		if unixSocket != "" {
+			// every connection goes to the socket, the URL host only fills the Host header
+			return dialer.DialContext(ctx, "unix", unixSocket)
+		}
+		if override, ok := resolve[addr]; ok {
+			addr = override
+		}
+		return dialer.DialContext(ctx, proto, addr)
+	}
+	return transport, nil
+}
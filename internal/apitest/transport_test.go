@@ -0,0 +1,76 @@
+package apitest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestResolveBypassesEnvironmentProxy(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "service "+r.Host)
+	}))
+	defer service.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "proxy "+r.Host)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	defer func(original func(*http.Request) (*url.URL, error)) { environmentProxy = original }(environmentProxy)
+	environmentProxy = http.ProxyURL(proxyURL)
+
+	serviceURL, _ := url.Parse(service.URL)
+	runner, err := NewRunner(RunnerOptions{
+		Log:     LogOptions{File: "none"},
+		Network: NetworkOptions{Resolve: []string{"api.valida.test:" + serviceURL.Port() + ":127.0.0.1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	transport := runner.client.Transport.(*http.Transport)
+	tests := []struct {
+		url, wantProxy string
+	}{
+		{"http://api.valida.test:" + serviceURL.Port() + "/pets", ""},
+		{"http://other.valida.test/pets", proxy.URL},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		proxyURL, err := transport.Proxy(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if proxyURL != nil {
+			got = proxyURL.String()
+		}
+		if got != tt.wantProxy {
+			t.Errorf("proxy of %s = %q, want %q", tt.url, got, tt.wantProxy)
+		}
+	}
+
+	resp, err := runner.client.Get("http://api.valida.test:" + serviceURL.Port() + "/pets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if want := "service api.valida.test:" + serviceURL.Port(); string(body) != want {
+		t.Errorf("response = %q, want %q", body, want)
+	}
+}
+
+func TestResolveWithProxy(t *testing.T) {
+	_, err := NewRunner(RunnerOptions{
+		Log:     LogOptions{File: "none"},
+		Network: NetworkOptions{Proxy: "proxy.corp:3128", Resolve: []string{"api.example.com:443:10.0.4.12"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "cannot be combined with a proxy") {
+		t.Errorf("NewRunner() error = %v, want the proxy and resolve entries rejected", err)
+	}
+}
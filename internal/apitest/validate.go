@@ -0,0 +1,572 @@
+package apitest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// findResponse returns the documented response for a status code, trying the
+// exact code, then the range (2XX) and finally the default response
+func findResponse(operation *Operation, statusCode int) (map[string]interface{}, bool) {
+	code := strconv.Itoa(statusCode)
+	for _, key := range []string{code, code[:1] + "XX", "default"} {
+		for status, response := range operation.Responses {
+			if strings.EqualFold(status, key) {
+				return response, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// validateResponse checks the response headers, content type and body against
+// the response documented for its status code. It reports false when there is
+// no operation or the status code is not documented and nothing was validated.
+func validateResponse(apiSpec *APISpec, operation *Operation, resp *http.Response, body []byte) (bool, error) {
+	if operation == nil {
+		return false, nil
+	}
+
+	response, ok := findResponse(operation, resp.StatusCode)
+	if !ok {
+		return false, nil
+	}
+	response = resolveSchema(apiSpec.Document, response)
+
+	var problems []string
+	problems = append(problems, validateResponseHeaders(apiSpec, response, resp.Header)...)
+
+	content, _ := response["content"].(map[string]interface{})
+	if len(content) > 0 && len(body) > 0 {
+		contentType := resp.Header.Get("Content-Type")
+		mediaTypeName, mediaType, ok := matchMediaType(content, contentType)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("content type %q is not one of %s", contentType, strings.Join(sortedKeys(content), ", ")))
+		} else {
+			problems = append(problems, validateBody(apiSpec, mediaTypeName, mediaType, body)...)
+		}
+	}
+
+	if len(problems) > 0 {
+		return true, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return true, nil
+}
+
+// validateRequest checks an incoming request against its operation: required
+// parameters, parameter schemas and the request body
+func validateRequest(apiSpec *APISpec, operation *Operation, req *http.Request, body []byte) error {
+	var problems []string
+
+	for _, param := range operation.Parameters {
+		param = resolveSchema(apiSpec.Document, param)
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+
+		var values []string
+		switch in {
+		case "query":
+			values = req.URL.Query()[name]
+		case "header":
+			values = req.Header.Values(name)
+		case "cookie":
+			if cookie, err := req.Cookie(name); err == nil {
+				values = []string{cookie.Value}
+			}
+		default:
+			continue
+		}
+
+		if len(values) == 0 {
+			if required, _ := param["required"].(bool); required {
+				problems = append(problems, fmt.Sprintf("missing required %s parameter %s", in, name))
+			}
+			continue
+		}
+
+		schema := parameterSchema(param)
+		if len(schema) == 0 {
+			continue
+		}
+		value := parseHeaderValue(resolveSchema(apiSpec.Document, schema), strings.Join(values, ","))
+		problems = append(problems, validateSchema(apiSpec.Document, schema, value, in+" "+name)...)
+	}
+
+	if operation.RequestBody != nil {
+		requestBody := resolveSchema(apiSpec.Document, operation.RequestBody)
+		content, _ := requestBody["content"].(map[string]interface{})
+		if len(body) == 0 {
+			if required, _ := requestBody["required"].(bool); required {
+				problems = append(problems, "missing required request body")
+			}
+		} else if len(content) > 0 {
+			contentType := req.Header.Get("Content-Type")
+			mediaTypeName, mediaType, ok := matchMediaType(content, contentType)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("request content type %q is not one of %s", contentType, strings.Join(sortedKeys(content), ", ")))
+			} else {
+				for _, problem := range validateBody(apiSpec, mediaTypeName, mediaType, body) {
+					problems = append(problems, "request "+problem)
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateResponseHeaders checks that required headers are present and that
+// every documented header matches its schema
+func validateResponseHeaders(apiSpec *APISpec, response map[string]interface{}, header http.Header) []string {
+	headers, _ := response["headers"].(map[string]interface{})
+
+	var problems []string
+	for _, name := range sortedKeys(headers) {
+		headerSpec, ok := headers[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		headerSpec = resolveSchema(apiSpec.Document, headerSpec)
+
+		values := header.Values(name)
+		if len(values) == 0 {
+			if required, _ := headerSpec["required"].(bool); required {
+				problems = append(problems, fmt.Sprintf("missing required header %s", http.CanonicalHeaderKey(name)))
+			}
+			continue
+		}
+
+		schema, ok := headerSpec["schema"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		value := parseHeaderValue(resolveSchema(apiSpec.Document, schema), strings.Join(values, ","))
+		problems = append(problems, validateSchema(apiSpec.Document, schema, value, "header "+http.CanonicalHeaderKey(name))...)
+	}
+	return problems
+}
+
+// parseHeaderValue converts a header value into the type declared by its schema
+func parseHeaderValue(schema map[string]interface{}, value string) interface{} {
+	value = strings.TrimSpace(value)
+	switch primaryType(schema) {
+	case "integer":
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return float64(i)
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		var values []interface{}
+		for _, item := range strings.Split(value, ",") {
+			values = append(values, parseHeaderValue(items, item))
+		}
+		return values
+	}
+	return value
+}
+
+// matchMediaType finds the documented media type matching the response
+// Content-Type, honouring wildcards such as application/* and */*
+func matchMediaType(content map[string]interface{}, contentType string) (string, map[string]interface{}, bool) {
+	actual, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", nil, false
+	}
+
+	var bestName string
+	var best map[string]interface{}
+	bestScore := -1
+	for name, mediaType := range content {
+		declared, _, err := mime.ParseMediaType(name)
+		if err != nil {
+			declared = strings.ToLower(name)
+		}
+
+		score := -1
+		switch {
+		case declared == actual:
+			score = 2
+		case strings.HasSuffix(declared, "/*") && strings.HasPrefix(actual, strings.TrimSuffix(declared, "*")):
+			score = 1
+		case declared == "*/*":
+			score = 0
+		}
+		if score > bestScore {
+			mediaTypeMap, _ := mediaType.(map[string]interface{})
+			bestName, best, bestScore = actual, mediaTypeMap, score
+		}
+	}
+	return bestName, best, bestScore >= 0
+}
+
+// validateBody checks a response body according to its media type, decoding
+// JSON bodies and validating them against the schema
+func validateBody(apiSpec *APISpec, mediaTypeName string, mediaType map[string]interface{}, body []byte) []string {
+	schema, _ := mediaType["schema"].(map[string]interface{})
+
+	switch {
+	case isJSONMediaType(mediaTypeName):
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return []string{fmt.Sprintf("body is not valid JSON: %v", err)}
+		}
+		if schema == nil {
+			return nil
+		}
+		return validateSchema(apiSpec.Document, schema, value, "body")
+	case mediaTypeName == "application/xml" || mediaTypeName == "text/xml" || strings.HasSuffix(mediaTypeName, "+xml"):
+		decoder := xml.NewDecoder(strings.NewReader(string(body)))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return []string{fmt.Sprintf("body is not valid XML: %v", err)}
+			}
+		}
+	case mediaTypeName == "application/x-www-form-urlencoded":
+		if _, err := url.ParseQuery(string(body)); err != nil {
+			return []string{fmt.Sprintf("body is not valid form data: %v", err)}
+		}
+	case strings.HasPrefix(mediaTypeName, "text/"):
+		if schema != nil {
+			return validateSchema(apiSpec.Document, schema, string(body), "body")
+		}
+	}
+	return nil
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// resolveSchema follows $ref pointers into the specification document
+func resolveSchema(document map[string]interface{}, schema map[string]interface{}) map[string]interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := schema["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return schema
+		}
+
+		var current interface{} = document
+		for _, token := range strings.Split(ref[2:], "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			m, ok := current.(map[string]interface{})
+			if !ok {
+				return schema
+			}
+			if current, ok = m[token]; !ok {
+				return schema
+			}
+		}
+
+		resolved, ok := current.(map[string]interface{})
+		if !ok {
+			return schema
+		}
+		schema = resolved
+	}
+	return schema
+}
+
+// validateSchema validates a decoded value against a schema and returns the
+// problems found, each prefixed with the location of the offending value
+func validateSchema(document map[string]interface{}, schema map[string]interface{}, value interface{}, path string) []string {
+	schema = resolveSchema(document, schema)
+	var problems []string
+
+	if constValue, ok := schema["const"]; ok && !reflect.DeepEqual(constValue, value) {
+		return []string{fmt.Sprintf("%s must be %v", path, constValue)}
+	}
+
+	types := schemaTypes(schema)
+	if value == nil {
+		if len(types) == 0 || containsValue(types, "null") {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s must not be null", path)}
+	}
+
+	if len(types) > 0 {
+		matched := false
+		for _, schemaType := range types {
+			if matchesType(fmt.Sprint(schemaType), value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return []string{fmt.Sprintf("%s must be of type %s", path, joinValues(types, " or "))}
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsValue(enum, value) {
+		problems = append(problems, fmt.Sprintf("%s must be one of %v", path, enum))
+	}
+
+	switch v := value.(type) {
+	case string:
+		problems = append(problems, validateString(schema, v, path)...)
+	case float64:
+		problems = append(problems, validateNumber(schema, v, path)...)
+	case []interface{}:
+		if min, ok := numberValue(schema["minItems"]); ok && float64(len(v)) < min {
+			problems = append(problems, fmt.Sprintf("%s must have at least %v items", path, min))
+		}
+		if max, ok := numberValue(schema["maxItems"]); ok && float64(len(v)) > max {
+			problems = append(problems, fmt.Sprintf("%s must have at most %v items", path, max))
+		}
+		problems = append(problems, validateItems(document, schema, v, path)...)
+	case map[string]interface{}:
+		problems = append(problems, validateObject(document, schema, v, path)...)
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			if subSchema, ok := sub.(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(document, subSchema, value, path)...)
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && countMatches(document, anyOf, value, path) == 0 {
+		problems = append(problems, fmt.Sprintf("%s must match at least one schema in anyOf", path))
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok && countMatches(document, oneOf, value, path) != 1 {
+		problems = append(problems, fmt.Sprintf("%s must match exactly one schema in oneOf", path))
+	}
+
+	return problems
+}
+
+// validateItems validates array items, applying prefixItems positionally and
+// items to the remaining entries, where items: false forbids any more entries
+func validateItems(document map[string]interface{}, schema map[string]interface{}, value []interface{}, path string) []string {
+	var problems []string
+
+	prefixItems, _ := schema["prefixItems"].([]interface{})
+	for i, item := range value {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(prefixItems) {
+			if prefixSchema, ok := prefixItems[i].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(document, prefixSchema, item, itemPath)...)
+			}
+			continue
+		}
+
+		switch items := schema["items"].(type) {
+		case map[string]interface{}:
+			problems = append(problems, validateSchema(document, items, item, itemPath)...)
+		case bool:
+			if !items {
+				problems = append(problems, fmt.Sprintf("%s is not allowed", itemPath))
+			}
+		}
+	}
+	return problems
+}
+
+func validateString(schema map[string]interface{}, value, path string) []string {
+	var problems []string
+	if min, ok := numberValue(schema["minLength"]); ok && float64(len([]rune(value))) < min {
+		problems = append(problems, fmt.Sprintf("%s must be at least %v characters", path, min))
+	}
+	if max, ok := numberValue(schema["maxLength"]); ok && float64(len([]rune(value))) > max {
+		problems = append(problems, fmt.Sprintf("%s must be at most %v characters", path, max))
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+			problems = append(problems, fmt.Sprintf("%s must match pattern %s", path, pattern))
+		}
+	}
+
+	valid := true
+	switch schema["format"] {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		valid = err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		valid = err == nil
+	case "email":
+		_, err := mail.ParseAddress(value)
+		valid = err == nil
+	case "uuid":
+		valid = uuidPattern.MatchString(value)
+	case "uri", "url":
+		u, err := url.Parse(value)
+		valid = err == nil && u.Scheme != ""
+	case "uri-reference":
+		_, err := url.Parse(value)
+		valid = err == nil
+	}
+	if !valid {
+		problems = append(problems, fmt.Sprintf("%s must be a valid %s", path, schema["format"]))
+	}
+	return problems
+}
+
+func validateNumber(schema map[string]interface{}, value float64, path string) []string {
+	var problems []string
+
+	// OpenAPI 3.0 uses boolean exclusive bounds next to minimum and maximum,
+	// JSON Schema 2020-12 uses numeric exclusiveMinimum and exclusiveMaximum
+	if min, ok := numberValue(schema["minimum"]); ok {
+		if exclusive, _ := schema["exclusiveMinimum"].(bool); exclusive && value <= min {
+			problems = append(problems, fmt.Sprintf("%s must be greater than %v", path, min))
+		} else if value < min {
+			problems = append(problems, fmt.Sprintf("%s must be at least %v", path, min))
+		}
+	}
+	if min, ok := numberValue(schema["exclusiveMinimum"]); ok && value <= min {
+		problems = append(problems, fmt.Sprintf("%s must be greater than %v", path, min))
+	}
+	if max, ok := numberValue(schema["maximum"]); ok {
+		if exclusive, _ := schema["exclusiveMaximum"].(bool); exclusive && value >= max {
+			problems = append(problems, fmt.Sprintf("%s must be less than %v", path, max))
+		} else if value > max {
+			problems = append(problems, fmt.Sprintf("%s must be at most %v", path, max))
+		}
+	}
+	if max, ok := numberValue(schema["exclusiveMaximum"]); ok && value >= max {
+		problems = append(problems, fmt.Sprintf("%s must be less than %v", path, max))
+	}
+	if multipleOf, ok := numberValue(schema["multipleOf"]); ok && multipleOf != 0 {
+		if quotient := value / multipleOf; quotient != math.Trunc(quotient) {
+			problems = append(problems, fmt.Sprintf("%s must be a multiple of %v", path, multipleOf))
+		}
+	}
+	return problems
+}
+
+func validateObject(document map[string]interface{}, schema map[string]interface{}, value map[string]interface{}, path string) []string {
+	var problems []string
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if _, ok := value[fmt.Sprint(name)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%v is required", path, name))
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	additional := schema["additionalProperties"]
+	for _, name := range sortedKeys(value) {
+		// JSON keys are case-sensitive, unlike the keys of the config file
+		if property, ok := properties[name]; ok {
+			switch propertySchema := property.(type) {
+			case map[string]interface{}:
+				problems = append(problems, validateSchema(document, propertySchema, value[name], path+"."+name)...)
+			case bool:
+				if !propertySchema {
+					problems = append(problems, fmt.Sprintf("%s.%s is not allowed", path, name))
+				}
+			}
+			continue
+		}
+		switch a := additional.(type) {
+		case bool:
+			if !a {
+				problems = append(problems, fmt.Sprintf("%s.%s is not allowed", path, name))
+			}
+		case map[string]interface{}:
+			problems = append(problems, validateSchema(document, a, value[name], path+"."+name)...)
+		}
+	}
+	return problems
+}
+
+func matchesType(schemaType string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return schemaType == "string"
+	case float64:
+		return schemaType == "number" || (schemaType == "integer" && v == math.Trunc(v))
+	case bool:
+		return schemaType == "boolean"
+	case []interface{}:
+		return schemaType == "array"
+	case map[string]interface{}:
+		return schemaType == "object"
+	case nil:
+		return schemaType == "null"
+	}
+	return false
+}
+
+// schemaTypes returns the types allowed by a schema, reading both the single
+// type of OpenAPI 3.0 with nullable and the type arrays of OpenAPI 3.1
+func schemaTypes(schema map[string]interface{}) []interface{} {
+	var types []interface{}
+	switch t := schema["type"].(type) {
+	case string:
+		types = []interface{}{t}
+	case []interface{}:
+		types = t
+	}
+	if nullable, _ := schema["nullable"].(bool); nullable && len(types) > 0 {
+		types = append(types, "null")
+	}
+	return types
+}
+
+func joinValues(values []interface{}, separator string) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = fmt.Sprint(value)
+	}
+	return strings.Join(parts, separator)
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if fmt.Sprint(candidate) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func countMatches(document map[string]interface{}, schemas []interface{}, value interface{}, path string) int {
+	matches := 0
+	for _, sub := range schemas {
+		if subSchema, ok := sub.(map[string]interface{}); ok && len(validateSchema(document, subSchema, value, path)) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
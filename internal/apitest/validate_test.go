@@ -0,0 +1,142 @@
+package apitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	document := decode(t, `{
+		"components": {"schemas": {
+			"Pet": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}, "Tag": {"type": "integer"}}}
+		}}
+	}`)
+
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		want   string
+	}{
+		{"string", `{"type": "string"}`, `"a"`, ""},
+		{"wrong type", `{"type": "string"}`, `1`, "body must be of type string"},
+		{"integer", `{"type": "integer"}`, `2`, ""},
+		{"integer with fraction", `{"type": "integer"}`, `2.5`, "body must be of type integer"},
+		{"null", `{"type": "string"}`, `null`, "body must not be null"},
+		{"nullable", `{"type": "string", "nullable": true}`, `null`, ""},
+		{"type array with null", `{"type": ["string", "null"]}`, `null`, ""},
+		{"enum", `{"enum": ["a", "b"]}`, `"c"`, "body must be one of [a b]"},
+		{"const", `{"const": "a"}`, `"b"`, "body must be a"},
+		{"minLength", `{"type": "string", "minLength": 2}`, `"a"`, "body must be at least 2 characters"},
+		{"maxLength counts runes", `{"type": "string", "maxLength": 2}`, `"éé"`, ""},
+		{"pattern", `{"type": "string", "pattern": "^[a-z]+$"}`, `"A1"`, "body must match pattern ^[a-z]+$"},
+		{"date-time", `{"type": "string", "format": "date-time"}`, `"2024-01-02T03:04:05Z"`, ""},
+		{"invalid date", `{"type": "string", "format": "date"}`, `"02/01/2024"`, "body must be a valid date"},
+		{"invalid uuid", `{"type": "string", "format": "uuid"}`, `"1234"`, "body must be a valid uuid"},
+		{"uri without scheme", `{"type": "string", "format": "uri"}`, `"/pets/1"`, "body must be a valid uri"},
+		{"minimum", `{"type": "number", "minimum": 1}`, `0`, "body must be at least 1"},
+		{"boolean exclusiveMinimum", `{"type": "number", "minimum": 1, "exclusiveMinimum": true}`, `1`, "body must be greater than 1"},
+		{"numeric exclusiveMaximum", `{"type": "number", "exclusiveMaximum": 10}`, `10`, "body must be less than 10"},
+		{"multipleOf", `{"type": "number", "multipleOf": 5}`, `12`, "body must be a multiple of 5"},
+		{"minItems", `{"type": "array", "minItems": 1}`, `[]`, "body must have at least 1 items"},
+		{"items", `{"type": "array", "items": {"type": "integer"}}`, `[1, "a"]`, "body[1] must be of type integer"},
+		{"prefixItems", `{"type": "array", "prefixItems": [{"type": "string"}], "items": false}`, `["a", 1]`, "body[1] is not allowed"},
+		{"required", `{"type": "object", "required": ["id"]}`, `{}`, "body.id is required"},
+		{"additionalProperties false", `{"type": "object", "properties": {"id": {}}, "additionalProperties": false}`, `{"id": 1, "x": 2}`, "body.x is not allowed"},
+		{"additionalProperties schema", `{"type": "object", "additionalProperties": {"type": "string"}}`, `{"x": 2}`, "body.x must be of type string"},
+		{"ref", `{"$ref": "#/components/schemas/Pet"}`, `{"name": "rex", "Tag": 1}`, ""},
+		{"ref required", `{"$ref": "#/components/schemas/Pet"}`, `{}`, "body.name is required"},
+		{"properties are case-sensitive", `{"$ref": "#/components/schemas/Pet"}`, `{"name": "rex", "tag": "x", "Tag": "y"}`, "body.Tag must be of type integer"},
+		{"allOf", `{"allOf": [{"type": "object", "required": ["a"]}, {"required": ["b"]}]}`, `{"a": 1}`, "body.b is required"},
+		{"anyOf", `{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `true`, "body must match at least one schema in anyOf"},
+		{"oneOf matching both", `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, `1`, "body must match exactly one schema in oneOf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Join(validateSchema(document, decode(t, tt.schema), value, "body"), "; ")
+			if got != tt.want {
+				t.Errorf("validateSchema() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	apiSpec := &APISpec{Document: decode(t, `{
+		"components": {"headers": {
+			"Remaining": {"required": true, "schema": {"type": "integer"}}
+		}}
+	}`)}
+	operation := &Operation{Responses: map[string]map[string]interface{}{
+		"200": decode(t, `{
+			"headers": {
+				"X-RateLimit-Remaining": {"$ref": "#/components/headers/Remaining"},
+				"Location": {"schema": {"type": "string", "format": "uri"}}
+			},
+			"content": {
+				"application/json": {"schema": {"type": "object", "required": ["id"]}},
+				"text/*": {"schema": {"type": "string", "maxLength": 3}},
+				"application/xml": {}
+			}
+		}`),
+		"default": decode(t, `{"content": {"*/*": {}}}`),
+	}}
+
+	tests := []struct {
+		name   string
+		status int
+		header map[string]string
+		body   string
+		want   string
+	}{
+		{"valid JSON", 200, map[string]string{"Content-Type": "application/json; charset=utf-8", "X-RateLimit-Remaining": "5"}, `{"id": 1}`, ""},
+		{"invalid JSON", 200, map[string]string{"Content-Type": "application/json", "X-RateLimit-Remaining": "5"}, `{"id"`, "body is not valid JSON"},
+		{"undocumented content type", 200, map[string]string{"Content-Type": "application/problem+json", "X-RateLimit-Remaining": "5"}, `{}`, `content type "application/problem+json" is not one of application/json, application/xml, text/*`},
+		{"missing required header", 200, map[string]string{"Content-Type": "application/json"}, `{"id": 1}`, "missing required header X-Ratelimit-Remaining"},
+		{"header schema", 200, map[string]string{"Content-Type": "application/json", "X-RateLimit-Remaining": "many", "Location": "/pets/1"}, `{"id": 1}`, "header Location must be a valid uri; header X-Ratelimit-Remaining must be of type integer"},
+		{"wildcard media type", 200, map[string]string{"Content-Type": "text/plain", "X-RateLimit-Remaining": "5"}, `abcd`, "body must be at most 3 characters"},
+		{"invalid XML", 200, map[string]string{"Content-Type": "application/xml", "X-RateLimit-Remaining": "5"}, `<a><b></a>`, "body is not valid XML"},
+		{"default response", 500, map[string]string{"Content-Type": "text/html"}, `<p>oops</p>`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for name, value := range tt.header {
+				resp.Header.Set(name, value)
+			}
+			validated, err := validateResponse(apiSpec, operation, resp, []byte(tt.body))
+			if !validated {
+				t.Fatal("validateResponse() did not validate a documented status")
+			}
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if tt.want == "" && got != "" || !strings.HasPrefix(got, tt.want) {
+				t.Errorf("validateResponse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("undocumented status", func(t *testing.T) {
+		operation := &Operation{Responses: map[string]map[string]interface{}{"200": {}}}
+		if validated, err := validateResponse(apiSpec, operation, &http.Response{StatusCode: 404, Header: http.Header{}}, nil); validated || err != nil {
+			t.Errorf("validateResponse() = %v, %v, want false, nil", validated, err)
+		}
+	})
+}
+
+func decode(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
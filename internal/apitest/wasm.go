@@ -0,0 +1,70 @@
+package apitest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// wasmHook is a command hook running a WebAssembly module, which holds the
+// runtime the module was compiled by until it is closed
+type wasmHook struct {
+	*commandHook
+	runtime wazero.Runtime
+}
+
+// Close releases the runtime and the compiled module of the hook
+func (h *wasmHook) Close() error {
+	return h.runtime.Close(context.Background())
+}
+
+// NewWasmHook returns a hook running a WASI command module at the given
+// stages, or at all of them when none is given. The module is compiled once
+// and instantiated for every message, which it reads on stdin and answers on
+// stdout like a hook command. The hook implements io.Closer; close it once it
+// is no longer used.
+func NewWasmHook(path string, stages ...string) (Hook, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading wasm hook: %w", err)
+	}
+
+	ctx := context.Background()
+	// the module stops when the request is cancelled or times out
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("wasm hook %s: %w", path, err)
+	}
+	compiled, err := runtime.CompileModule(ctx, code)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("compiling wasm hook %s: %w", path, err)
+	}
+
+	hook, err := newCommandHook(path, stages, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		// modules are anonymous so that requests run at the same time each get their own
+		config := wazero.NewModuleConfig().WithName("").WithArgs(path).
+			WithStdin(stdin).WithStdout(stdout).WithStderr(stderr)
+		module, err := runtime.InstantiateModule(ctx, compiled, config)
+		if module != nil {
+			module.Close(ctx)
+		}
+		var exitErr *sys.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() != 0 {
+			return fmt.Errorf("exit status %d", exitErr.ExitCode())
+		}
+		return err
+	})
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	return &wasmHook{commandHook: hook, runtime: runtime}, nil
+}
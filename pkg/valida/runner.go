@@ -0,0 +1,239 @@
+package valida
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"valida/internal/apitest"
+)
+
+// Options represents how a Runner sends its requests. The zero value sends
+// them one at a time to the server of the spec, without timeouts, retries or log.
+type Options struct {
+	// BaseURL replaces the server URL of the spec
+	BaseURL string
+	// Handler serves the requests in-process, without opening a listener
+	Handler http.Handler
+	// Transport sends the requests instead of a transport built from the
+	// TLS and network options
+	Transport http.RoundTripper
+
+	// ConfigFile is a Valida config file with operation overrides, fixtures and TLS settings
+	ConfigFile string
+	// Scenario runs the steps of a scenario, in order, instead of generated requests
+	Scenario *Scenario
+
+	// Seed makes the generated request data reproducible, 0 for a random seed
+	Seed uint64
+
+	Concurrency int
+	Timeout     time.Duration
+	RunTimeout  time.Duration
+	Retry       RetryPolicy
+	RateLimit   RateLimitOptions
+	TLS         TLSOptions
+	Network     NetworkOptions
+	CookieJar   bool
+
+	// Hooks run around every request, after the hooks of the config file.
+	// They belong to the caller, which closes them.
+	Hooks []Hook
+	// Variables are the initial variables of pre-request and test scripts
+	Variables map[string]string
+
+	// Log writes the run log, nil for none
+	Log *LogOptions
+	// HARFile records the requests and responses of the run as a HAR archive
+	HARFile string
+	// Version is the creator version written in HAR archives
+	Version string
+
+	// ShowSecrets turns off the masking of credentials and redacted fields in
+	// the log, reproduce commands and HAR file
+	ShowSecrets   bool
+	CommandFormat string
+}
+
+// Runner runs the tests of a spec. Every run gets its own client, log and
+// random data, so runners can be used from parallel tests.
+type Runner struct {
+	spec    *Spec
+	options Options
+}
+
+// Report represents the results of a run
+type Report struct {
+	Results  []Result
+	Coverage *CoverageReport
+}
+
+// NewRunner returns a runner for the spec, checking the options
+func NewRunner(spec *Spec, options Options) (*Runner, error) {
+	if spec == nil {
+		return nil, errors.New("no spec given")
+	}
+	if options.Handler != nil && options.Transport != nil {
+		return nil, errors.New("Handler and Transport are mutually exclusive")
+	}
+	if options.CommandFormat == "" {
+		options.CommandFormat = "curl"
+	}
+	return &Runner{spec: spec, options: options}, nil
+}
+
+// Run sends every request and returns the results with the coverage of the
+// run. When ctx is cancelled, the requests not yet completed are dropped and
+// Run returns the report of the others together with an error wrapping ctx.Err().
+func (r *Runner) Run(ctx context.Context) (*Report, error) {
+	session, spec, cases, err := r.start()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	runErr := session.Run(ctx, cases)
+	report := &Report{Results: session.Results(), Coverage: session.Coverage(spec)}
+	if err := r.end(session); err != nil {
+		return report, err
+	}
+	return report, runErr
+}
+
+// Test runs every request as a subtest of t, named after its operation, which
+// fails when the response breaks the contract
+func (r *Runner) Test(t *testing.T) {
+	t.Helper()
+	session, _, cases, err := r.start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	defer func() {
+		if err := r.end(session); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	ctx, cancel := session.WithRunTimeout(context.Background())
+	defer cancel()
+	for _, testCase := range cases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			result := session.RunCase(ctx, testCase)
+			switch {
+			case result.Failed():
+				t.Errorf("%s %s: %s\nresponse: %s\nreproduce: %s", result.Method, result.Endpoint, result.Assertion, result.Response, result.Command)
+			case strings.HasPrefix(result.Assertion, "WARNING"):
+				t.Logf("%s %s: %s", result.Method, result.Endpoint, result.Assertion)
+			}
+		})
+	}
+}
+
+// start creates the session of a run and plans its test cases
+func (r *Runner) start() (*apitest.Runner, *Spec, []apitest.TestCase, error) {
+	options, err := r.sessionOptions()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	session, err := apitest.NewRunner(options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	spec := *r.spec
+	if r.options.BaseURL != "" {
+		spec.BaseURL = strings.TrimSuffix(r.options.BaseURL, "/")
+	}
+	if r.options.Handler != nil {
+		// a relative server URL still needs a host to build requests
+		if u, err := url.Parse(spec.BaseURL); err == nil && u.Host == "" {
+			spec.BaseURL = "http://localhost" + spec.BaseURL
+		}
+	}
+
+	var cases []apitest.TestCase
+	if r.options.Scenario != nil {
+		cases = session.PlanScenario(&spec, r.options.Scenario)
+	} else {
+		cases = session.PlanRequests(&spec)
+	}
+	return session, &spec, cases, nil
+}
+
+// end writes the HAR archive of a run
+func (r *Runner) end(session *apitest.Runner) error {
+	if r.options.HARFile == "" {
+		return nil
+	}
+	return session.WriteHAR(r.options.HARFile)
+}
+
+// sessionOptions turns the options into the settings of a run
+func (r *Runner) sessionOptions() (apitest.RunnerOptions, error) {
+	options := r.options
+	session := apitest.RunnerOptions{
+		Seed:          options.Seed,
+		Concurrency:   options.Concurrency,
+		Timeout:       options.Timeout,
+		RunTimeout:    options.RunTimeout,
+		Retry:         options.Retry,
+		RateLimit:     options.RateLimit,
+		TLS:           options.TLS,
+		Network:       options.Network,
+		Transport:     options.Transport,
+		CookieJar:     options.CookieJar,
+		Hooks:         options.Hooks,
+		Variables:     options.Variables,
+		Log:           apitest.LogOptions{File: "none"},
+		RecordHAR:     options.HARFile != "",
+		Version:       options.Version,
+		ShowSecrets:   options.ShowSecrets,
+		CommandFormat: options.CommandFormat,
+	}
+	if options.ConfigFile != "" {
+		cfg, err := apitest.LoadConfig(options.ConfigFile)
+		if err != nil {
+			return session, err
+		}
+		session.Config = cfg
+	}
+	if options.Handler != nil {
+		session.Transport = apitest.HandlerTransport(options.Handler)
+	}
+	if options.Scenario != nil {
+		// the steps of a scenario depend on each other
+		session.Concurrency = 1
+	}
+	if options.Log != nil {
+		session.Log = *options.Log
+	}
+	return session, nil
+}
+
+// Failed returns the number of failed results
+func (r *Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if result.Failed() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Print prints the results as a table, followed by the commands reproducing
+// the failures and the latency percentiles
+func (r *Report) Print() {
+	apitest.DisplayTable(r.Results)
+}
+
+// String summarises the report
+func (r *Report) String() string {
+	return fmt.Sprintf("%d requests, %d failed", len(r.Results), r.Failed())
+}
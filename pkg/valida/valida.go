@@ -0,0 +1,92 @@
+// Package valida runs the contract tests Valida generates from an OpenAPI
+// spec from Go code, so a service can check itself inside go test:
+//
+//	func TestContract(t *testing.T) {
+//		spec, err := valida.LoadSpec("openapi.yaml")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		runner, err := valida.NewRunner(spec, valida.Options{Handler: newServer()})
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		runner.Test(t)
+//	}
+package valida
+
+import (
+	"valida/internal/apitest"
+)
+
+// Spec represents a loaded and validated API specification
+type Spec = apitest.APISpec
+
+// Scenario represents an ordered list of requests, such as one recorded by
+// the contract proxy or imported from Postman or HAR
+type Scenario = apitest.Scenario
+
+// Result represents the outcome of one request: its response, latency and
+// assertion, and the command reproducing it
+type Result = apitest.TableRow
+
+// CoverageReport represents the operations, status codes, parameters and
+// fields of the spec exercised by a run
+type CoverageReport = apitest.CoverageReport
+
+// RetryPolicy represents when and how often a failed request is sent again
+type RetryPolicy = apitest.RetryPolicy
+
+// RateLimitOptions represents the client side rate limits of a run
+type RateLimitOptions = apitest.RateLimitOptions
+
+// TLSOptions represents the TLS settings of the client
+type TLSOptions = apitest.TLSOptions
+
+// NetworkOptions represents the proxy, Unix socket and host overrides of the client
+type NetworkOptions = apitest.NetworkOptions
+
+// SpecOptions represents how specs are fetched over HTTP: the cache, timeout,
+// TLS and network settings
+type SpecOptions = apitest.SpecOptions
+
+// LogOptions represents the format, level and destination of the run log
+type LogOptions = apitest.LogOptions
+
+// Hook represents code run around every request, such as signing requests
+// or domain-specific checks. Embed NopHook to implement only some methods.
+type Hook = apitest.Hook
+
+// NopHook implements every method of Hook by doing nothing
+type NopHook = apitest.NopHook
+
+// Exchange represents a request and its response, as seen by hooks
+type Exchange = apitest.Exchange
+
+// CommandHook returns a hook running a shell command that receives every
+// exchange as JSON on stdin and may answer with a changed one on stdout, at
+// the given stages or all of them
+func CommandHook(command string, stages ...string) (Hook, error) {
+	return apitest.NewCommandHook(command, stages...)
+}
+
+// WasmHook returns a hook running a WASI command module that speaks the JSON
+// protocol of command hooks, at the given stages or all of them. The hook
+// implements io.Closer; close it once the runners using it are done.
+func WasmHook(path string, stages ...string) (Hook, error) {
+	return apitest.NewWasmHook(path, stages...)
+}
+
+// LoadSpec loads and validates a spec from a file path, an http(s) URL or "-" for stdin
+func LoadSpec(source string) (*Spec, error) {
+	return apitest.LoadAPISpec(source, SpecOptions{})
+}
+
+// LoadSpecWithOptions loads a spec like LoadSpec, fetching it as set by the options
+func LoadSpecWithOptions(source string, options SpecOptions) (*Spec, error) {
+	return apitest.LoadAPISpec(source, options)
+}
+
+// LoadScenario reads a scenario file
+func LoadScenario(filePath string) (*Scenario, error) {
+	return apitest.LoadScenario(filePath)
+}
@@ -0,0 +1,214 @@
+package valida_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"valida/pkg/valida"
+)
+
+const petSpec = `openapi: 3.0.3
+info:
+  title: Pets
+  version: "1.0"
+servers:
+  - url: /api
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      responses:
+        "200":
+          description: Pets
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [pets]
+                properties:
+                  pets:
+                    type: array
+                    items:
+                      type: string
+  /pets/{id}:
+    get:
+      operationId: getPet
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        "200":
+          description: A pet
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [name]
+                properties:
+                  name:
+                    type: string
+`
+
+func loadSpec(t *testing.T) *valida.Spec {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "openapi.yaml")
+	if err := os.WriteFile(path, []byte(petSpec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := valida.LoadSpec(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// petService answers as the spec describes, or breaks the contract of getPet
+func petService(broken bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/pets", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"pets": []string{"Rex"}})
+	})
+	mux.HandleFunc("/api/pets/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if broken {
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": 42})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": "Rex"})
+	})
+	return mux
+}
+
+func TestLoadSpec(t *testing.T) {
+	spec := loadSpec(t)
+	if spec.BaseURL != "/api" || len(spec.Paths) != 2 {
+		t.Errorf("LoadSpec() = base URL %q with %d paths, want /api with 2", spec.BaseURL, len(spec.Paths))
+	}
+	if _, err := valida.LoadSpec(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadSpec() of a missing file succeeded")
+	}
+}
+
+func TestNewRunnerChecksOptions(t *testing.T) {
+	if _, err := valida.NewRunner(nil, valida.Options{}); err == nil {
+		t.Error("NewRunner() accepted a nil spec")
+	}
+	options := valida.Options{Handler: petService(false), Transport: http.DefaultTransport}
+	if _, err := valida.NewRunner(loadSpec(t), options); err == nil {
+		t.Error("NewRunner() accepted both a Handler and a Transport")
+	}
+}
+
+func TestRun(t *testing.T) {
+	spec := loadSpec(t)
+	tests := []struct {
+		name       string
+		broken     bool
+		wantFailed int
+	}{
+		{"compliant service", false, 0},
+		{"broken service", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(petService(tt.broken))
+			defer server.Close()
+
+			runner, err := valida.NewRunner(spec, valida.Options{BaseURL: server.URL + "/api/", Seed: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			report, err := runner.Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Results) != 2 || report.Failed() != tt.wantFailed {
+				t.Errorf("Run() = %s, want 2 requests with %d failed", report, tt.wantFailed)
+			}
+			for _, result := range report.Results {
+				if !strings.HasPrefix(result.Endpoint, server.URL+"/api/pets") {
+					t.Errorf("request sent to %s, want the base URL %s/api", result.Endpoint, server.URL)
+				}
+			}
+			if report.Coverage == nil {
+				t.Error("Run() returned no coverage")
+			}
+		})
+	}
+}
+
+func TestRunWithHandler(t *testing.T) {
+	runner, err := valida.NewRunner(loadSpec(t), valida.Options{Handler: petService(true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := runner.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 2 || report.Failed() != 1 {
+		t.Errorf("Run() = %s, want 2 requests with 1 failed", report)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	runner, err := valida.NewRunner(loadSpec(t), valida.Options{Handler: petService(false)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := runner.Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want context.Canceled", err)
+	}
+	if report == nil {
+		t.Error("Run() returned no report when cancelled")
+	}
+}
+
+func TestRunWritesHAR(t *testing.T) {
+	harFile := filepath.Join(t.TempDir(), "run.har")
+	runner, err := valida.NewRunner(loadSpec(t), valida.Options{Handler: petService(false), HARFile: harFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(harFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har struct {
+		Log struct {
+			Entries []json.RawMessage `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatal(err)
+	}
+	if len(har.Log.Entries) != 2 {
+		t.Errorf("the HAR archive holds %d entries, want 2", len(har.Log.Entries))
+	}
+}
+
+func TestRunnerTest(t *testing.T) {
+	runner, err := valida.NewRunner(loadSpec(t), valida.Options{Handler: petService(false)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.Test(t)
+}